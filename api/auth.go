@@ -0,0 +1,103 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+)
+
+// bearerChallenge is the WWW-Authenticate header of the 401 responses.
+const bearerChallenge = `Bearer realm="ondehoje"`
+
+// isRead tells whether a method only reads, the reads are public.
+func isRead(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// authenticatedKey marks the context of the requests that went through
+// authenticate, those without a principal are anonymous.
+type authenticatedKey struct{}
+
+// isAnonymous tells whether r was authenticated without credentials. It's
+// false for every request when HandlerFactory has no Authenticator.
+func isAnonymous(r *http.Request) bool {
+	if _, ok := auth.FromContext(r.Context()); ok {
+		return false
+	}
+	authenticated, _ := r.Context().Value(authenticatedKey{}).(bool)
+	return authenticated
+}
+
+// redactOwner clears the owner of an event sent to an anonymous caller, who
+// doesn't get to know the accounts behind the events.
+func redactOwner(r *http.Request, e *event.Event) {
+	if isAnonymous(r) {
+		e.CreatedBy = ""
+	}
+}
+
+// redactActors clears the actors of the history sent to an anonymous caller.
+func redactActors(r *http.Request, history []event.Change) {
+	if !isAnonymous(r) {
+		return
+	}
+	for i := range history {
+		history[i].Actor = ""
+	}
+}
+
+// requireAuthentication answers 401 to a request needing credentials.
+func requireAuthentication(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", bearerChallenge)
+	writeProblem(w, r, http.StatusUnauthorized, "Authentication required, send an API key in "+auth.APIKeyHeader+" or a bearer token")
+}
+
+// isPublic tells whether the route of a request is one of the publicPaths.
+func isPublic(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	path, err := route.GetPathTemplate()
+	return err == nil && publicPaths[path]
+}
+
+// authenticate puts the principal of the requests with credentials in their
+// context, as the actor of their changes too, and refuses the writes without
+// credentials. Bad credentials are refused even on reads, so clients find out.
+// The public paths, such as logging in, are left alone.
+func authenticate(authenticator *auth.Authenticator) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			if isPublic(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			log := httplog.LogEntry(r.Context())
+			principal, err := authenticator.Authenticate(r, log)
+			if err != nil {
+				log.Err(err).Msg("Authentication failed")
+				writeError(w, r, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), authenticatedKey{}, true)
+			if principal == nil {
+				if !isRead(r.Method) {
+					requireAuthentication(w, r)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			ctx = auth.WithPrincipal(ctx, *principal)
+			ctx = event.WithActor(ctx, principal.String())
+			httplog.LogEntrySetField(ctx, "principal", principal.String())
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
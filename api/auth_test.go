@@ -0,0 +1,67 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_authenticate(t *testing.T) {
+	keys := auth.KeyMemoryRepository()
+	key, apiKey, err := keys.Create(context.Background(), "agenda-bot", auth.RolePromoter, zerolog.Nop())
+	require.NoError(t, err)
+	venues := venue.VenueMemoryRepository()
+	authenticator := &auth.Authenticator{Keys: keys}
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC, Authenticator: authenticator})
+	do := func(method, path, apiKey string) *httptest.ResponseRecorder {
+		var body *strings.Reader
+		if method == "POST" {
+			body = strings.NewReader(`{"title": "Jojo", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+		} else {
+			body = strings.NewReader("")
+		}
+		r := httptest.NewRequest(method, path, body)
+		if apiKey != "" {
+			r.Header.Set(auth.APIKeyHeader, apiKey)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := do("POST", "/events", "")
+	assert.Equal(t, 401, w.Code, w.Body.String())
+	assert.Equal(t, `Bearer realm="ondehoje"`, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+
+	w = do("POST", "/events", key)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	w = do("GET", "/events/1/history", "")
+	require.Equal(t, 200, w.Code, "the reads are public")
+	var changes []event.Change
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&changes))
+	require.Len(t, changes, 1)
+	assert.Empty(t, changes[0].Actor, "hidden from anonymous readers")
+	w = do("GET", "/events/1/history", key)
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&changes))
+	assert.Equal(t, "key:agenda-bot", changes[0].Actor)
+
+	assert.Equal(t, 401, do("DELETE", "/events/1", "").Code)
+	w = do("GET", "/events", "ondehoje_unknown")
+	assert.Equal(t, 401, w.Code, "bad credentials are refused on reads too")
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `error="invalid_token"`)
+
+	require.NoError(t, keys.Revoke(context.Background(), apiKey.ID, zerolog.Nop()))
+	assert.Equal(t, 401, do("DELETE", "/events/1", key).Code, "revoked")
+	assert.Equal(t, 200, do("GET", "/events/1", "").Code)
+}
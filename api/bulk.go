@@ -0,0 +1,432 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/httplog"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/validation"
+)
+
+const (
+	// eventPathId has a catch-all id, so these routes are registered before it.
+	eventBulkPath   = "/events:bulk"
+	eventExportPath = "/events/export"
+
+	csvContentType    = "text/csv"
+	ndjsonContentType = "application/x-ndjson"
+
+	// maxBulkRows and maxBulkBytes bound the size of a bulk import.
+	maxBulkRows  = 1000
+	maxBulkBytes = 10 << 20
+)
+
+// csvColumns are the columns of the exported CSV files. The bulk import
+// ignores the read-only ones, so an export can be edited and imported back.
+// Tags and exception dates are comma separated.
+var csvColumns = []string{"id", "title", "description", "location", "start_time", "end_time", "instagram_page", "tags", "recurrence", "exception_dates", "status", "venue_id", "created_at", "updated_at", "version"}
+
+// bulkRow is an event of a bulk import, or why it couldn't be read.
+type bulkRow struct {
+	event event.Event
+	err   error
+}
+
+// bulkResult is the outcome of a row in the bulk import report.
+type bulkResult struct {
+	// Row is the position of the row, from 1, not counting the CSV header.
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     int64  `json:"id,omitempty"`
+	Detail string `json:"detail,omitempty"`
+	// Errors lists the invalid fields of the invalid rows.
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
+
+// Statuses of the rows of a bulk import. Rows are skipped when another one of
+// an atomic import failed.
+const (
+	bulkCreated = "created"
+	bulkInvalid = "invalid"
+	bulkFailed  = "failed"
+	bulkSkipped = "skipped"
+)
+
+// bulkReport is the response of a bulk import.
+type bulkReport struct {
+	Mode    string       `json:"mode"`
+	Created int          `json:"created"`
+	Failed  int          `json:"failed"`
+	Results []bulkResult `json:"results"`
+}
+
+// parseCSVEvents reads the events of a CSV file with a header, dates without
+// offset are in loc and tags are comma separated.
+func parseCSVEvents(r io.Reader, loc *time.Location) ([]bulkRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("empty CSV, expected a header")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	known := map[string]bool{}
+	for _, c := range csvColumns {
+		known[c] = true
+	}
+	seen := map[string]bool{}
+	for i, name := range header {
+		// spreadsheets often start their exports with a byte order mark
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !known[name] {
+			return nil, fmt.Errorf("unknown CSV column %q, expected some of %s", name, strings.Join(csvColumns, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicated CSV column %q", name)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+	for _, required := range []string{"title", "start_time", "end_time"} {
+		if !seen[required] {
+			return nil, fmt.Errorf("missing CSV column %q", required)
+		}
+	}
+	var rows []bulkRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == maxBulkRows {
+			return nil, fmt.Errorf("too many rows, at most %d", maxBulkRows)
+		}
+		if len(record) != len(header) {
+			rows = append(rows, bulkRow{err: fmt.Errorf("expected %d fields, got %d", len(header), len(record))})
+			continue
+		}
+		var row bulkRow
+		for i, value := range record {
+			if err := setCSVField(&row.event, header[i], strings.TrimSpace(value), loc); err != nil {
+				row.err = fmt.Errorf("invalid %s: %w", header[i], err)
+				break
+			}
+		}
+		rows = append(rows, row)
+	}
+}
+
+func setCSVField(e *event.Event, column, value string, loc *time.Location) error {
+	var err error
+	switch column {
+	case "title":
+		e.Title = value
+	case "description":
+		e.Description = value
+	case "location":
+		e.Location = value
+	case "instagram_page":
+		e.InstagramPage = value
+	case "start_time":
+		e.StartTime, err = parseCSVTime(value, loc)
+	case "end_time":
+		e.EndTime, err = parseCSVTime(value, loc)
+	case "tags":
+		for _, tag := range strings.Split(value, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				e.Tags = append(e.Tags, tag)
+			}
+		}
+	case "recurrence":
+		e.Recurrence = value
+	case "status":
+		e.Status = event.Status(value)
+	case "exception_dates":
+		for _, date := range strings.Split(value, ",") {
+			if date = strings.TrimSpace(date); date != "" {
+				var t time.Time
+				if t, err = parseCSVTime(date, loc); err != nil {
+					return err
+				}
+				e.ExceptionDates = append(e.ExceptionDates, t)
+			}
+		}
+	case "venue_id":
+		if value != "" {
+			var id int64
+			id, err = strconv.ParseInt(value, 10, 64)
+			e.VenueID = &id
+		}
+	}
+	return err
+}
+
+// parseCSVTime accepts RFC 3339 timestamps, and the local times spreadsheets
+// write such as 2023-05-13 23:00, in loc.
+func parseCSVTime(value string, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a RFC 3339 timestamp nor a local time such as 2006-01-02 15:04", value)
+}
+
+// parseNDJSONEvents reads one event per line, like the body of POST /events.
+// Blank lines are ignored.
+func parseNDJSONEvents(r io.Reader) ([]bulkRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxBulkBytes)
+	var rows []bulkRow
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		if len(rows) == maxBulkRows {
+			return nil, fmt.Errorf("too many rows, at most %d", maxBulkRows)
+		}
+		var row bulkRow
+		if err := json.Unmarshal(line, &row.event); err != nil {
+			row.err = fmt.Errorf("invalid JSON: %w", err)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid NDJSON: %w", err)
+	}
+	return rows, nil
+}
+
+// postBulkEventsHandler creates many events at once from a CSV or NDJSON body.
+// By default the import is atomic: when a row is invalid or fails, no event is
+// created. With mode=best_effort, the valid rows are created anyway.
+func postBulkEventsHandler(eventRepo event.Repository, loc *time.Location) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("postBulkEventsHandler")
+		if !authorize(w, r, auth.ActionCreate, "") {
+			return
+		}
+		report := bulkReport{Mode: r.URL.Query().Get("mode"), Results: []bulkResult{}}
+		switch report.Mode {
+		case "":
+			report.Mode = "atomic"
+		case "atomic", "best_effort":
+		default:
+			writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("invalid mode %q, expected atomic or best_effort", report.Mode))
+			return
+		}
+		body := http.MaxBytesReader(w, r.Body, maxBulkBytes)
+		var rows []bulkRow
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch {
+		case err == nil && mediaType == csvContentType:
+			rows, err = parseCSVEvents(body, loc)
+		case err == nil && (mediaType == ndjsonContentType || mediaType == "application/ndjson"):
+			rows, err = parseNDJSONEvents(body)
+		default:
+			log.Error().Msgf("Unsupported content type: %s", r.Header.Get("Content-Type"))
+			writeProblem(w, r, http.StatusUnsupportedMediaType, "Unsupported media type, expected "+csvContentType+" or "+ndjsonContentType)
+			return
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeProblem(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Body too large, at most %d bytes", maxBulkBytes))
+			return
+		}
+		if err != nil {
+			log.Err(err).Msg("Error decoding events")
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(rows) == 0 {
+			writeProblem(w, r, http.StatusBadRequest, "No events to create")
+			return
+		}
+
+		// rows that can't be created are reported right away, the others are
+		// created in a single batch
+		var batch []event.Event
+		var positions []int
+		for i, row := range rows {
+			result := bulkResult{Row: i + 1}
+			var verr *event.ValidationError
+			switch {
+			case row.err != nil:
+				result.Status, result.Detail = bulkInvalid, row.err.Error()
+			case errors.As(row.event.ValidateNew(), &verr):
+				result.Status, result.Detail, result.Errors = bulkInvalid, verr.Error(), verr.Fields
+			default:
+				batch = append(batch, row.event)
+				positions = append(positions, i)
+			}
+			report.Results = append(report.Results, result)
+		}
+		atomic := report.Mode == "atomic"
+		if atomic && len(batch) < len(rows) {
+			batch = nil
+		}
+		if len(batch) > 0 {
+			results, err := eventRepo.CreateMany(r.Context(), batch, atomic, log)
+			if err != nil {
+				log.Err(err).Msg("Error creating events")
+				writeError(w, r, err)
+				return
+			}
+			for i, created := range results {
+				result := &report.Results[positions[i]]
+				var verr *event.ValidationError
+				switch {
+				case created.Event != nil:
+					result.Status, result.ID = bulkCreated, created.Event.ID
+				case errors.As(created.Err, &verr):
+					result.Status, result.Detail, result.Errors = bulkInvalid, verr.Error(), verr.Fields
+				case created.Err != nil:
+					result.Status, result.Detail = bulkFailed, created.Err.Error()
+				}
+			}
+		}
+		for i := range report.Results {
+			switch report.Results[i].Status {
+			case bulkCreated:
+				report.Created++
+			case "":
+				report.Results[i].Status = bulkSkipped
+			default:
+				report.Failed++
+			}
+		}
+
+		status := http.StatusOK
+		if atomic && report.Failed > 0 {
+			status = http.StatusUnprocessableEntity
+		}
+		reportJson, err := json.Marshal(report)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling report")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling report")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(reportJson)
+		log.Info().Msgf("Bulk import done, %d created and %d failed", report.Created, report.Failed)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// getExportEventsHandler streams every event the caller may see as CSV or
+// NDJSON, without holding them all in memory. Errors after the first event can
+// only be logged.
+func getExportEventsHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getExportEventsHandler")
+		format := r.URL.Query().Get("format")
+		var write func(event.Event) error
+		var flush func() error
+		switch format {
+		case "", "ndjson":
+			format = "ndjson"
+			buffered := bufio.NewWriter(w)
+			encoder := json.NewEncoder(buffered)
+			write = func(e event.Event) error { return encoder.Encode(e) }
+			flush = buffered.Flush
+			w.Header().Set("Content-Type", ndjsonContentType)
+		case "csv":
+			writer := csv.NewWriter(w)
+			write = func(e event.Event) error { return writer.Write(csvRecord(e)) }
+			flush = func() error {
+				writer.Flush()
+				return writer.Error()
+			}
+			w.Header().Set("Content-Type", csvContentType+"; charset=utf-8")
+			if err := writer.Write(csvColumns); err != nil {
+				log.Err(err).Msg("Error writing CSV header")
+				return
+			}
+		default:
+			writeProblem(w, r, http.StatusBadRequest, fmt.Sprintf("invalid format %q, expected csv or ndjson", format))
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "events."+format))
+
+		count := 0
+		err := eventRepo.Each(r.Context(), log, func(e event.Event) error {
+			if !canSee(r, e) {
+				return nil
+			}
+			redactOwner(r, &e)
+			count++
+			return write(e)
+		})
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			if count == 0 {
+				// nothing was sent yet, the CSV header is still buffered
+				log.Err(err).Msg("Error exporting events")
+				writeError(w, r, err)
+				return
+			}
+			log.Err(err).Msgf("Export interrupted after %d events", count)
+			return
+		}
+		log.Info().Msgf("Exported %d events", count)
+	}
+	return http.HandlerFunc(fn)
+}
+
+// csvRecord returns the fields of e in the order of csvColumns.
+func csvRecord(e event.Event) []string {
+	venueID := ""
+	if e.VenueID != nil {
+		venueID = strconv.FormatInt(*e.VenueID, 10)
+	}
+	exceptionDates := make([]string, len(e.ExceptionDates))
+	for i, d := range e.ExceptionDates {
+		exceptionDates[i] = d.Format(time.RFC3339)
+	}
+	return []string{
+		strconv.FormatInt(e.ID, 10),
+		e.Title,
+		e.Description,
+		e.Location,
+		e.StartTime.Format(time.RFC3339),
+		e.EndTime.Format(time.RFC3339),
+		e.InstagramPage,
+		strings.Join(e.Tags, ","),
+		e.Recurrence,
+		strings.Join(exceptionDates, ","),
+		string(e.Status),
+		venueID,
+		e.CreatedAt.Format(time.RFC3339),
+		e.UpdatedAt.Format(time.RFC3339),
+		strconv.FormatInt(e.Version, 10),
+	}
+}
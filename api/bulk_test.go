@@ -0,0 +1,139 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_postBulkEventsHandler(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	csvBody := "title,start_time,end_time,tags,venue_id\n" +
+		"Jojo,2023-05-13 23:00,2023-05-14 05:00,\"Techno, Free Entry\",\n" +
+		"Sarau,2023-05-12T19:00:00-03:00,2023-05-12T22:00:00-03:00,,\n"
+	invalidCSV := csvBody + ",2023-05-12 19:00,2023-05-12 18:00,,\n" + "Punk,yesterday,2023-05-12 18:00,,\n"
+	ndjsonBody := `{"title": "Jojo", "start_time": "2023-05-13T23:00:00-03:00", "end_time": "2023-05-14T05:00:00-03:00"}` + "\n\n" +
+		`{"title": "At a missing venue", "venue_id": 9, "start_time": "2023-05-13T23:00:00-03:00", "end_time": "2023-05-14T05:00:00-03:00"}` + "\n" +
+		`{"title": "Broken", ` + "\n"
+
+	testCases := []struct {
+		name               string
+		query              string
+		contentType        string
+		body               string
+		expectedStatusCode int
+		expectedCreated    int
+		expectedStatuses   []string
+	}{
+		{"CSV", "", "text/csv", csvBody, 200, 2, []string{"created", "created"}},
+		{"Atomic CSV with invalid rows", "", "text/csv; charset=utf-8", invalidCSV, 422, 0, []string{"skipped", "skipped", "invalid", "invalid"}},
+		{"Best effort CSV with invalid rows", "?mode=best_effort", "text/csv", invalidCSV, 200, 2, []string{"created", "created", "invalid", "invalid"}},
+		{"Atomic NDJSON with a missing venue", "?mode=atomic", "application/x-ndjson", ndjsonBody, 422, 0, []string{"skipped", "skipped", "invalid"}},
+		{"Best effort NDJSON with a missing venue", "?mode=best_effort", "application/x-ndjson", ndjsonBody, 200, 1, []string{"created", "invalid", "invalid"}},
+		{"Unknown mode", "?mode=some", "text/csv", csvBody, 400, 0, nil},
+		{"Unknown content type", "", "application/json", csvBody, 415, 0, nil},
+		{"Unknown CSV column", "", "text/csv", "title,start_time,end_time,price\n", 400, 0, nil},
+		{"Missing CSV column", "", "text/csv", "title,start_time\n", 400, 0, nil},
+		{"Empty", "", "application/x-ndjson", "\n", 400, 0, nil},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			venues := venue.VenueMemoryRepository()
+			events := event.EventMemoryRepository(venues)
+			handler := HandlerFactory(events, venues, Config{Location: saoPaulo})
+			req := httptest.NewRequest("POST", "/events:bulk"+tc.query, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", tc.contentType)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tc.expectedStatusCode, w.Code, w.Body.String())
+			if tc.expectedStatuses == nil {
+				return
+			}
+			var report bulkReport
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&report))
+			assert.Equal(t, tc.expectedCreated, report.Created)
+			var statuses []string
+			for i, result := range report.Results {
+				assert.Equal(t, i+1, result.Row)
+				statuses = append(statuses, result.Status)
+			}
+			assert.Equal(t, tc.expectedStatuses, statuses)
+			all, err := events.All(req.Context(), zerolog.Nop())
+			require.NoError(t, err)
+			assert.Len(t, all, tc.expectedCreated)
+		})
+	}
+
+	t.Run("CSV local times and tags", func(t *testing.T) {
+		rows, err := parseCSVEvents(strings.NewReader(csvBody), saoPaulo)
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, time.Date(2023, time.May, 13, 23, 0, 0, 0, saoPaulo), rows[0].event.StartTime)
+		assert.Equal(t, []string{"Techno", "Free Entry"}, rows[0].event.Tags)
+	})
+}
+
+func Test_getExportEventsHandler(t *testing.T) {
+	venues := venue.VenueMemoryRepository()
+	events := event.EventMemoryRepository(venues)
+	handler := HandlerFactory(events, venues, Config{Location: time.UTC})
+	body := `{"title": "Jojo, techno", "tags": ["techno", "queer"], "recurrence": "FREQ=WEEKLY", "exception_dates": ["2023-05-27T23:00:00Z", "2023-05-20T23:00:00Z"], "start_time": "2023-05-13T23:00:00Z", "end_time": "2023-05-14T05:00:00Z"}` + "\n" +
+		`{"title": "Sarau", "description": "Poesia\nno centro", "start_time": "2023-05-12T19:00:00Z", "end_time": "2023-05-12T22:00:00Z"}` + "\n"
+	req := httptest.NewRequest("POST", "/events:bulk", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	require.Equal(t, 200, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/events/export?format=csv", nil))
+	require.Equal(t, 200, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="events.csv"`, w.Header().Get("Content-Disposition"))
+	exported := w.Body.String()
+	records, err := csv.NewReader(strings.NewReader(exported)).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, records, 3)
+	assert.Equal(t, csvColumns, records[0])
+	assert.Equal(t, []string{"1", "Jojo, techno"}, records[1][:2])
+	assert.Equal(t, "queer,techno", records[1][7])
+	assert.Equal(t, "FREQ=WEEKLY", records[1][8])
+	assert.Equal(t, "2023-05-20T23:00:00Z,2023-05-27T23:00:00Z", records[1][9])
+	assert.Equal(t, "Poesia\nno centro", records[2][2])
+
+	// an export can be imported back
+	req = httptest.NewRequest("POST", "/events:bulk", strings.NewReader(exported))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/events/export", nil))
+	require.Equal(t, 200, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 4)
+	var last event.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &last))
+	assert.Equal(t, int64(4), last.ID)
+	assert.Equal(t, "Poesia\nno centro", last.Description)
+	var imported event.Event
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &imported))
+	assert.Equal(t, "FREQ=WEEKLY", imported.Recurrence)
+	assert.Len(t, imported.ExceptionDates, 2)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/events/export?format=xlsx", nil))
+	assert.Equal(t, 400, w.Code)
+}
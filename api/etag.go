@@ -0,0 +1,93 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/httplog"
+	"github.com/perebaj/ondehj/event"
+)
+
+// etag is the entity tag of an event, derived from its version. The embedded
+// venue changes without the version, so the time it was updated is appended
+// when there's one, as in "3.1683932400000000".
+func etag(e *event.Event) string {
+	if e.Venue != nil {
+		return fmt.Sprintf(`"%d.%d"`, e.Version, e.Venue.UpdatedAt.UnixMicro())
+	}
+	return fmt.Sprintf(`"%d"`, e.Version)
+}
+
+// tagVersion returns the event version of a strong entity tag made by etag.
+func tagVersion(tag string) (int64, bool) {
+	// If-Match uses the strong comparison, weak tags never match.
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return 0, false
+	}
+	tag = tag[1 : len(tag)-1]
+	if i := strings.IndexByte(tag, '.'); i >= 0 {
+		if _, err := strconv.ParseInt(tag[i+1:], 10, 64); err != nil {
+			return 0, false
+		}
+		tag = tag[:i]
+	}
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// ifMatchVersion returns the version of the event id required by the If-Match
+// header of r. Zero means the request is unconditional. The tags are compared
+// whole to the current entity tag of the event, looked up in eventRepo, so a
+// change of its venue fails the match too. The version of the event is then
+// returned, for the write to check it wasn't changed since. ok is false when
+// the header doesn't list the current tag, the request must then fail with 412
+// Precondition Failed.
+func ifMatchVersion(r *http.Request, eventRepo event.Repository, id int64) (version int64, ok bool) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if _, ok := tagVersion(tag); ok {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return 0, false
+	}
+	current, err := eventRepo.GetByID(r.Context(), id, httplog.LogEntry(r.Context()))
+	if err != nil {
+		// the write answers the error
+		version, _ := tagVersion(tags[0])
+		return version, true
+	}
+	for _, tag := range tags {
+		if tag == etag(current) {
+			return current.Version, true
+		}
+	}
+	return 0, false
+}
+
+// ifNoneMatch reports whether the If-None-Match header of r matches the entity tag,
+// meaning the client copy is up to date.
+func ifNoneMatch(r *http.Request, tag string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+)
+
+// The history of an event. eventRevertPath is a custom method like
+// eventBulkPath, registered before the catch-all id of eventPathId.
+const (
+	eventHistoryPath = "/events/{id:[0-9]+}/history"
+	eventRevertPath  = "/events/{id:[0-9]+}:revert"
+)
+
+func getHistoryHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getHistoryHandler")
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		if !authorizeHistory(w, r, eventRepo, id) {
+			return
+		}
+		history, err := eventRepo.History(r.Context(), id, log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving the history")
+			writeError(w, r, err)
+			return
+		}
+		redactActors(r, history)
+		historyJson, err := json.Marshal(history)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling the history")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling the history")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(historyJson)
+		log.Info().Msg("History retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// authorizeHistory tells whether the caller may read the history of the event
+// id, which holds every version of its fields. The history of a live event is
+// seen by those who see the event, as canSee tells, and the history of an
+// event in the trash, or purged, only by the curators and the admins.
+func authorizeHistory(w http.ResponseWriter, r *http.Request, eventRepo event.Repository, id int64) bool {
+	log := httplog.LogEntry(r.Context())
+	e, err := eventRepo.GetByID(r.Context(), id, log)
+	switch {
+	case err == nil:
+		if !canSee(r, *e) {
+			log.Error().Msgf("Event is %s, its history is hidden from the caller", e.Status)
+			writeError(w, r, event.ErrNotFound)
+			return false
+		}
+		return true
+	case errors.Is(err, event.ErrNotFound):
+		// ErrGone wraps ErrNotFound, the purged events have a history too
+		return authorize(w, r, auth.ActionReview, "")
+	default:
+		log.Err(err).Msg("Error retrieving the event")
+		writeError(w, r, err)
+		return false
+	}
+}
+
+// revert is the body of the revert requests.
+type revert struct {
+	Version int64 `json:"version"`
+}
+
+func revertEventHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("revertEventHandler")
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		var body revert
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil {
+			log.Err(err).Msg("Error decoding revert")
+			writeProblem(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		if body.Version < 1 {
+			log.Error().Msgf("Invalid version: %d", body.Version)
+			writeProblem(w, r, http.StatusBadRequest, "version must be the version to revert to, 1 or more")
+			return
+		}
+		if !authorize(w, r, auth.ActionAdminister, "") {
+			return
+		}
+
+		reverted, err := eventRepo.Revert(r.Context(), id, body.Version, log)
+		if err != nil {
+			log.Err(err).Msg("Revert failed")
+			writeError(w, r, err)
+			return
+		}
+		eventJson, err := json.Marshal(reverted)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling events")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(reverted))
+		w.Write(eventJson)
+		log.Info().Msgf("Event reverted to version %d successfully", body.Version)
+	}
+	return http.HandlerFunc(fn)
+}
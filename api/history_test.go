@@ -0,0 +1,115 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_eventHistory(t *testing.T) {
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	w := do("POST", "/events", `{"title": "Jojo", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	w = do("PUT", "/events/1", `{"title": "Jojo Todynho", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+
+	w = do("GET", "/events/1/history", "")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var history []event.Change
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&history))
+	require.Len(t, history, 2)
+	assert.Equal(t, event.OperationCreate, history[0].Operation)
+	assert.Equal(t, event.AnonymousActor, history[0].Actor)
+	assert.Equal(t, event.OperationUpdate, history[1].Operation)
+	assert.Equal(t, int64(2), history[1].Version)
+	assert.Equal(t, map[string]event.FieldDiff{"title": {Old: "Jojo", New: "Jojo Todynho"}}, history[1].Diff)
+	assert.Equal(t, 404, do("GET", "/events/9/history", "").Code)
+
+	testCases := []struct {
+		name               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"Invalid body", `{"version": "1"}`, 400},
+		{"Missing version", `{}`, 400},
+		{"Unknown version", `{"version": 9}`, 404},
+		{"Revert", `{"version": 1}`, 200},
+	}
+	for _, tc := range testCases {
+		w := do("POST", "/events/1:revert", tc.body)
+		assert.Equal(t, tc.expectedStatusCode, w.Code, "%s: %s", tc.name, w.Body.String())
+	}
+	w = do("GET", "/events/1", "")
+	assert.Contains(t, w.Body.String(), `"title":"Jojo"`)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+
+	assert.Equal(t, 200, do("DELETE", "/events/1", "").Code)
+	assert.Equal(t, 410, do("POST", "/events/1:revert", `{"version": 2}`).Code)
+	w = do("GET", "/events/1/history", "")
+	require.Equal(t, 200, w.Code, "the history of deleted events is kept")
+	assert.Contains(t, w.Body.String(), `"operation":"delete"`)
+}
+
+func Test_historyVisibility(t *testing.T) {
+	keys := auth.KeyMemoryRepository()
+	newKey := func(name string, role auth.Role) string {
+		key, _, err := keys.Create(context.Background(), name, role, zerolog.Nop())
+		require.NoError(t, err)
+		return key
+	}
+	owner, other, curator := newKey("jojo", auth.RolePromoter), newKey("ana", auth.RolePromoter), newKey("curator", auth.RoleCurator)
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC, Authenticator: &auth.Authenticator{Keys: keys}})
+	do := func(key, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(auth.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	for _, status := range []string{"draft", "published", "published"} {
+		w := do(owner, "POST", "/events", `{"title": "Jojo", "status": "`+status+`", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+		require.Equal(t, 200, w.Code, w.Body.String())
+	}
+	require.Equal(t, 200, do(owner, "DELETE", "/events/3", "").Code)
+
+	testCases := []struct {
+		name               string
+		key                string
+		path               string
+		expectedStatusCode int
+	}{
+		{"Draft, anonymous", "", "/events/1/history", 404},
+		{"Draft, another promoter", other, "/events/1/history", 404},
+		{"Draft, owner", owner, "/events/1/history", 200},
+		{"Draft, curator", curator, "/events/1/history", 200},
+		{"Published, anonymous", "", "/events/2/history", 200},
+		{"Trashed, anonymous", "", "/events/3/history", 401},
+		{"Trashed, another promoter", other, "/events/3/history", 403},
+		{"Trashed, owner", owner, "/events/3/history", 403},
+		{"Trashed, curator", curator, "/events/3/history", 200},
+		{"Missing, curator", curator, "/events/9/history", 404},
+	}
+	for _, tc := range testCases {
+		w := do(tc.key, "GET", tc.path, "")
+		assert.Equal(t, tc.expectedStatusCode, w.Code, "%s: %s", tc.name, w.Body.String())
+	}
+}
@@ -0,0 +1,234 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/ical"
+	"github.com/perebaj/ondehj/venue"
+)
+
+const (
+	// eventPathId has a catch-all id, so these routes are registered before it.
+	eventCalendarPath   = "/events.ics"
+	eventCalendarPathId = "/events/{id:[0-9]+}.ics"
+	tagCalendarPath     = "/tags/{tag}/events.ics"
+	venueCalendarPath   = "/venues/{id}/events.ics"
+
+	calendarContentType = "text/calendar; charset=utf-8"
+	calendarName        = "Onde Hoje"
+	// feedHistory is how far back the feeds go without from or date, so
+	// subscribers still see the events they went to.
+	feedHistory = 30 * 24 * time.Hour
+	// maxFeedEvents bounds the size of a feed.
+	maxFeedEvents = 1000
+)
+
+// calendarEvent maps an event to a VEVENT. Its UID only depends on the id, and
+// on the original start of the occurrences of recurring events, so calendar
+// applications update the events they already have.
+func calendarEvent(e event.Event) ical.Event {
+	uid := fmt.Sprintf("event-%d@ondehoje", e.ID)
+	if e.Occurrence != nil {
+		uid = fmt.Sprintf("event-%d-%s@ondehoje", e.ID, e.Occurrence.UTC().Format("20060102T150405Z"))
+	}
+	ce := ical.Event{
+		UID:          uid,
+		Stamp:        e.UpdatedAt,
+		Created:      e.CreatedAt,
+		LastModified: e.UpdatedAt,
+		Sequence:     e.Version - 1,
+		Start:        e.StartTime,
+		End:          e.EndTime,
+		Summary:      e.Title,
+		Description:  e.Description,
+		Location:     e.Location,
+		Categories:   e.Tags,
+	}
+	switch e.Status {
+	case event.StatusCancelled:
+		ce.Status = "CANCELLED"
+	case event.StatusPublished:
+		ce.Status = "CONFIRMED"
+	default:
+		// no date is set for the postponed events yet
+		ce.Status = "TENTATIVE"
+	}
+	if ce.Sequence < 0 {
+		ce.Sequence = 0
+	}
+	if e.Venue != nil {
+		ce.Location = e.Venue.Name
+		if e.Venue.Address != "" {
+			ce.Location += ", " + e.Venue.Address
+		}
+		if e.Venue.Coordinates != nil {
+			ce.Geo = &ical.Geo{Latitude: e.Venue.Coordinates.Latitude, Longitude: e.Venue.Coordinates.Longitude}
+		}
+	}
+	if e.InstagramPage != "" {
+		ce.URL = "https://www.instagram.com/" + e.InstagramPage + "/"
+	}
+	return ce
+}
+
+// calendarSeries maps an event to its VEVENTs: a recurring event has a VEVENT
+// with its recurrence in loc, followed by one per moved occurrence.
+func calendarSeries(e event.Event, loc *time.Location) []ical.Event {
+	series := calendarEvent(e)
+	if e.Recurrence == "" {
+		return []ical.Event{series}
+	}
+	series.Rule = e.Recurrence
+	series.Start, series.End = e.StartTime.In(loc), e.EndTime.In(loc)
+	series.ExceptionDates = append([]time.Time{}, e.ExceptionDates...)
+	var moved []ical.Event
+	for _, o := range e.Overrides {
+		if o.Cancelled {
+			series.ExceptionDates = append(series.ExceptionDates, o.Occurrence)
+			continue
+		}
+		occurrence := calendarEvent(e)
+		occurrence.RecurrenceID, occurrence.Start, occurrence.End = o.Occurrence, *o.StartTime, *o.EndTime
+		moved = append(moved, occurrence)
+	}
+	return append([]ical.Event{series}, moved...)
+}
+
+// writeCalendar answers cal, already encoded so errors are still problems.
+func writeCalendar(w http.ResponseWriter, r *http.Request, cal ical.Calendar, filename string) {
+	log := httplog.LogEntry(r.Context())
+	var b bytes.Buffer
+	if err := ical.Write(&b, cal); err != nil {
+		log.Err(err).Msg("Error encoding calendar")
+		writeProblem(w, r, http.StatusInternalServerError, "Error encoding calendar")
+		return
+	}
+	w.Header().Set("Content-Type", calendarContentType)
+	if filename != "" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", filename))
+	}
+	w.Write(b.Bytes())
+}
+
+// writeCalendarFeed answers the events matching the query string and narrowed
+// down by feed, in a calendar named name.
+func writeCalendarFeed(w http.ResponseWriter, r *http.Request, eventRepo event.Repository, loc *time.Location, name string, feed func(*event.Filter)) {
+	log := httplog.LogEntry(r.Context())
+	values := r.URL.Query()
+	filter, err := parseFilter(values, loc)
+	if err != nil {
+		log.Err(err).Msg("Invalid filter")
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if !authorizeStatuses(w, r, filter.Statuses) {
+		return
+	}
+	if filter.From.IsZero() && values.Get("date") == "" {
+		filter.From = timeNow().Add(-feedHistory)
+	}
+	if feed != nil {
+		feed(&filter)
+	}
+	filter.Limit = maxPageSize
+	cal := ical.Calendar{Name: name, Timezone: loc.String(), Events: []ical.Event{}}
+	for len(cal.Events) < maxFeedEvents {
+		page, err := eventRepo.List(r.Context(), filter, log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving events")
+			writeError(w, r, err)
+			return
+		}
+		for _, e := range page.Events {
+			cal.Events = append(cal.Events, calendarEvent(e))
+		}
+		if page.Next == nil {
+			break
+		}
+		filter.Cursor = page.Next
+	}
+	writeCalendar(w, r, cal, "")
+	log.Info().Msgf("Calendar of %d events retrieved successfully", len(cal.Events))
+}
+
+func getEventsCalendarHandler(eventRepo event.Repository, loc *time.Location) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getEventsCalendarHandler")
+		writeCalendarFeed(w, r, eventRepo, loc, calendarName, nil)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func getEventCalendarHandler(eventRepo event.Repository, loc *time.Location) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getEventCalendarHandler")
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		e, err := eventRepo.GetByID(r.Context(), id, log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving event")
+			writeError(w, r, err)
+			return
+		}
+		if !canSee(r, *e) {
+			log.Error().Msgf("Event is %s, hidden from the caller", e.Status)
+			writeError(w, r, event.ErrNotFound)
+			return
+		}
+		cal := ical.Calendar{Timezone: loc.String(), Events: calendarSeries(*e, loc)}
+		writeCalendar(w, r, cal, fmt.Sprintf("event-%d.ics", id))
+		log.Info().Msg("Event calendar retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func getTagCalendarHandler(eventRepo event.Repository, loc *time.Location) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getTagCalendarHandler")
+		tag := event.NormalizeTag(mux.Vars(r)["tag"])
+		if tag == "" {
+			writeProblem(w, r, http.StatusBadRequest, "Invalid tag")
+			return
+		}
+		writeCalendarFeed(w, r, eventRepo, loc, calendarName+" · "+tag, func(filter *event.Filter) {
+			filter.Tags, filter.AllTags = []string{tag}, false
+		})
+	}
+	return http.HandlerFunc(fn)
+}
+
+func getVenueCalendarHandler(eventRepo event.Repository, venueRepo venue.Repository, loc *time.Location) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getVenueCalendarHandler")
+		id, ok := venueID(w, r)
+		if !ok {
+			return
+		}
+		v, err := venueRepo.GetByID(r.Context(), id, log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving venue")
+			writeError(w, r, err)
+			return
+		}
+		writeCalendarFeed(w, r, eventRepo, loc, calendarName+" · "+v.Name, func(filter *event.Filter) {
+			filter.VenueID = v.ID
+		})
+	}
+	return http.HandlerFunc(fn)
+}
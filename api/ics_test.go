@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_calendarHandlers(t *testing.T) {
+	now := time.Date(2023, time.May, 10, 22, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: saoPaulo})
+
+	setup := []struct {
+		path string
+		body string
+	}{
+		{"/venues", `{"name": "Trackers", "address": "Rua Dom José de Barros, 337", "coordinates": {"lat": -23.5446, "lng": -46.6406}}`},
+		{"/events", `{"title": "Jojo; techno, all night", "venue_id": 1, "tags": ["techno"], "instagram_page": "jojo", "start_time": "2023-05-13T23:00:00-03:00", "end_time": "2023-05-14T05:00:00-03:00"}`},
+		{"/events", `{"title": "Sarau", "location": "Praça Roosevelt", "tags": ["slam"], "start_time": "2023-05-12T19:00:00-03:00", "end_time": "2023-05-12T22:00:00-03:00"}`},
+		{"/events", `{"title": "Long gone", "start_time": "2023-01-12T19:00:00-03:00", "end_time": "2023-01-12T22:00:00-03:00"}`},
+	}
+	for _, s := range setup {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", s.path, strings.NewReader(s.body)))
+		if !assert.Equal(t, 200, w.Code, w.Body.String()) {
+			return
+		}
+	}
+
+	testCases := []struct {
+		name               string
+		path               string
+		expectedStatusCode int
+		expected           []string
+		unexpected         []string
+	}{
+		{
+			name:               "Feed of the recent and upcoming events",
+			path:               "/events.ics",
+			expectedStatusCode: 200,
+			expected: []string{
+				"BEGIN:VCALENDAR\r\n", "X-WR-CALNAME:Onde Hoje\r\n", "X-WR-TIMEZONE:America/Sao_Paulo\r\n",
+				"UID:event-1@ondehoje\r\n", "DTSTART:20230514T020000Z\r\n", "DTEND:20230514T080000Z\r\n",
+				`SUMMARY:Jojo\; techno\, all night`, `LOCATION:Trackers\, Rua Dom José de Barros\, 337`,
+				"URL:https://www.instagram.com/jojo/\r\n", "CATEGORIES:techno\r\n", "SEQUENCE:0\r\n",
+				"UID:event-2@ondehoje\r\n", "LOCATION:Praça Roosevelt\r\n",
+			},
+			unexpected: []string{"UID:event-3@ondehoje"},
+		},
+		{
+			name:               "Feed honouring the listing filters",
+			path:               "/events.ics?from=2023-01-01&q=sarau",
+			expectedStatusCode: 200,
+			expected:           []string{"UID:event-2@ondehoje"},
+			unexpected:         []string{"UID:event-1@ondehoje", "UID:event-3@ondehoje"},
+		},
+		{
+			name:               "Feed with an invalid filter",
+			path:               "/events.ics?date=yesterday",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Single event",
+			path:               "/events/1.ics",
+			expectedStatusCode: 200,
+			expected:           []string{"UID:event-1@ondehoje", "GEO:-23.544600;-46.640600"},
+			unexpected:         []string{"X-WR-CALNAME"},
+		},
+		{
+			name:               "Missing event",
+			path:               "/events/9.ics",
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "Tag feed",
+			path:               "/tags/Slam/events.ics",
+			expectedStatusCode: 200,
+			expected:           []string{"X-WR-CALNAME:Onde Hoje · slam", "UID:event-2@ondehoje"},
+			unexpected:         []string{"UID:event-1@ondehoje"},
+		},
+		{
+			name:               "Venue feed",
+			path:               "/venues/1/events.ics",
+			expectedStatusCode: 200,
+			expected:           []string{"X-WR-CALNAME:Onde Hoje · Trackers", "UID:event-1@ondehoje"},
+			unexpected:         []string{"UID:event-2@ondehoje"},
+		},
+		{
+			name:               "Missing venue feed",
+			path:               "/venues/9/events.ics",
+			expectedStatusCode: 404,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest("GET", tc.path, nil))
+			assert.Equal(t, tc.expectedStatusCode, w.Code)
+			if tc.expectedStatusCode != 200 {
+				return
+			}
+			assert.Equal(t, "text/calendar; charset=utf-8", w.Header().Get("Content-Type"))
+			for _, s := range tc.expected {
+				assert.Contains(t, w.Body.String(), s)
+			}
+			for _, s := range tc.unexpected {
+				assert.NotContains(t, w.Body.String(), s)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+)
+
+// The API keys are created with cmd/apikey, the admins list and revoke them.
+const (
+	keyPath   = "/keys"
+	keyPathId = "/keys/{id:[0-9]+}"
+)
+
+func getAllKeysHandler(keys auth.KeyRepository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getAllKeysHandler")
+		if !authorize(w, r, auth.ActionAdminister, "") {
+			return
+		}
+		all, err := keys.All(r.Context(), log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving keys")
+			writeError(w, r, err)
+			return
+		}
+		keysJson, err := json.Marshal(all)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling keys")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling keys")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(keysJson)
+		log.Info().Msg("Keys retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func revokeKeyHandler(keys auth.KeyRepository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("revokeKeyHandler")
+		if !authorize(w, r, auth.ActionAdminister, "") {
+			return
+		}
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		if err := keys.Revoke(r.Context(), id, log); err != nil {
+			log.Err(err).Msg("Error revoking key")
+			writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		log.Info().Msg("Key revoked successfully")
+	}
+	return http.HandlerFunc(fn)
+}
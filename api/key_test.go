@@ -0,0 +1,54 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_keys(t *testing.T) {
+	keys := auth.KeyMemoryRepository()
+	admin, _, err := keys.Create(context.Background(), "admin", auth.RoleAdmin, zerolog.Nop())
+	require.NoError(t, err)
+	curator, _, err := keys.Create(context.Background(), "curator", auth.RoleCurator, zerolog.Nop())
+	require.NoError(t, err)
+	bot, _, err := keys.Create(context.Background(), "agenda-bot", auth.RolePromoter, zerolog.Nop())
+	require.NoError(t, err)
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC, Authenticator: &auth.Authenticator{Keys: keys}})
+	do := func(key, method, path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, nil)
+		if key != "" {
+			r.Header.Set(auth.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	assert.Equal(t, 401, do("", "GET", "/keys").Code)
+	assert.Equal(t, 403, do(curator, "GET", "/keys").Code)
+	w := do(admin, "GET", "/keys")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var listed []auth.APIKey
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+	require.Len(t, listed, 3)
+	assert.Equal(t, "agenda-bot", listed[2].Name)
+	assert.NotContains(t, w.Body.String(), bot, "only the hint of the keys")
+
+	assert.Equal(t, 403, do(curator, "DELETE", "/keys/3").Code)
+	assert.Equal(t, 200, do(bot, "GET", "/events").Code)
+	assert.Equal(t, 204, do(admin, "DELETE", "/keys/3").Code)
+	assert.Equal(t, 401, do(bot, "GET", "/events").Code, "revoked")
+	assert.Equal(t, 404, do(admin, "DELETE", "/keys/3").Code, "already revoked")
+	assert.Equal(t, 404, do(admin, "DELETE", "/keys/9").Code)
+}
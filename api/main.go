@@ -2,14 +2,23 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/go-chi/httplog"
 	"github.com/go-openapi/runtime/middleware"
 	"github.com/gorilla/mux"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/perebaj/ondehj/auth"
 	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/user"
+	"github.com/perebaj/ondehj/venue"
 )
 
 const (
@@ -23,31 +32,40 @@ func deleteEventHandler(eventRepo event.Repository) http.HandlerFunc {
 		log.Info().Msg("Calling deleteEventHandler")
 		if r.Method != http.MethodDelete {
 			log.Error().Msg("Method not allowed")
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 		idStr := mux.Vars(r)["id"]
 		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil {
 			log.Err(err).Msgf("Invalid id: %s", idStr)
-			http.Error(w, "Invalid id", http.StatusBadRequest)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		if !authorizeEvent(w, r, eventRepo, id, auth.ActionEdit) {
 			return
 		}
 
 		log.Info().Msgf("Getting event with id: %d", id)
 		_, err = eventRepo.GetByID(r.Context(), id, log)
 		if err != nil {
-			log.Err(err).Msg("Event doesn't exist")
-			http.Error(w, "Event doesn't exist", http.StatusNotFound)
+			log.Err(err).Msg("Error retrieving event")
+			writeError(w, r, err)
 			return
 		}
 
-		log.Info().Msgf("Deleting event with id: %d", id)
-		err = eventRepo.Delete(r.Context(), id, log)
+		version, ok := ifMatchVersion(r, eventRepo, id)
+		if !ok {
+			log.Error().Msg("If-Match can't match any version")
+			writeProblem(w, r, http.StatusPreconditionFailed, `If-Match must list strong ETags of the current version, such as "3"`)
+			return
+		}
 
+		log.Info().Msgf("Deleting event with id: %d", id)
+		err = eventRepo.Delete(r.Context(), id, version, log)
 		if err != nil {
 			log.Err(err).Msg("Delete failed")
-			http.Error(w, "Delete failed", http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 		log.Info().Msg("Event deleted successfully")
@@ -62,7 +80,7 @@ func postCreateEventHandler(eventRepo event.Repository) http.HandlerFunc {
 
 		if r.Method != http.MethodPost {
 			log.Error().Msg("Method not allowed")
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 		// Decode the request body into a Event struct
@@ -70,31 +88,35 @@ func postCreateEventHandler(eventRepo event.Repository) http.HandlerFunc {
 		err := json.NewDecoder(r.Body).Decode(&requestEvent)
 		if err != nil {
 			log.Err(err).Msg("Error decoding event")
-			w.WriteHeader(http.StatusBadRequest)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
 			return
 		}
 		// Validate the request body
-		if requestEvent == (event.Event{}) || requestEvent.Title == "" {
-			// If event is empty or title is empty, return an error
-			log.Error().Msg("Invalid Event")
-			w.WriteHeader(http.StatusBadRequest)
+		var verr *event.ValidationError
+		if errors.As(requestEvent.ValidateNew(), &verr) {
+			log.Err(verr).Msg("Invalid Event")
+			writeError(w, r, verr)
 			return
 		}
 
+		if !authorize(w, r, auth.ActionCreate, "") {
+			return
+		}
 		log.Info().Msg("Creating event")
 		createdEvent, err := eventRepo.Create(r.Context(), requestEvent, log)
 		if err != nil {
 			log.Err(err).Msg("Error creating new Event")
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 		eventJson, err := json.Marshal(createdEvent)
 		if err != nil {
 			log.Err(err).Msg("Error marshalling events")
-			http.Error(w, "Error marshalling events", http.StatusInternalServerError)
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(createdEvent))
 		w.Write(eventJson)
 		log.Info().Msg("Event created successfully")
 
@@ -102,28 +124,224 @@ func postCreateEventHandler(eventRepo event.Repository) http.HandlerFunc {
 	return http.HandlerFunc(fn)
 }
 
-func getAllEventsHandler(eventRepo event.Repository) http.HandlerFunc {
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+	defaultRadiusKm = 5
+	maxRadiusKm     = 100
+	maxQueryLength  = 200
+)
+
+// timeNow is the clock used to resolve relative dates, replaced in tests.
+var timeNow = time.Now
+
+// parseFilter builds an event.Filter from the query string of a listing request.
+// Relative dates and date-only values are resolved in the city timezone loc.
+func parseFilter(values url.Values, loc *time.Location) (event.Filter, error) {
+	var filter event.Filter
+	date := values.Get("date")
+	from, to := values.Get("from"), values.Get("to")
+	if date != "" && (from != "" || to != "") {
+		return filter, errors.New("date can't be combined with from/to")
+	}
+	now := timeNow()
+	switch date {
+	case "":
+	case "today":
+		filter = event.Today(now, loc)
+	case "tomorrow":
+		filter = event.Tomorrow(now, loc)
+	case "weekend":
+		filter = event.Weekend(now, loc)
+	case "now":
+		filter = event.HappeningAt(now)
+	default:
+		return filter, fmt.Errorf("invalid date %q, expected today, tomorrow, weekend or now", date)
+	}
+	filter.Location = loc
+	var err error
+	filter.Near, err = parseNear(values)
+	if err != nil {
+		return filter, err
+	}
+	filter.Query = strings.TrimSpace(values.Get("q"))
+	if utf8.RuneCountInString(filter.Query) > maxQueryLength {
+		return filter, fmt.Errorf("q must be at most %d characters long", maxQueryLength)
+	}
+	if venueID := values.Get("venue_id"); venueID != "" {
+		filter.VenueID, err = strconv.ParseInt(venueID, 10, 64)
+		if err != nil || filter.VenueID < 1 {
+			return filter, fmt.Errorf("invalid venue_id %q", venueID)
+		}
+	}
+	filter.Tags, filter.AllTags, err = parseTags(values)
+	if err != nil {
+		return filter, err
+	}
+	filter.Statuses, err = parseStatuses(values)
+	if err != nil {
+		return filter, err
+	}
+	err = parsePagination(values, &filter)
+	if err != nil {
+		return filter, err
+	}
+	if from != "" {
+		filter.From, err = parseTime(from, loc, false)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from: %w", err)
+		}
+	}
+	if to != "" {
+		filter.To, err = parseTime(to, loc, true)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to: %w", err)
+		}
+	}
+	if updatedSince := values.Get("updated_since"); updatedSince != "" {
+		filter.UpdatedSince, err = parseTime(updatedSince, loc, false)
+		if err != nil {
+			return filter, fmt.Errorf("invalid updated_since: %w", err)
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && filter.To.Before(filter.From) {
+		return filter, errors.New("to must not be before from")
+	}
+	return filter, nil
+}
+
+// parsePagination reads the limit, sort and cursor parameters into filter.
+func parsePagination(values url.Values, filter *event.Filter) error {
+	var err error
+	filter.Limit = defaultPageSize
+	if limit := values.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxPageSize {
+			return fmt.Errorf("invalid limit %q, expected a number between 1 and %d", limit, maxPageSize)
+		}
+	}
+	filter.Sort, err = event.ParseSort(values.Get("sort"))
+	if err != nil {
+		return err
+	}
+	if values.Get("sort") == "" {
+		switch {
+		case filter.Query != "":
+			filter.Sort = event.SortRelevance
+		case filter.Near != nil:
+			filter.Sort = event.SortDistance
+		}
+	}
+	if filter.Sort == event.SortDistance && filter.Near == nil {
+		return errors.New("sort=distance needs lat and lng")
+	}
+	if filter.Sort == event.SortRelevance && filter.Query == "" {
+		return errors.New("sort=relevance needs q")
+	}
+	if cursor := values.Get("cursor"); cursor != "" {
+		filter.Cursor, err = event.DecodeCursor(cursor)
+		if err != nil {
+			return err
+		}
+		if filter.Cursor.Sort != filter.Sort {
+			return errors.New("cursor doesn't match the sort order")
+		}
+	}
+	return nil
+}
+
+// parseNear reads the lat, lng and radius_km parameters, it returns nil when
+// the listing isn't around a position.
+func parseNear(values url.Values) (*event.Near, error) {
+	lat, lng, radius := values.Get("lat"), values.Get("lng"), values.Get("radius_km")
+	if lat == "" && lng == "" {
+		if radius != "" {
+			return nil, errors.New("radius_km needs lat and lng")
+		}
+		return nil, nil
+	}
+	if lat == "" || lng == "" {
+		return nil, errors.New("lat and lng go together")
+	}
+	near := event.Near{RadiusKm: defaultRadiusKm}
+	var err error
+	near.Latitude, err = strconv.ParseFloat(lat, 64)
+	if err != nil || !(near.Latitude >= -90 && near.Latitude <= 90) {
+		return nil, fmt.Errorf("invalid lat %q, expected a number between -90 and 90", lat)
+	}
+	near.Longitude, err = strconv.ParseFloat(lng, 64)
+	if err != nil || !(near.Longitude >= -180 && near.Longitude <= 180) {
+		return nil, fmt.Errorf("invalid lng %q, expected a number between -180 and 180", lng)
+	}
+	if radius != "" {
+		near.RadiusKm, err = strconv.ParseFloat(radius, 64)
+		if err != nil || !(near.RadiusKm > 0 && near.RadiusKm <= maxRadiusKm) {
+			return nil, fmt.Errorf("invalid radius_km %q, expected a number above 0 and up to %d", radius, maxRadiusKm)
+		}
+	}
+	return &near, nil
+}
+
+// nextPageLink returns the Link header value pointing to the page after cursor.
+func nextPageLink(r *http.Request, cursor *event.Cursor) string {
+	values := r.URL.Query()
+	values.Set("cursor", cursor.Encode())
+	next := url.URL{Path: r.URL.Path, RawQuery: values.Encode()}
+	return fmt.Sprintf(`<%s>; rel="next"`, next.String())
+}
+
+// parseTime accepts either a RFC 3339 timestamp or a plain date (2006-01-02).
+// A plain date means the start of that day in loc, or the end of it when endOfDay is set.
+func parseTime(value string, loc *time.Location, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a RFC 3339 timestamp nor a date", value)
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
+func getAllEventsHandler(eventRepo event.Repository, loc *time.Location) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		log := httplog.LogEntry(r.Context())
 		log.Info().Msg("getAllEventsHandler")
 		if r.Method != http.MethodGet {
 			log.Error().Msg("Method not allowed")
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		filter, err := parseFilter(r.URL.Query(), loc)
+		if err != nil {
+			log.Err(err).Msg("Invalid filter")
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !authorizeStatuses(w, r, filter.Statuses) {
 			return
 		}
-		events, err := eventRepo.All(r.Context(), log)
+		page, err := eventRepo.List(r.Context(), filter, log)
 		if err != nil {
 			log.Err(err).Msg("Error retrieving events")
-			log.Error().AnErr("error", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
-		eventJson, err := json.Marshal(events)
+		for i := range page.Events {
+			redactOwner(r, &page.Events[i])
+		}
+		eventJson, err := json.Marshal(page.Events)
 		if err != nil {
 			log.Err(err).Msg("Error marshalling events")
-			http.Error(w, "Error marshalling events", http.StatusInternalServerError)
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
 			return
 		}
+		if page.Next != nil {
+			w.Header().Set("Link", nextPageLink(r, page.Next))
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.Write(eventJson)
 		log.Info().Msg("Events retrieved successfully")
@@ -137,27 +355,40 @@ func getByIDHandler(eventRepo event.Repository) http.HandlerFunc {
 		log.Info().Msg("getByIDHandler")
 		if r.Method != http.MethodGet {
 			log.Error().Msg("Method not allowed")
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 		idStr := mux.Vars(r)["id"]
 		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil {
 			log.Err(err).Msgf("Invalid id: %s", idStr)
-			http.Error(w, "Invalid id", http.StatusBadRequest)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
 			return
 		}
 
-		event, err := eventRepo.GetByID(r.Context(), id, log)
+		e, err := eventRepo.GetByID(r.Context(), id, log)
 		if err != nil {
-			log.Err(err).Msg("Event not found")
-			http.Error(w, "Event not found", http.StatusNotFound)
+			log.Err(err).Msg("Error retrieving event")
+			writeError(w, r, err)
+			return
+		}
+		if !canSee(r, *e) {
+			log.Error().Msgf("Event is %s, hidden from the caller", e.Status)
+			writeError(w, r, event.ErrNotFound)
 			return
 		}
-		eventJson, err := json.Marshal(event)
+		tag := etag(e)
+		w.Header().Set("ETag", tag)
+		if ifNoneMatch(r, tag) {
+			log.Info().Msg("Event not modified")
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		redactOwner(r, e)
+		eventJson, err := json.Marshal(e)
 		if err != nil {
 			log.Err(err).Msg("Error marshalling events")
-			http.Error(w, "Error marshalling events", http.StatusInternalServerError)
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -173,50 +404,141 @@ func Update(eventRepo event.Repository) http.HandlerFunc {
 		log.Info().Msg("Update")
 		if r.Method != http.MethodPut {
 			log.Error().Msg("Method not allowed")
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
 			return
 		}
 		var newEvent event.Event
 		err := json.NewDecoder(r.Body).Decode(&newEvent)
 		if err != nil {
 			log.Err(err).Msg("Error decoding event")
-			w.WriteHeader(http.StatusBadRequest)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
 			return
 		}
 		idStr := mux.Vars(r)["id"]
 		id, err := strconv.ParseInt(idStr, 10, 64)
 		if err != nil {
 			log.Err(err).Msgf("Invalid id: %s", idStr)
-			http.Error(w, "Invalid id", http.StatusBadRequest)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
 			return
 		}
 
-		_, err = eventRepo.GetByID(r.Context(), id, log)
-		if err != nil {
-			log.Err(err).Msg("Event not found")
-			http.Error(w, "Event not found", http.StatusNotFound)
+		var verr *event.ValidationError
+		if errors.As(newEvent.Validate(), &verr) {
+			log.Err(verr).Msg("Invalid Event")
+			writeError(w, r, verr)
 			return
 		}
+		version, ok := ifMatchVersion(r, eventRepo, id)
+		if !ok {
+			log.Error().Msg("If-Match can't match any version")
+			writeProblem(w, r, http.StatusPreconditionFailed, `If-Match must list strong ETags of the current version, such as "3"`)
+			return
+		}
+		// the version comes from If-Match only, never from the body
+		newEvent.Version = version
+		if !authorizeEvent(w, r, eventRepo, id, auth.ActionEdit) {
+			return
+		}
+
 		updatedEvent, err := eventRepo.Update(r.Context(), id, newEvent, log)
 		if err != nil {
 			log.Err(err).Msg("Update failed")
-			http.Error(w, "Update failed", http.StatusInternalServerError)
+			writeError(w, r, err)
 			return
 		}
 		updatedEventJson, err := json.Marshal(updatedEvent)
 		if err != nil {
 			log.Err(err).Msg("Error marshalling events")
-			http.Error(w, "Error marshalling events", http.StatusInternalServerError)
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(updatedEvent))
 		w.Write(updatedEventJson)
 		log.Info().Msg("Event updated successfully")
 	}
 	return http.HandlerFunc(fn)
 }
 
-func HandlerFactory(db *pgxpool.Pool) http.Handler {
+const mergePatchContentType = "application/merge-patch+json"
+
+func patchEventHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("patchEventHandler")
+		if r.Method != http.MethodPatch {
+			log.Error().Msg("Method not allowed")
+			writeProblem(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != mergePatchContentType {
+			log.Error().Msgf("Unsupported content type: %s", r.Header.Get("Content-Type"))
+			w.Header().Set("Accept-Patch", mergePatchContentType)
+			writeProblem(w, r, http.StatusUnsupportedMediaType, "Unsupported media type, expected "+mergePatchContentType)
+			return
+		}
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		var patch event.Patch
+		err = json.NewDecoder(r.Body).Decode(&patch)
+		if err != nil {
+			log.Err(err).Msg("Error decoding patch")
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		version, ok := ifMatchVersion(r, eventRepo, id)
+		if !ok {
+			log.Error().Msg("If-Match can't match any version")
+			writeProblem(w, r, http.StatusPreconditionFailed, `If-Match must list strong ETags of the current version, such as "3"`)
+			return
+		}
+		patch.Version = version
+		if !authorizeEvent(w, r, eventRepo, id, auth.ActionEdit) {
+			return
+		}
+
+		patchedEvent, err := eventRepo.Patch(r.Context(), id, patch, log)
+		if err != nil {
+			log.Err(err).Msg("Patch failed")
+			writeError(w, r, err)
+			return
+		}
+		patchedEventJson, err := json.Marshal(patchedEvent)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling events")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(patchedEvent))
+		w.Write(patchedEventJson)
+		log.Info().Msg("Event patched successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// Config holds the settings HandlerFactory needs besides the database.
+type Config struct {
+	// Location is the city timezone used to resolve relative dates such as "today".
+	Location *time.Location
+	// TrashRetention is how long the deleted events can be restored before
+	// they're purged, 30 days when zero.
+	TrashRetention time.Duration
+	// Authenticator checks the credentials of the requests, the writes need
+	// some. Every request is allowed when it's nil, as in the tests.
+	Authenticator *auth.Authenticator
+	// Users signs the users up and in, the /users routes are only served when
+	// it's set. The /keys routes are served when the Authenticator has Keys.
+	Users *user.Service
+}
+
+func HandlerFactory(eventRepo event.Repository, venueRepo venue.Repository, cfg Config) http.Handler {
 	//Group all handler of the API and return a http.Handler
 	//structured logs
 	logger := httplog.NewLogger("http", httplog.Options{
@@ -225,16 +547,66 @@ func HandlerFactory(db *pgxpool.Pool) http.Handler {
 		Concise:  true,
 	})
 	httpLogMiddleware := httplog.RequestLogger(logger)
+	if cfg.TrashRetention == 0 {
+		cfg.TrashRetention = defaultTrashRetention
+	}
 	router := mux.NewRouter()
-	eventSQLRepo := event.EventSQLRepository(db)
+	router.NotFoundHandler = http.HandlerFunc(notFoundHandler)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowedHandler)
 
 	//event
 	router.Use(httpLogMiddleware)
-	router.HandleFunc(eventPath, getAllEventsHandler(eventSQLRepo)).Methods(http.MethodGet)
-	router.HandleFunc(eventPath, postCreateEventHandler(eventSQLRepo)).Methods(http.MethodPost)
-	router.HandleFunc(eventPathId, deleteEventHandler(eventSQLRepo)).Methods(http.MethodDelete)
-	router.HandleFunc(eventPathId, getByIDHandler(eventSQLRepo)).Methods(http.MethodGet)
-	router.HandleFunc(eventPathId, Update(eventSQLRepo)).Methods(http.MethodPut)
+	if cfg.Authenticator != nil {
+		router.Use(authenticate(cfg.Authenticator))
+	}
+	router.HandleFunc(eventPath, getAllEventsHandler(eventRepo, cfg.Location)).Methods(http.MethodGet)
+	router.HandleFunc(eventBulkPath, postBulkEventsHandler(eventRepo, cfg.Location)).Methods(http.MethodPost)
+	router.HandleFunc(eventExportPath, getExportEventsHandler(eventRepo)).Methods(http.MethodGet)
+	router.HandleFunc(eventCalendarPath, getEventsCalendarHandler(eventRepo, cfg.Location)).Methods(http.MethodGet)
+	router.HandleFunc(eventCalendarPathId, getEventCalendarHandler(eventRepo, cfg.Location)).Methods(http.MethodGet)
+	router.HandleFunc(eventPath, postCreateEventHandler(eventRepo)).Methods(http.MethodPost)
+	router.HandleFunc(eventPublishPath, transitionHandler(eventRepo, event.StatusPublished)).Methods(http.MethodPost)
+	router.HandleFunc(eventCancelPath, transitionHandler(eventRepo, event.StatusCancelled)).Methods(http.MethodPost)
+	router.HandleFunc(eventPostponePath, transitionHandler(eventRepo, event.StatusPostponed)).Methods(http.MethodPost)
+	router.HandleFunc(eventTrashPath, getTrashHandler(eventRepo)).Methods(http.MethodGet)
+	router.HandleFunc(eventTrashPath, purgeTrashHandler(eventRepo, cfg.TrashRetention)).Methods(http.MethodDelete)
+	router.HandleFunc(eventRestorePath, restoreEventHandler(eventRepo)).Methods(http.MethodPost)
+	router.HandleFunc(eventRevertPath, revertEventHandler(eventRepo)).Methods(http.MethodPost)
+	router.HandleFunc(eventPathId, deleteEventHandler(eventRepo)).Methods(http.MethodDelete)
+	router.HandleFunc(eventPathId, getByIDHandler(eventRepo)).Methods(http.MethodGet)
+	router.HandleFunc(eventPathId, Update(eventRepo)).Methods(http.MethodPut)
+	router.HandleFunc(eventPathId, patchEventHandler(eventRepo)).Methods(http.MethodPatch)
+	router.HandleFunc(eventOccurrencePath, putOccurrenceHandler(eventRepo, cfg.Location)).Methods(http.MethodPut)
+	router.HandleFunc(eventOccurrencePath, deleteOccurrenceHandler(eventRepo)).Methods(http.MethodDelete)
+	router.HandleFunc(eventHistoryPath, getHistoryHandler(eventRepo)).Methods(http.MethodGet)
+	//venue
+	router.HandleFunc(venuePath, getAllVenuesHandler(venueRepo)).Methods(http.MethodGet)
+	router.HandleFunc(venuePath, postCreateVenueHandler(venueRepo)).Methods(http.MethodPost)
+	router.HandleFunc(venuePathId, getVenueByIDHandler(venueRepo)).Methods(http.MethodGet)
+	router.HandleFunc(venuePathId, updateVenueHandler(venueRepo)).Methods(http.MethodPut)
+	router.HandleFunc(venuePathId, deleteVenueHandler(venueRepo)).Methods(http.MethodDelete)
+	router.HandleFunc(venueCalendarPath, getVenueCalendarHandler(eventRepo, venueRepo, cfg.Location)).Methods(http.MethodGet)
+	//tag
+	router.HandleFunc(tagPath, getAllTagsHandler(eventRepo)).Methods(http.MethodGet)
+	router.HandleFunc(tagCalendarPath, getTagCalendarHandler(eventRepo, cfg.Location)).Methods(http.MethodGet)
+	//user
+	if cfg.Users != nil {
+		router.HandleFunc(userSignupPath, signupHandler(cfg.Users)).Methods(http.MethodPost)
+		router.HandleFunc(userVerifyEmailPath, verifyEmailHandler(cfg.Users)).Methods(http.MethodPost)
+		router.HandleFunc(userResendVerificationPath, resendVerificationHandler(cfg.Users)).Methods(http.MethodPost)
+		router.HandleFunc(userLoginPath, loginHandler(cfg.Users)).Methods(http.MethodPost)
+		router.HandleFunc(userForgotPasswordPath, forgotPasswordHandler(cfg.Users)).Methods(http.MethodPost)
+		router.HandleFunc(userResetPasswordPath, resetPasswordHandler(cfg.Users)).Methods(http.MethodPost)
+		router.HandleFunc(usersPath, getAllUsersHandler(cfg.Users)).Methods(http.MethodGet)
+		router.HandleFunc(userDisablePath, setDisabledHandler(cfg.Users, true)).Methods(http.MethodPost)
+		router.HandleFunc(userEnablePath, setDisabledHandler(cfg.Users, false)).Methods(http.MethodPost)
+		router.HandleFunc(userSetRolePath, setRoleHandler(cfg.Users)).Methods(http.MethodPost)
+	}
+	//key
+	if cfg.Authenticator != nil && cfg.Authenticator.Keys != nil {
+		router.HandleFunc(keyPath, getAllKeysHandler(cfg.Authenticator.Keys)).Methods(http.MethodGet)
+		router.HandleFunc(keyPathId, revokeKeyHandler(cfg.Authenticator.Keys)).Methods(http.MethodDelete)
+	}
 	// documentation for developers
 	opts := middleware.SwaggerUIOpts{SpecURL: "openapi.yaml"}
 	sh := middleware.SwaggerUI(opts, nil)
@@ -2,16 +2,19 @@ package api
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/gorilla/mux"
 	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -35,34 +38,118 @@ func (m *MockSQLRepository) Update(ctx context.Context, id int64, newEvent event
 	return args.Get(0).(*event.Event), args.Error(1)
 }
 
+func (m *MockSQLRepository) Patch(ctx context.Context, id int64, patch event.Patch, log zerolog.Logger) (*event.Event, error) {
+	args := m.Called(ctx, id, patch)
+	return args.Get(0).(*event.Event), args.Error(1)
+}
+
 func (m *MockSQLRepository) GetByID(ctx context.Context, id int64, log zerolog.Logger) (*event.Event, error) {
 	args := m.Called(ctx, id)
 	return args.Get(0).(*event.Event), args.Error(1)
 
 }
 
-func (m *MockSQLRepository) Delete(ctx context.Context, id int64, log zerolog.Logger) error {
-	args := m.Called(ctx, id)
+func (m *MockSQLRepository) Delete(ctx context.Context, id int64, version int64, log zerolog.Logger) error {
+	args := m.Called(ctx, id, version)
 	return args.Error(0)
 }
 
-func (m *MockSQLRepository) Migrate() error {
-	args := m.Called()
+func (m *MockSQLRepository) All(ctx context.Context, log zerolog.Logger) ([]event.Event, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]event.Event), args.Error(1)
+}
+
+func (m *MockSQLRepository) List(ctx context.Context, filter event.Filter, log zerolog.Logger) (*event.Page, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).(*event.Page), args.Error(1)
+}
+
+func (m *MockSQLRepository) TagCounts(ctx context.Context, since time.Time, log zerolog.Logger) ([]event.TagCount, error) {
+	args := m.Called(ctx, since)
+	return args.Get(0).([]event.TagCount), args.Error(1)
+}
+
+func (m *MockSQLRepository) Import(ctx context.Context, e event.Event, log zerolog.Logger) (*event.Event, event.ImportResult, error) {
+	args := m.Called(ctx, e)
+	return args.Get(0).(*event.Event), args.Get(1).(event.ImportResult), args.Error(2)
+}
+
+func (m *MockSQLRepository) CreateMany(ctx context.Context, events []event.Event, atomic bool, log zerolog.Logger) ([]event.BulkResult, error) {
+	args := m.Called(ctx, events, atomic)
+	return args.Get(0).([]event.BulkResult), args.Error(1)
+}
+
+func (m *MockSQLRepository) Each(ctx context.Context, log zerolog.Logger, fn func(event.Event) error) error {
+	args := m.Called(ctx, fn)
 	return args.Error(0)
 }
 
-func (m *MockSQLRepository) All(ctx context.Context, log zerolog.Logger) ([]event.Event, error) {
+func (m *MockSQLRepository) SetOverride(ctx context.Context, id int64, override event.Override, log zerolog.Logger) (*event.Event, error) {
+	args := m.Called(ctx, id, override)
+	return args.Get(0).(*event.Event), args.Error(1)
+}
+
+func (m *MockSQLRepository) DeleteOverride(ctx context.Context, id int64, occurrence time.Time, log zerolog.Logger) (*event.Event, error) {
+	args := m.Called(ctx, id, occurrence)
+	return args.Get(0).(*event.Event), args.Error(1)
+}
+
+func (m *MockSQLRepository) Transition(ctx context.Context, id int64, to event.Status, reason string, version int64, log zerolog.Logger) (*event.Event, error) {
+	args := m.Called(ctx, id, to, reason, version)
+	return args.Get(0).(*event.Event), args.Error(1)
+}
+
+func (m *MockSQLRepository) Trash(ctx context.Context, log zerolog.Logger) ([]event.Event, error) {
 	args := m.Called(ctx)
 	return args.Get(0).([]event.Event), args.Error(1)
 }
 
+func (m *MockSQLRepository) Restore(ctx context.Context, id int64, log zerolog.Logger) (*event.Event, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).(*event.Event), args.Error(1)
+}
+
+func (m *MockSQLRepository) Purge(ctx context.Context, before time.Time, log zerolog.Logger) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockSQLRepository) History(ctx context.Context, id int64, log zerolog.Logger) ([]event.Change, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]event.Change), args.Error(1)
+}
+
+func (m *MockSQLRepository) Revert(ctx context.Context, id int64, version int64, log zerolog.Logger) (*event.Event, error) {
+	args := m.Called(ctx, id, version)
+	return args.Get(0).(*event.Event), args.Error(1)
+}
+
+func (m *MockSQLRepository) Owner(ctx context.Context, id int64, log zerolog.Logger) (string, error) {
+	args := m.Called(ctx, id)
+	return args.String(0), args.Error(1)
+}
+
 type MockEvent interface {
 	Create(ctx context.Context, event event.Event, log zerolog.Logger) (*event.Event, error)
 	Update(ctx context.Context, id int64, newEvent event.Event, log zerolog.Logger) (*event.Event, error)
+	Patch(ctx context.Context, id int64, patch event.Patch, log zerolog.Logger) (*event.Event, error)
 	GetByID(ctx context.Context, id int64, log zerolog.Logger) (*event.Event, error)
-	Delete(ctx context.Context, id int64, log zerolog.Logger) error
-	Migrate() error
+	Delete(ctx context.Context, id int64, version int64, log zerolog.Logger) error
 	All(ctx context.Context, log zerolog.Logger) ([]event.Event, error)
+	List(ctx context.Context, filter event.Filter, log zerolog.Logger) (*event.Page, error)
+	TagCounts(ctx context.Context, since time.Time, log zerolog.Logger) ([]event.TagCount, error)
+	Import(ctx context.Context, e event.Event, log zerolog.Logger) (*event.Event, event.ImportResult, error)
+	CreateMany(ctx context.Context, events []event.Event, atomic bool, log zerolog.Logger) ([]event.BulkResult, error)
+	Each(ctx context.Context, log zerolog.Logger, fn func(event.Event) error) error
+	SetOverride(ctx context.Context, id int64, override event.Override, log zerolog.Logger) (*event.Event, error)
+	DeleteOverride(ctx context.Context, id int64, occurrence time.Time, log zerolog.Logger) (*event.Event, error)
+	Transition(ctx context.Context, id int64, to event.Status, reason string, version int64, log zerolog.Logger) (*event.Event, error)
+	Trash(ctx context.Context, log zerolog.Logger) ([]event.Event, error)
+	Restore(ctx context.Context, id int64, log zerolog.Logger) (*event.Event, error)
+	Purge(ctx context.Context, before time.Time, log zerolog.Logger) (int64, error)
+	History(ctx context.Context, id int64, log zerolog.Logger) ([]event.Change, error)
+	Revert(ctx context.Context, id int64, version int64, log zerolog.Logger) (*event.Event, error)
+	Owner(ctx context.Context, id int64, log zerolog.Logger) (string, error)
 }
 
 func Test_postCreateEventHandler(t *testing.T) {
@@ -101,13 +188,13 @@ func Test_postCreateEventHandler(t *testing.T) {
 		{
 			name:               "Empty event",
 			event:              nil,
-			expectedStatusCode: 400,
+			expectedStatusCode: 422,
 			method:             "POST",
 		},
 		{
 			name:               "Empty event2",
 			event:              &event.Event{},
-			expectedStatusCode: 400,
+			expectedStatusCode: 422,
 			method:             "POST",
 		},
 		{
@@ -120,7 +207,7 @@ func Test_postCreateEventHandler(t *testing.T) {
 				EndTime:       time.Now(),
 				InstagramPage: "jojo",
 			},
-			expectedStatusCode: 400,
+			expectedStatusCode: 422,
 			method:             "POST",
 		},
 	}
@@ -147,6 +234,89 @@ func Test_postCreateEventHandler(t *testing.T) {
 	}
 }
 
+func Test_postCreateEventHandlerValidation(t *testing.T) {
+	start := time.Date(2023, time.May, 13, 23, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		name           string
+		event          event.Event
+		expectedFields []string
+	}{
+		{
+			name: "End before start",
+			event: event.Event{
+				Title:     "Jojo",
+				StartTime: start,
+				EndTime:   start.Add(-time.Hour),
+			},
+			expectedFields: []string{"end_time"},
+		},
+		{
+			name: "Epoch timestamps",
+			event: event.Event{
+				Title:     "Jojo",
+				StartTime: time.Unix(0, 0),
+				EndTime:   time.Unix(0, 0),
+			},
+			expectedFields: []string{"start_time", "end_time"},
+		},
+		{
+			name: "Too long title and malformed instagram",
+			event: event.Event{
+				Title:         strings.Repeat("jojo ", 100),
+				StartTime:     start,
+				EndTime:       start.Add(time.Hour),
+				InstagramPage: "https://instagram.com/jojo",
+			},
+			expectedFields: []string{"title", "instagram_page"},
+		},
+		{
+			name: "Malformed tags",
+			event: event.Event{
+				Title:     "Jojo",
+				StartTime: start,
+				EndTime:   start.Add(time.Hour),
+				Tags:      []string{"techno", "drum&bass", strings.Repeat("a", 31)},
+			},
+			expectedFields: []string{"tags", "tags"},
+		},
+		{
+			name:           "Missing everything",
+			event:          event.Event{Description: "Jojo mage"},
+			expectedFields: []string{"title", "start_time", "end_time"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			body, err := json.Marshal(tc.event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mockRepo := NewMockSQLRepository()
+			req := httptest.NewRequest("POST", "/events", strings.NewReader(string(body)))
+			w := httptest.NewRecorder()
+			postCreateEventHandler(mockRepo).ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, 422, res.StatusCode)
+			assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+
+			var p struct {
+				Status int                `json:"status"`
+				Errors []event.FieldError `json:"errors"`
+			}
+			err = json.NewDecoder(res.Body).Decode(&p)
+			assert.NoError(t, err)
+			assert.Equal(t, 422, p.Status)
+			var fields []string
+			for _, f := range p.Errors {
+				fields = append(fields, f.Field)
+				assert.NotEmpty(t, f.Reason)
+			}
+			assert.Equal(t, tc.expectedFields, fields)
+			mockRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		})
+	}
+}
+
 func Test_deleteEventHandler(t *testing.T) {
 	type deleteReturn struct {
 		err error // error to be returned by the mock repo when Delete is called
@@ -162,6 +332,7 @@ func Test_deleteEventHandler(t *testing.T) {
 		expectedStatusCode int
 		method             string
 		requestIdParam     string
+		ifMatch            string
 		deleteError        error
 	}{
 		{
@@ -217,13 +388,43 @@ func Test_deleteEventHandler(t *testing.T) {
 			requestIdParam:     "2",
 			expectedStatusCode: 404,
 			getByIdReturn: getByIdReturn{
-				err:   sql.ErrNoRows,
+				err:   event.ErrNotFound,
 				event: nil,
 			},
 			deleteReturn: deleteReturn{
 				err: nil,
 			},
 		},
+		{
+			name:               "Event already deleted",
+			method:             "DELETE",
+			requestIdParam:     "2",
+			expectedStatusCode: 410,
+			getByIdReturn: getByIdReturn{
+				err:   event.ErrGone,
+				event: nil,
+			},
+		},
+		{
+			name:               "Database unavailable",
+			method:             "DELETE",
+			requestIdParam:     "2",
+			expectedStatusCode: 503,
+			getByIdReturn: getByIdReturn{
+				err:   fmt.Errorf("%w: dial tcp 127.0.0.1:5432: connect: connection refused", event.ErrUnavailable),
+				event: nil,
+			},
+		},
+		{
+			name:               "Database failure",
+			method:             "DELETE",
+			requestIdParam:     "2",
+			expectedStatusCode: 500,
+			getByIdReturn: getByIdReturn{
+				err:   errors.New("ERROR: relation \"events\" does not exist (SQLSTATE 42P01)"),
+				event: nil,
+			},
+		},
 		{
 			name: "Delete failed",
 
@@ -248,18 +449,60 @@ func Test_deleteEventHandler(t *testing.T) {
 			expectedStatusCode: 500,
 			deleteError:        event.ErrDeleteFailed,
 		},
+		{
+			name: "Purged before the delete",
+			deleteReturn: deleteReturn{
+				err: event.ErrNotFound,
+			},
+			getByIdReturn: getByIdReturn{
+				err:   nil,
+				event: &event.Event{ID: 2, Version: 3},
+			},
+			method:             "DELETE",
+			requestIdParam:     "2",
+			expectedStatusCode: 404,
+			deleteError:        event.ErrNotFound,
+		},
+		{
+			name: "Outdated If-Match",
+			deleteReturn: deleteReturn{
+				err: event.ErrVersionMismatch,
+			},
+			getByIdReturn: getByIdReturn{
+				err:   nil,
+				event: &event.Event{ID: 2, Version: 3},
+			},
+			method:             "DELETE",
+			requestIdParam:     "2",
+			ifMatch:            `"2"`,
+			expectedStatusCode: 412,
+		},
+		{
+			name: "Weak If-Match",
+			getByIdReturn: getByIdReturn{
+				err:   nil,
+				event: &event.Event{ID: 2, Version: 3},
+			},
+			method:             "DELETE",
+			requestIdParam:     "2",
+			ifMatch:            `W/"3"`,
+			expectedStatusCode: 412,
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			mockRepo := NewMockSQLRepository()
 			mockRepo.On("GetByID", mock.Anything, mock.Anything).Return(tc.getByIdReturn.event, tc.getByIdReturn.err)
-			mockRepo.On("Delete", mock.Anything, mock.Anything).Return(tc.deleteReturn.err)
+			mockRepo.On("Delete", mock.Anything, mock.Anything, mock.Anything).Return(tc.deleteReturn.err)
 
 			resultHandlerFunc := deleteEventHandler(mockRepo)
 			fmt.Printf("/events/%s", tc.requestIdParam)
 
 			req := httptest.NewRequest(tc.method, "/event/"+tc.requestIdParam, nil)
 			req = mux.SetURLVars(req, map[string]string{"id": tc.requestIdParam})
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
 			w := httptest.NewRecorder()
 			resultHandlerFunc.ServeHTTP(w, req) // doing the fake request
 			res := w.Result()                   // capturing the response
@@ -268,3 +511,866 @@ func Test_deleteEventHandler(t *testing.T) {
 	}
 
 }
+
+func Test_getAllEventsHandler(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wednesday, 21:30 in São Paulo
+	now := time.Date(2023, time.May, 10, 21, 30, 0, 0, saoPaulo)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	testCases := []struct {
+		name               string
+		query              string
+		expectedFilter     event.Filter
+		expectedStatusCode int
+	}{
+		{
+			name:               "No filter",
+			query:              "",
+			expectedFilter:     event.Filter{},
+			expectedStatusCode: 200,
+		},
+		{
+			name:  "Today",
+			query: "?date=today",
+			expectedFilter: event.Filter{
+				From: time.Date(2023, time.May, 10, 0, 0, 0, 0, saoPaulo),
+				To:   time.Date(2023, time.May, 11, 0, 0, 0, 0, saoPaulo),
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:  "Tomorrow",
+			query: "?date=tomorrow",
+			expectedFilter: event.Filter{
+				From: time.Date(2023, time.May, 11, 0, 0, 0, 0, saoPaulo),
+				To:   time.Date(2023, time.May, 12, 0, 0, 0, 0, saoPaulo),
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:  "Weekend",
+			query: "?date=weekend",
+			expectedFilter: event.Filter{
+				From: time.Date(2023, time.May, 12, 18, 0, 0, 0, saoPaulo),
+				To:   time.Date(2023, time.May, 15, 0, 0, 0, 0, saoPaulo),
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Happening now",
+			query:              "?date=now",
+			expectedFilter:     event.Filter{From: now, To: now},
+			expectedStatusCode: 200,
+		},
+		{
+			name:  "From and to dates",
+			query: "?from=2023-05-01&to=2023-05-02",
+			expectedFilter: event.Filter{
+				From: time.Date(2023, time.May, 1, 0, 0, 0, 0, saoPaulo),
+				To:   time.Date(2023, time.May, 3, 0, 0, 0, 0, saoPaulo),
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:  "From timestamp",
+			query: "?from=2023-05-01T22:00:00Z",
+			expectedFilter: event.Filter{
+				From: time.Date(2023, time.May, 1, 22, 0, 0, 0, time.UTC),
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:  "Updated since",
+			query: "?updated_since=2023-05-01T12:00:00Z",
+			expectedFilter: event.Filter{
+				UpdatedSince: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC),
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Invalid updated since",
+			query:              "?updated_since=last-week",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Invalid date",
+			query:              "?date=yesterday",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Date combined with from",
+			query:              "?date=today&from=2023-05-01",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "To before from",
+			query:              "?from=2023-05-03&to=2023-05-01",
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := NewMockSQLRepository()
+			mockRepo.On("List", mock.Anything, mock.Anything).Return(&event.Page{Events: []event.Event{}}, nil)
+
+			resultHandlerFunc := getAllEventsHandler(mockRepo, saoPaulo)
+			req := httptest.NewRequest("GET", "/events"+tc.query, nil)
+			w := httptest.NewRecorder()
+			resultHandlerFunc.ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			if tc.expectedStatusCode != 200 {
+				mockRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+				return
+			}
+			filter := mockRepo.Calls[0].Arguments.Get(1).(event.Filter)
+			assert.True(t, tc.expectedFilter.From.Equal(filter.From), "from: expected %v, got %v", tc.expectedFilter.From, filter.From)
+			assert.True(t, tc.expectedFilter.To.Equal(filter.To), "to: expected %v, got %v", tc.expectedFilter.To, filter.To)
+			assert.True(t, tc.expectedFilter.UpdatedSince.Equal(filter.UpdatedSince), "updated_since: expected %v, got %v", tc.expectedFilter.UpdatedSince, filter.UpdatedSince)
+		})
+	}
+}
+
+func Test_getAllEventsHandlerWeekend(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Wednesday, 21:30 in São Paulo
+	now := time.Date(2023, time.May, 10, 21, 30, 0, 0, saoPaulo)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: saoPaulo})
+	for _, body := range []string{
+		`{"title": "Friday afternoon", "start_time": "2023-05-12T14:00:00-03:00", "end_time": "2023-05-12T17:00:00-03:00"}`,
+		`{"title": "Friday night", "start_time": "2023-05-12T23:00:00-03:00", "end_time": "2023-05-13T05:00:00-03:00"}`,
+		`{"title": "Sunday", "start_time": "2023-05-14T16:00:00-03:00", "end_time": "2023-05-14T22:00:00-03:00"}`,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/events", strings.NewReader(body)))
+		assert.Equal(t, 200, w.Code, w.Body.String())
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/events?date=weekend", nil))
+	assert.Equal(t, 200, w.Code)
+	var listed []event.Event
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+	var titles []string
+	for _, e := range listed {
+		titles = append(titles, e.Title)
+	}
+	assert.Equal(t, []string{"Friday night", "Sunday"}, titles)
+}
+
+func Test_getAllEventsHandlerNear(t *testing.T) {
+	testCases := []struct {
+		name               string
+		query              string
+		expectedNear       *event.Near
+		expectedSort       event.Sort
+		expectedStatusCode int
+	}{
+		{
+			name:               "Near with the default radius, sorted by distance",
+			query:              "?lat=-23.5446&lng=-46.6406",
+			expectedNear:       &event.Near{Latitude: -23.5446, Longitude: -46.6406, RadiusKm: 5},
+			expectedSort:       event.SortDistance,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Near sorted by start time",
+			query:              "?lat=-23.5446&lng=-46.6406&radius_km=2.5&sort=start_time",
+			expectedNear:       &event.Near{Latitude: -23.5446, Longitude: -46.6406, RadiusKm: 2.5},
+			expectedSort:       event.SortStartTime,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Not near",
+			query:              "",
+			expectedSort:       event.SortStartTime,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Lat without lng",
+			query:              "?lat=-23.5446",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Radius without position",
+			query:              "?radius_km=3",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Invalid lat",
+			query:              "?lat=NaN&lng=-46.6406",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Lng out of range",
+			query:              "?lat=-23.5446&lng=-190",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Radius too large",
+			query:              "?lat=-23.5446&lng=-46.6406&radius_km=1000",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Sort by distance without position",
+			query:              "?sort=distance",
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := NewMockSQLRepository()
+			mockRepo.On("List", mock.Anything, mock.Anything).Return(&event.Page{Events: []event.Event{}}, nil)
+
+			req := httptest.NewRequest("GET", "/events"+tc.query, nil)
+			w := httptest.NewRecorder()
+			getAllEventsHandler(mockRepo, time.UTC).ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			if tc.expectedStatusCode != 200 {
+				mockRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+				return
+			}
+			filter := mockRepo.Calls[0].Arguments.Get(1).(event.Filter)
+			assert.Equal(t, tc.expectedNear, filter.Near)
+			assert.Equal(t, tc.expectedSort, filter.Sort)
+		})
+	}
+}
+
+func Test_getAllEventsHandlerSearch(t *testing.T) {
+	testCases := []struct {
+		name               string
+		query              string
+		expectedQuery      string
+		expectedSort       event.Sort
+		expectedStatusCode int
+	}{
+		{
+			name:               "Search sorted by relevance",
+			query:              "?q=+s%C3%A3o+paulo+",
+			expectedQuery:      "são paulo",
+			expectedSort:       event.SortRelevance,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Search around a position",
+			query:              "?q=jazz&lat=-23.5446&lng=-46.6406",
+			expectedQuery:      "jazz",
+			expectedSort:       event.SortRelevance,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Search sorted by start time",
+			query:              "?q=jazz&sort=start_time",
+			expectedQuery:      "jazz",
+			expectedSort:       event.SortStartTime,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Blank search",
+			query:              "?q=+",
+			expectedSort:       event.SortStartTime,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Sort by relevance without search",
+			query:              "?sort=relevance",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Search too long",
+			query:              "?q=" + strings.Repeat("a", 201),
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := NewMockSQLRepository()
+			mockRepo.On("List", mock.Anything, mock.Anything).Return(&event.Page{Events: []event.Event{}}, nil)
+
+			req := httptest.NewRequest("GET", "/events"+tc.query, nil)
+			w := httptest.NewRecorder()
+			getAllEventsHandler(mockRepo, time.UTC).ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			if tc.expectedStatusCode != 200 {
+				mockRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+				return
+			}
+			filter := mockRepo.Calls[0].Arguments.Get(1).(event.Filter)
+			assert.Equal(t, tc.expectedQuery, filter.Query)
+			assert.Equal(t, tc.expectedSort, filter.Sort)
+		})
+	}
+}
+
+func Test_getAllEventsHandlerPagination(t *testing.T) {
+	cursor := event.Cursor{Sort: event.SortStartTime, StartTime: time.Date(2023, time.May, 10, 22, 0, 0, 0, time.UTC), ID: 7}
+	testCases := []struct {
+		name               string
+		query              string
+		next               *event.Cursor
+		expectedLimit      int
+		expectedSort       event.Sort
+		expectedCursor     *event.Cursor
+		expectedLink       string
+		expectedStatusCode int
+	}{
+		{
+			name:               "Default page",
+			query:              "",
+			expectedLimit:      defaultPageSize,
+			expectedSort:       event.SortStartTime,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Page with a next page",
+			query:              "?limit=10&date=today",
+			next:               &cursor,
+			expectedLimit:      10,
+			expectedSort:       event.SortStartTime,
+			expectedLink:       `</events?cursor=` + cursor.Encode() + `&date=today&limit=10>; rel="next"`,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Following a cursor",
+			query:              "?cursor=" + cursor.Encode(),
+			expectedLimit:      defaultPageSize,
+			expectedSort:       event.SortStartTime,
+			expectedCursor:     &cursor,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Descending sort",
+			query:              "?sort=-start_time",
+			expectedLimit:      defaultPageSize,
+			expectedSort:       event.SortStartTimeDesc,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Cursor from another sort",
+			query:              "?sort=-start_time&cursor=" + cursor.Encode(),
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Invalid cursor",
+			query:              "?cursor=garbage",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Invalid sort",
+			query:              "?sort=title",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Limit too big",
+			query:              "?limit=1000",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Invalid limit",
+			query:              "?limit=ten",
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := NewMockSQLRepository()
+			mockRepo.On("List", mock.Anything, mock.Anything).Return(&event.Page{Events: []event.Event{}, Next: tc.next}, nil)
+
+			resultHandlerFunc := getAllEventsHandler(mockRepo, time.UTC)
+			req := httptest.NewRequest("GET", "/events"+tc.query, nil)
+			w := httptest.NewRecorder()
+			resultHandlerFunc.ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			if tc.expectedStatusCode != 200 {
+				return
+			}
+			filter := mockRepo.Calls[0].Arguments.Get(1).(event.Filter)
+			assert.Equal(t, tc.expectedLimit, filter.Limit)
+			assert.Equal(t, tc.expectedSort, filter.Sort)
+			if tc.expectedCursor == nil {
+				assert.Nil(t, filter.Cursor)
+			} else {
+				assert.Equal(t, tc.expectedCursor.ID, filter.Cursor.ID)
+				assert.True(t, tc.expectedCursor.StartTime.Equal(filter.Cursor.StartTime))
+			}
+			assert.Equal(t, tc.expectedLink, res.Header.Get("Link"))
+		})
+	}
+}
+
+func Test_getByIDHandler(t *testing.T) {
+	storedEvent := &event.Event{ID: 2, Title: "Jojo", Version: 4}
+	testCases := []struct {
+		name               string
+		ifNoneMatch        string
+		getByIDErr         error
+		expectedStatusCode int
+	}{
+		{
+			name:               "Event not found",
+			getByIDErr:         event.ErrNotFound,
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "Database unavailable",
+			getByIDErr:         fmt.Errorf("%w: timeout", event.ErrUnavailable),
+			expectedStatusCode: 503,
+		},
+		{
+			name:               "Database failure",
+			getByIDErr:         errors.New("ERROR: column \"title\" does not exist (SQLSTATE 42703)"),
+			expectedStatusCode: 500,
+		},
+		{
+			name:               "Get event",
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Not modified",
+			ifNoneMatch:        `"4"`,
+			expectedStatusCode: 304,
+		},
+		{
+			name:               "Not modified, weak tag in a list",
+			ifNoneMatch:        `"1", W/"4"`,
+			expectedStatusCode: 304,
+		},
+		{
+			name:               "Modified",
+			ifNoneMatch:        `"3"`,
+			expectedStatusCode: 200,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := NewMockSQLRepository()
+			found := storedEvent
+			if tc.getByIDErr != nil {
+				found = nil
+			}
+			mockRepo.On("GetByID", mock.Anything, int64(2)).Return(found, tc.getByIDErr)
+
+			req := httptest.NewRequest("GET", "/events/2", nil)
+			req = mux.SetURLVars(req, map[string]string{"id": "2"})
+			if tc.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tc.ifNoneMatch)
+			}
+			w := httptest.NewRecorder()
+			getByIDHandler(mockRepo).ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			if tc.getByIDErr == nil {
+				assert.Equal(t, `"4"`, res.Header.Get("ETag"))
+			}
+		})
+	}
+}
+
+func Test_Update(t *testing.T) {
+	newEvent := event.Event{
+		Title:         "Jojo",
+		Description:   "Jojo mage",
+		Location:      "Jojo Town",
+		StartTime:     time.Now(),
+		EndTime:       time.Now().Add(time.Hour),
+		InstagramPage: "jojo",
+	}
+	type updateReturn struct {
+		event *event.Event
+		err   error
+	}
+	testCases := []struct {
+		name    string
+		ifMatch string
+		// current is the version of the stored event
+		current            int64
+		updateReturn       updateReturn
+		expectedVersion    int64
+		invalid            bool
+		expectedStatusCode int
+		expectedETag       string
+	}{
+		{
+			name:               "Unconditional update",
+			updateReturn:       updateReturn{event: &event.Event{ID: 2, Version: 5}},
+			expectedVersion:    0,
+			expectedStatusCode: 200,
+			expectedETag:       `"5"`,
+		},
+		{
+			name:               "Conditional update",
+			ifMatch:            `"4"`,
+			current:            4,
+			updateReturn:       updateReturn{event: &event.Event{ID: 2, Version: 5}},
+			expectedVersion:    4,
+			expectedStatusCode: 200,
+			expectedETag:       `"5"`,
+		},
+		{
+			name:               "Outdated version",
+			ifMatch:            `"3"`,
+			current:            4,
+			expectedStatusCode: 412,
+		},
+		{
+			name:               "Changed meanwhile",
+			ifMatch:            `"3"`,
+			current:            3,
+			updateReturn:       updateReturn{err: event.ErrVersionMismatch},
+			expectedVersion:    3,
+			expectedStatusCode: 412,
+		},
+		{
+			name:               "Event not found",
+			updateReturn:       updateReturn{err: event.ErrNotFound},
+			expectedStatusCode: 404,
+		},
+		{
+			name:               "Database unavailable",
+			updateReturn:       updateReturn{err: event.ErrUnavailable},
+			expectedStatusCode: 503,
+		},
+		{
+			name:               "Malformed If-Match",
+			ifMatch:            "four",
+			expectedStatusCode: 412,
+		},
+		{
+			name:               "Invalid event",
+			invalid:            true,
+			expectedStatusCode: 422,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := NewMockSQLRepository()
+			mockRepo.On("GetByID", mock.Anything, int64(2)).Return(&event.Event{ID: 2, Version: tc.current}, nil)
+			mockRepo.On("Update", mock.Anything, int64(2), mock.Anything).Return(tc.updateReturn.event, tc.updateReturn.err)
+
+			sentEvent := newEvent
+			if tc.invalid {
+				sentEvent.EndTime = sentEvent.StartTime.Add(-time.Hour)
+			}
+			body, err := json.Marshal(sentEvent)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest("PUT", "/events/2", strings.NewReader(string(body)))
+			req = mux.SetURLVars(req, map[string]string{"id": "2"})
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			Update(mockRepo).ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			assert.Equal(t, tc.expectedETag, res.Header.Get("ETag"))
+			for _, call := range mockRepo.Calls {
+				if call.Method == "Update" {
+					assert.Equal(t, tc.expectedVersion, call.Arguments.Get(2).(event.Event).Version)
+				}
+			}
+		})
+	}
+}
+
+func Test_patchEventHandler(t *testing.T) {
+	testCases := []struct {
+		name               string
+		contentType        string
+		body               string
+		ifMatch            string
+		patchErr           error
+		expectedPatch      func(t *testing.T, patch event.Patch)
+		expectedStatusCode int
+	}{
+		{
+			name:        "Patch location only",
+			contentType: "application/merge-patch+json",
+			body:        `{"location": "Trackers"}`,
+			expectedPatch: func(t *testing.T, patch event.Patch) {
+				assert.Equal(t, "Trackers", *patch.Location)
+				assert.Nil(t, patch.Title)
+				assert.Nil(t, patch.InstagramPage)
+				assert.Nil(t, patch.StartTime)
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:        "Null clears an optional field",
+			contentType: "application/merge-patch+json; charset=utf-8",
+			body:        `{"instagram_page": null, "id": 9, "version": 1}`,
+			ifMatch:     `"7"`,
+			expectedPatch: func(t *testing.T, patch event.Patch) {
+				assert.Equal(t, "", *patch.InstagramPage)
+				assert.Equal(t, int64(7), patch.Version)
+			},
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Wrong content type",
+			contentType:        "application/json",
+			body:               `{"location": "Trackers"}`,
+			expectedStatusCode: 415,
+		},
+		{
+			name:               "Null required field",
+			contentType:        "application/merge-patch+json",
+			body:               `{"title": null}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Unknown field",
+			contentType:        "application/merge-patch+json",
+			body:               `{"place": "Trackers"}`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Not an object",
+			contentType:        "application/merge-patch+json",
+			body:               `["location"]`,
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "Outdated version",
+			contentType:        "application/merge-patch+json",
+			body:               `{"location": "Trackers"}`,
+			ifMatch:            `"6"`,
+			patchErr:           event.ErrVersionMismatch,
+			expectedStatusCode: 412,
+		},
+		{
+			name:               "Event not found",
+			contentType:        "application/merge-patch+json",
+			body:               `{"location": "Trackers"}`,
+			patchErr:           event.ErrNotFound,
+			expectedStatusCode: 404,
+		},
+		{
+			name:        "Patched event is invalid",
+			contentType: "application/merge-patch+json",
+			body:        `{"end_time": "2000-01-01T00:00:00Z"}`,
+			patchErr: &event.ValidationError{Fields: []event.FieldError{
+				{Field: "end_time", Reason: "must not be before start_time"},
+			}},
+			expectedStatusCode: 422,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var patched *event.Event
+			if tc.patchErr == nil {
+				patched = &event.Event{ID: 2, Version: 8}
+			}
+			mockRepo := NewMockSQLRepository()
+			// the stored event is at the version of If-Match
+			current, _ := tagVersion(tc.ifMatch)
+			mockRepo.On("GetByID", mock.Anything, int64(2)).Return(&event.Event{ID: 2, Version: current}, nil)
+			mockRepo.On("Patch", mock.Anything, int64(2), mock.Anything).Return(patched, tc.patchErr)
+
+			req := httptest.NewRequest("PATCH", "/events/2", strings.NewReader(tc.body))
+			req = mux.SetURLVars(req, map[string]string{"id": "2"})
+			req.Header.Set("Content-Type", tc.contentType)
+			if tc.ifMatch != "" {
+				req.Header.Set("If-Match", tc.ifMatch)
+			}
+			w := httptest.NewRecorder()
+			patchEventHandler(mockRepo).ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			if tc.expectedPatch != nil {
+				mockRepo.AssertCalled(t, "Patch", mock.Anything, int64(2), mock.Anything)
+				for _, call := range mockRepo.Calls {
+					if call.Method == "Patch" {
+						tc.expectedPatch(t, call.Arguments.Get(2).(event.Patch))
+					}
+				}
+			}
+		})
+	}
+}
+
+func Test_writeError(t *testing.T) {
+	testCases := []struct {
+		name               string
+		err                error
+		expectedStatusCode int
+		expectedDetail     string
+	}{
+		{
+			name:               "Not found",
+			err:                fmt.Errorf("GetByID: %w", event.ErrNotFound),
+			expectedStatusCode: 404,
+			expectedDetail:     "Event not found",
+		},
+		{
+			name:               "Conflict",
+			err:                fmt.Errorf("%w: Key (title)=(Jojo) already exists.", event.ErrConflict),
+			expectedStatusCode: 409,
+			expectedDetail:     "conflict: Key (title)=(Jojo) already exists.",
+		},
+		{
+			name:               "Unavailable",
+			err:                fmt.Errorf("%w: too many connections", event.ErrUnavailable),
+			expectedStatusCode: 503,
+			expectedDetail:     "The database is unavailable, try again later",
+		},
+		{
+			name:               "Deleted",
+			err:                event.ErrGone,
+			expectedStatusCode: 410,
+			expectedDetail:     "Event was deleted, it can be restored from the trash",
+		},
+		{
+			name:               "Version mismatch",
+			err:                event.ErrVersionMismatch,
+			expectedStatusCode: 412,
+			expectedDetail:     "Event was modified, fetch it again",
+		},
+		{
+			name:               "Validation",
+			err:                &event.ValidationError{Fields: []event.FieldError{{Field: "title", Reason: "is required"}}},
+			expectedStatusCode: 422,
+			expectedDetail:     "One or more fields are invalid.",
+		},
+		{
+			name:               "Delete failed",
+			err:                event.ErrDeleteFailed,
+			expectedStatusCode: 500,
+			expectedDetail:     "Delete failed",
+		},
+		{
+			name:               "Internal errors are not leaked",
+			err:                errors.New("dial tcp 10.0.0.3:5432: connection refused"),
+			expectedStatusCode: 500,
+			expectedDetail:     "Something went wrong on our side",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, r, tc.err)
+			})
+			handler = middleware.RequestID(handler)
+			req := httptest.NewRequest("GET", "/events/2", nil)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+
+			var p problem
+			err := json.NewDecoder(res.Body).Decode(&p)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedStatusCode, p.Status)
+			assert.Equal(t, tc.expectedDetail, p.Detail)
+			assert.NotEmpty(t, p.Type)
+			assert.NotEmpty(t, p.Title)
+			assert.NotEmpty(t, p.RequestID)
+		})
+	}
+}
+
+func Test_HandlerFactoryWithMemoryRepository(t *testing.T) {
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC})
+	do := func(method, path, body string, header map[string]string) *http.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	res := do("POST", "/events", `{"title": "Jojo", "location": "Jojo Town", "start_time": "2023-05-13T23:00:00Z", "end_time": "2023-05-14T05:00:00Z", "instagram_page": "jojo"}`, nil)
+	assert.Equal(t, 200, res.StatusCode)
+	var created event.Event
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&created))
+	assert.Equal(t, int64(1), created.ID)
+	assert.Equal(t, `"1"`, res.Header.Get("ETag"))
+
+	res = do("PATCH", "/events/1", `{"location": "Trackers"}`, map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": `"1"`})
+	assert.Equal(t, 200, res.StatusCode)
+	var patched event.Event
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&patched))
+	assert.Equal(t, "Trackers", patched.Location)
+	assert.Equal(t, "jojo", patched.InstagramPage)
+	assert.Equal(t, int64(2), patched.Version)
+
+	res = do("DELETE", "/events/1", "", map[string]string{"If-Match": `"1"`})
+	assert.Equal(t, 412, res.StatusCode)
+
+	res = do("GET", "/events?from=2023-05-14", "", nil)
+	assert.Equal(t, 200, res.StatusCode)
+	var listed []event.Event
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&listed))
+	assert.Len(t, listed, 1)
+
+	res = do("GET", "/events?from=2023-05-15", "", nil)
+	listed = nil
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&listed))
+	assert.Len(t, listed, 0)
+
+	res = do("DELETE", "/events/1", "", map[string]string{"If-Match": `"2"`})
+	assert.Equal(t, 200, res.StatusCode)
+
+	res = do("GET", "/events/1", "", nil)
+	assert.Equal(t, 410, res.StatusCode, "the event is in the trash")
+	assert.Equal(t, "application/problem+json", res.Header.Get("Content-Type"))
+}
+
+func Test_etagWithVenue(t *testing.T) {
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC})
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	w := do("POST", "/venues", `{"name": "Trackers", "city": "São Paulo"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	w = do("POST", "/events", `{"title": "Jojo", "venue_id": 1, "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+	assert.Equal(t, 200, w.Code, w.Body.String())
+
+	w = do("GET", "/events/1", "")
+	tag := w.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(tag, `"1.`), tag)
+	assert.Equal(t, 304, do("GET", "/events/1", "", "If-None-Match", tag).Code)
+
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, 200, do("PUT", "/venues/1", `{"name": "Trackers", "city": "São Paulo", "capacity": 300}`).Code)
+	w = do("GET", "/events/1", "", "If-None-Match", tag)
+	assert.Equal(t, 200, w.Code, "the venue changed")
+	assert.NotEqual(t, tag, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), `"capacity":300`)
+
+	assert.Equal(t, 412, do("DELETE", "/events/1", "", "If-Match", `"7", "8"`).Code)
+	assert.Equal(t, 412, do("DELETE", "/events/1", "", "If-Match", tag).Code, "the tag from before the venue changed")
+	assert.Equal(t, 412, do("DELETE", "/events/1", "", "If-Match", `"1"`).Code, "the tag without the venue")
+	tag = w.Header().Get("ETag")
+	w = do("PATCH", "/events/1", `{"title": "Jojo Todynho"}`, "Content-Type", mergePatchContentType, "If-Match", `"7", `+tag)
+	assert.Equal(t, 200, w.Code, "a tag of the list matches: %s", w.Body.String())
+	assert.Equal(t, 200, do("DELETE", "/events/1", "", "If-Match", `W/"1", `+w.Header().Get("ETag")).Code)
+}
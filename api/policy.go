@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/httplog"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+)
+
+// authorize tells whether the principal of r may do action on what owner
+// created, answering 403 when it may not, and 401 to the anonymous reads.
+// Every request is allowed when HandlerFactory has no Authenticator.
+func authorize(w http.ResponseWriter, r *http.Request, action auth.Action, owner string) bool {
+	if isAnonymous(r) {
+		log := httplog.LogEntry(r.Context())
+		log.Error().Msgf("Anonymous access denied to %s", action)
+		requireAuthentication(w, r)
+		return false
+	}
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		return true
+	}
+	if err := auth.Authorize(principal, action, owner); err != nil {
+		log := httplog.LogEntry(r.Context())
+		log.Err(err).Msgf("Access denied to %s", action)
+		writeError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// authorizeEvent is authorize for an action on the event id, looked up even
+// in the trash. The errors of the lookup are answered too.
+func authorizeEvent(w http.ResponseWriter, r *http.Request, eventRepo event.Repository, id int64, action auth.Action) bool {
+	if _, ok := auth.FromContext(r.Context()); !ok {
+		return authorize(w, r, action, "")
+	}
+	log := httplog.LogEntry(r.Context())
+	owner, err := eventRepo.Owner(r.Context(), id, log)
+	if err != nil {
+		log.Err(err).Msg("Error retrieving the owner of the event")
+		writeError(w, r, err)
+		return false
+	}
+	return authorize(w, r, action, owner)
+}
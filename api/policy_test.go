@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_authorize(t *testing.T) {
+	keys := auth.KeyMemoryRepository()
+	newKey := func(name string, role auth.Role) string {
+		key, _, err := keys.Create(context.Background(), name, role, zerolog.Nop())
+		require.NoError(t, err)
+		return key
+	}
+	promoter, other := newKey("jojo", auth.RolePromoter), newKey("ana", auth.RolePromoter)
+	curator, admin := newKey("curator", auth.RoleCurator), newKey("admin", auth.RoleAdmin)
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC, Authenticator: &auth.Authenticator{Keys: keys}})
+	do := func(key, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set(auth.APIKeyHeader, key)
+		if method == "PATCH" {
+			r.Header.Set("Content-Type", mergePatchContentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	eventBody := `{"title": "Jojo", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`
+
+	w := do(promoter, "POST", "/events", eventBody)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var created event.Event
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "key:jojo", created.CreatedBy)
+
+	w = do(other, "PATCH", "/events/1", `{"title": "Not mine"}`)
+	assert.Equal(t, 403, w.Code, w.Body.String())
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, 403, do(other, "PUT", "/events/1", eventBody).Code)
+	assert.Equal(t, 403, do(other, "DELETE", "/events/1", "").Code)
+	assert.Equal(t, 403, do(other, "POST", "/events/1:cancel", `{"reason": "Rain"}`).Code)
+	assert.Equal(t, 404, do(other, "DELETE", "/events/9", "").Code)
+
+	assert.Equal(t, 200, do(promoter, "PATCH", "/events/1", `{"title": "Jojo all night"}`).Code, "their own")
+	assert.Equal(t, 200, do(curator, "POST", "/events/1:postpone", `{"reason": "Rain"}`).Code, "curators edit any event")
+	assert.Equal(t, 200, do(curator, "DELETE", "/events/1", "").Code)
+	assert.Equal(t, 403, do(other, "POST", "/events/1:restore", "").Code, "the owner is looked up in the trash")
+	assert.Equal(t, 200, do(promoter, "POST", "/events/1:restore", "").Code)
+	assert.Equal(t, 403, do(promoter, "POST", "/events/1:revert", `{"version": 1}`).Code, "only admins revert, even the owner can't")
+	assert.Equal(t, 403, do(curator, "POST", "/events/1:revert", `{"version": 1}`).Code)
+	assert.Equal(t, 200, do(admin, "POST", "/events/1:revert", `{"version": 1}`).Code)
+	w = do("", "GET", "/events/trash", "")
+	assert.Equal(t, 401, w.Code, "the trash isn't public")
+	assert.Equal(t, bearerChallenge, w.Header().Get("WWW-Authenticate"))
+	assert.Equal(t, 403, do(promoter, "GET", "/events/trash", "").Code)
+	assert.Equal(t, 200, do(curator, "GET", "/events/trash", "").Code)
+	assert.Equal(t, 403, do(curator, "DELETE", "/events/trash", "").Code)
+	assert.Equal(t, 200, do(admin, "DELETE", "/events/trash", "").Code)
+
+	venueBody := `{"name": "Trackers", "city": "São Paulo"}`
+	w = do(promoter, "POST", "/venues", venueBody)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, 403, do(promoter, "PUT", "/venues/1", venueBody).Code, "nobody owns the venues")
+	assert.Equal(t, 200, do(curator, "PUT", "/venues/1", venueBody).Code)
+}
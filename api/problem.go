@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/storage"
+	"github.com/perebaj/ondehj/user"
+	"github.com/perebaj/ondehj/validation"
+	"github.com/perebaj/ondehj/venue"
+)
+
+const problemContentType = "application/problem+json"
+
+// problem is an error response body following RFC 7807.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	// RequestID is the id under which the request was logged.
+	RequestID string `json:"request_id,omitempty"`
+	// Errors lists the invalid fields of validation problems.
+	Errors []validation.FieldError `json:"errors,omitempty"`
+}
+
+// writeProblem answers a problem without a specific type, the status tells it all.
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string) {
+	sendProblem(w, r, problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+func sendProblem(w http.ResponseWriter, r *http.Request, p problem) {
+	p.RequestID = middleware.GetReqID(r.Context())
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// writeError maps the errors returned by the repositories to a problem.
+// Unknown errors are internal ones, their details are logged but not sent to clients.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var verr *validation.Error
+	switch {
+	case errors.As(err, &verr):
+		sendProblem(w, r, problem{
+			Type:   "/problems/validation",
+			Title:  "Invalid " + verr.What(),
+			Status: http.StatusUnprocessableEntity,
+			Detail: "One or more fields are invalid.",
+			Errors: verr.Fields,
+		})
+	case errors.Is(err, auth.ErrInvalidCredentials):
+		w.Header().Set("WWW-Authenticate", bearerChallenge+`, error="invalid_token"`)
+		writeProblem(w, r, http.StatusUnauthorized, err.Error())
+	case errors.Is(err, auth.ErrForbidden):
+		writeProblem(w, r, http.StatusForbidden, err.Error())
+	case errors.Is(err, user.ErrInvalidLogin):
+		writeProblem(w, r, http.StatusUnauthorized, "Invalid email or password")
+	case errors.Is(err, user.ErrEmailNotVerified):
+		writeProblem(w, r, http.StatusForbidden, "Email not verified, follow the link sent to it")
+	case errors.Is(err, user.ErrDisabled):
+		writeProblem(w, r, http.StatusForbidden, "Account disabled by an admin")
+	case errors.Is(err, user.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, "User not found")
+	case errors.Is(err, auth.ErrKeyNotFound):
+		writeProblem(w, r, http.StatusNotFound, "API key not found or already revoked")
+	case errors.Is(err, user.ErrInvalidToken):
+		writeProblem(w, r, http.StatusBadRequest, "Invalid or expired token, ask for a new link")
+	case errors.Is(err, event.ErrInvalidTransition):
+		writeProblem(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, event.ErrVersionNotFound):
+		writeProblem(w, r, http.StatusNotFound, "Version not found in the history of the event")
+	case errors.Is(err, event.ErrOverrideNotFound):
+		writeProblem(w, r, http.StatusNotFound, "Occurrence isn't overridden")
+	case errors.Is(err, event.ErrNotRecurring):
+		writeProblem(w, r, http.StatusUnprocessableEntity, "Event isn't recurring")
+	case errors.Is(err, event.ErrGone):
+		writeProblem(w, r, http.StatusGone, "Event was deleted, it can be restored from the trash")
+	case errors.Is(err, event.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, "Event not found")
+	case errors.Is(err, venue.ErrNotFound):
+		writeProblem(w, r, http.StatusNotFound, "Venue not found")
+	case errors.Is(err, event.ErrVersionMismatch):
+		writeProblem(w, r, http.StatusPreconditionFailed, "Event was modified, fetch it again")
+	case errors.Is(err, storage.ErrConflict):
+		writeProblem(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, storage.ErrConstraintViolation):
+		writeProblem(w, r, http.StatusUnprocessableEntity, err.Error())
+	case errors.Is(err, storage.ErrUnavailable):
+		w.Header().Set("Retry-After", "5")
+		writeProblem(w, r, http.StatusServiceUnavailable, "The database is unavailable, try again later")
+	case errors.Is(err, event.ErrInvalidCursor):
+		writeProblem(w, r, http.StatusBadRequest, err.Error())
+	case errors.Is(err, event.ErrDeleteFailed):
+		writeProblem(w, r, http.StatusInternalServerError, "Delete failed")
+	default:
+		writeProblem(w, r, http.StatusInternalServerError, "Something went wrong on our side")
+	}
+}
+
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusNotFound, "No route for "+r.URL.Path)
+}
+
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, http.StatusMethodNotAllowed, r.Method+" isn't allowed on "+r.URL.Path)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+)
+
+// eventOccurrencePath is an occurrence of a recurring event, by its original
+// start as a RFC 3339 timestamp.
+const eventOccurrencePath = "/events/{id}/occurrences/{occurrence}"
+
+// parseOccurrence reads the id and occurrence path variables.
+func parseOccurrence(r *http.Request) (int64, time.Time, error) {
+	vars := mux.Vars(r)
+	id, err := strconv.ParseInt(vars["id"], 10, 64)
+	if err != nil {
+		return 0, time.Time{}, errors.New("invalid id")
+	}
+	occurrence, err := time.Parse(time.RFC3339, vars["occurrence"])
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("invalid occurrence %q, expected the RFC 3339 start time of an occurrence", vars["occurrence"])
+	}
+	return id, occurrence, nil
+}
+
+// putOccurrenceHandler cancels or moves an occurrence of a recurring event,
+// the occurrences are those of the recurrence expanded in loc.
+func putOccurrenceHandler(eventRepo event.Repository, loc *time.Location) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("putOccurrenceHandler")
+		id, occurrence, err := parseOccurrence(r)
+		if err != nil {
+			log.Err(err).Msg("Invalid occurrence")
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		var override event.Override
+		err = json.NewDecoder(r.Body).Decode(&override)
+		if err != nil {
+			log.Err(err).Msg("Error decoding override")
+			writeProblem(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		// the occurrence comes from the path only, never from the body
+		override.Occurrence = occurrence
+		var verr *event.ValidationError
+		if errors.As(override.Validate(), &verr) {
+			log.Err(verr).Msg("Invalid override")
+			writeError(w, r, verr)
+			return
+		}
+		if !authorizeEvent(w, r, eventRepo, id, auth.ActionEdit) {
+			return
+		}
+
+		series, err := eventRepo.GetByID(r.Context(), id, log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving event")
+			writeError(w, r, err)
+			return
+		}
+		if series.Recurrence == "" {
+			writeError(w, r, event.ErrNotRecurring)
+			return
+		}
+		if !series.HasOccurrence(occurrence, loc) {
+			log.Error().Msgf("No occurrence at %s", occurrence)
+			writeProblem(w, r, http.StatusNotFound, fmt.Sprintf("No occurrence of the event starts at %s", occurrence.Format(time.RFC3339)))
+			return
+		}
+
+		overridden, err := eventRepo.SetOverride(r.Context(), id, override, log)
+		if err != nil {
+			log.Err(err).Msg("SetOverride failed")
+			writeError(w, r, err)
+			return
+		}
+		eventJson, err := json.Marshal(overridden)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling events")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(overridden))
+		w.Write(eventJson)
+		log.Info().Msg("Occurrence overridden successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// deleteOccurrenceHandler removes the override of an occurrence, which takes
+// place as the series says again.
+func deleteOccurrenceHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("deleteOccurrenceHandler")
+		id, occurrence, err := parseOccurrence(r)
+		if err != nil {
+			log.Err(err).Msg("Invalid occurrence")
+			writeProblem(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+		if !authorizeEvent(w, r, eventRepo, id, auth.ActionEdit) {
+			return
+		}
+		restored, err := eventRepo.DeleteOverride(r.Context(), id, occurrence, log)
+		if err != nil {
+			log.Err(err).Msg("DeleteOverride failed")
+			writeError(w, r, err)
+			return
+		}
+		eventJson, err := json.Marshal(restored)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling events")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(restored))
+		w.Write(eventJson)
+		log.Info().Msg("Occurrence restored successfully")
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_recurringEvents(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: saoPaulo})
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+	listStarts := func() []string {
+		w := do("GET", "/events?from=2023-05-10&to=2023-06-30", "")
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var events []event.Event
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+		starts := []string{}
+		for _, e := range events {
+			require.NotNil(t, e.Occurrence)
+			starts = append(starts, e.StartTime.In(saoPaulo).Format(time.RFC3339))
+		}
+		return starts
+	}
+
+	w := do("POST", "/events", `{"title": "Jam", "recurrence": "RRULE:FREQ=WEEKLY;BYDAY=TH;COUNT=4", "start_time": "2023-05-11T22:00:00-03:00", "end_time": "2023-05-12T01:00:00-03:00"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"recurrence":"FREQ=WEEKLY;BYDAY=TH;COUNT=4"`)
+	assert.Equal(t, []string{"2023-05-11T22:00:00-03:00", "2023-05-18T22:00:00-03:00", "2023-05-25T22:00:00-03:00", "2023-06-01T22:00:00-03:00"}, listStarts())
+
+	testCases := []struct {
+		name               string
+		method             string
+		path               string
+		body               string
+		expectedStatusCode int
+	}{
+		{"Cancel an occurrence", "PUT", "/events/1/occurrences/2023-05-18T22:00:00-03:00", `{"cancelled": true}`, 200},
+		{"Move an occurrence", "PUT", "/events/1/occurrences/2023-05-25T22:00:00-03:00", `{"start_time": "2023-05-26T22:00:00-03:00", "end_time": "2023-05-27T01:00:00-03:00"}`, 200},
+		{"Not an occurrence", "PUT", "/events/1/occurrences/2023-05-19T22:00:00-03:00", `{"cancelled": true}`, 404},
+		{"Invalid occurrence", "PUT", "/events/1/occurrences/tomorrow", `{"cancelled": true}`, 400},
+		{"Invalid override", "PUT", "/events/1/occurrences/2023-06-01T22:00:00-03:00", `{"start_time": "2023-06-02T22:00:00-03:00"}`, 422},
+		{"Missing event", "PUT", "/events/9/occurrences/2023-06-01T22:00:00-03:00", `{"cancelled": true}`, 404},
+		{"Restore an occurrence that isn't overridden", "DELETE", "/events/1/occurrences/2023-06-01T22:00:00-03:00", "", 404},
+	}
+	for _, tc := range testCases {
+		w := do(tc.method, tc.path, tc.body)
+		assert.Equal(t, tc.expectedStatusCode, w.Code, "%s: %s", tc.name, w.Body.String())
+	}
+	assert.Equal(t, []string{"2023-05-11T22:00:00-03:00", "2023-05-26T22:00:00-03:00", "2023-06-01T22:00:00-03:00"}, listStarts())
+
+	w = do("GET", "/events/1.ics", "")
+	require.Equal(t, 200, w.Code)
+	for _, s := range []string{
+		"BEGIN:VTIMEZONE\r\nTZID:America/Sao_Paulo\r\n",
+		"UID:event-1@ondehoje\r\n", "RRULE:FREQ=WEEKLY;BYDAY=TH;COUNT=4\r\n",
+		"DTSTART;TZID=America/Sao_Paulo:20230511T220000\r\n", "EXDATE;TZID=America/Sao_Paulo:20230518T220000\r\n",
+		"RECURRENCE-ID:20230526T010000Z\r\nDTSTART:20230527T010000Z\r\n",
+	} {
+		assert.Contains(t, w.Body.String(), s)
+	}
+	w = do("GET", "/events.ics?from=2023-05-10", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "UID:event-1-20230512T010000Z@ondehoje\r\n", "the occurrences of the feeds have their own UID")
+	assert.NotContains(t, w.Body.String(), "RRULE")
+
+	w = do("DELETE", "/events/1/occurrences/2023-05-18T22:00:00-03:00", "")
+	assert.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, []string{"2023-05-11T22:00:00-03:00", "2023-05-18T22:00:00-03:00", "2023-05-26T22:00:00-03:00", "2023-06-01T22:00:00-03:00"}, listStarts())
+
+	w = do("POST", "/events", `{"title": "Party", "start_time": "2023-05-13T23:00:00-03:00", "end_time": "2023-05-14T05:00:00-03:00"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	w = do("PUT", "/events/2/occurrences/2023-05-13T23:00:00-03:00", `{"cancelled": true}`)
+	assert.Equal(t, 422, w.Code, "single events have no occurrences")
+
+	w = do("POST", "/events", `{"title": "Rave", "recurrence": "FREQ=HOURLY", "start_time": "2023-05-13T23:00:00-03:00", "end_time": "2023-05-14T05:00:00-03:00"}`)
+	assert.Equal(t, 422, w.Code)
+	assert.Contains(t, w.Body.String(), `"field":"recurrence"`)
+}
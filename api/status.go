@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+)
+
+// The transitions of the status of an event, custom methods like eventBulkPath.
+// eventPathId has a catch-all id, so these routes are registered before it.
+const (
+	eventPublishPath  = "/events/{id:[0-9]+}:publish"
+	eventCancelPath   = "/events/{id:[0-9]+}:cancel"
+	eventPostponePath = "/events/{id:[0-9]+}:postpone"
+)
+
+// parseStatuses reads the status parameters, repeated or comma separated. The
+// public statuses are listed by default, leaving out the drafts.
+func parseStatuses(values url.Values) ([]event.Status, error) {
+	var statuses []event.Status
+	for _, value := range values["status"] {
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s == "" {
+				continue
+			}
+			status, err := event.ParseStatus(s)
+			if err != nil {
+				return nil, err
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	if len(statuses) == 0 {
+		return event.PublicStatuses, nil
+	}
+	return statuses, nil
+}
+
+// isPublicStatus tells whether the events with status s are public.
+func isPublicStatus(s event.Status) bool {
+	for _, public := range event.PublicStatuses {
+		if s == public {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeStatuses lets only the curators and admins list the events with a
+// status that isn't public, answering 401 or 403 to the others.
+func authorizeStatuses(w http.ResponseWriter, r *http.Request, statuses []event.Status) bool {
+	for _, s := range statuses {
+		if !isPublicStatus(s) {
+			return authorize(w, r, auth.ActionReview, "")
+		}
+	}
+	return true
+}
+
+// canSee tells whether the principal of r may see e. The events with a public
+// status are seen by everybody, the others by their owner and the curators.
+func canSee(r *http.Request, e event.Event) bool {
+	if isPublicStatus(e.Status) {
+		return true
+	}
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		return !isAnonymous(r)
+	}
+	return auth.Authorize(principal, auth.ActionEdit, e.CreatedBy) == nil
+}
+
+// transition is the body of the transition requests.
+type transition struct {
+	Reason string `json:"reason"`
+}
+
+// transitionHandler changes the status of an event to the status to. The body
+// tells why, it's optional when publishing.
+func transitionHandler(eventRepo event.Repository, to event.Status) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msgf("transitionHandler to %s", to)
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		var body transition
+		err = json.NewDecoder(r.Body).Decode(&body)
+		if err != nil && !errors.Is(err, io.EOF) {
+			log.Err(err).Msg("Error decoding transition")
+			writeProblem(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+			return
+		}
+		var verr *event.ValidationError
+		if errors.As(event.ValidateReason(to, body.Reason), &verr) {
+			log.Err(verr).Msg("Invalid transition")
+			writeError(w, r, verr)
+			return
+		}
+		version, ok := ifMatchVersion(r, eventRepo, id)
+		if !ok {
+			log.Error().Msg("If-Match can't match any version")
+			writeProblem(w, r, http.StatusPreconditionFailed, `If-Match must list strong ETags of the current version, such as "3"`)
+			return
+		}
+		if !authorizeEvent(w, r, eventRepo, id, auth.ActionEdit) {
+			return
+		}
+
+		changed, err := eventRepo.Transition(r.Context(), id, to, body.Reason, version, log)
+		if err != nil {
+			log.Err(err).Msg("Transition failed")
+			writeError(w, r, err)
+			return
+		}
+		eventJson, err := json.Marshal(changed)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling events")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(changed))
+		w.Write(eventJson)
+		log.Info().Msgf("Event %s successfully", to)
+	}
+	return http.HandlerFunc(fn)
+}
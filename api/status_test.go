@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_eventStatus(t *testing.T) {
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC})
+	do := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		handler.ServeHTTP(w, req)
+		return w
+	}
+	listed := func(query string) []int64 {
+		w := do("GET", "/events"+query, "")
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var events []event.Event
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+		ids := []int64{}
+		for _, e := range events {
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+
+	w := do("POST", "/events", `{"title": "Jojo", "status": "draft", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"draft"`)
+	w = do("POST", "/events", `{"title": "Sarau", "start_time": "2030-05-12T19:00:00Z", "end_time": "2030-05-12T22:00:00Z"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"published"`)
+	w = do("POST", "/events", `{"title": "Punk", "status": "cancelled", "start_time": "2030-05-12T19:00:00Z", "end_time": "2030-05-12T22:00:00Z"}`)
+	assert.Equal(t, 422, w.Code, "events can't be created cancelled")
+
+	assert.Equal(t, []int64{2}, listed(""), "drafts are hidden by default")
+	assert.Equal(t, []int64{2, 1}, listed("?status=draft,published"))
+	w = do("GET", "/events?status=deleted", "")
+	assert.Equal(t, 400, w.Code)
+
+	testCases := []struct {
+		name               string
+		path               string
+		body               string
+		ifMatch            string
+		expectedStatusCode int
+		expectedStatus     event.Status
+	}{
+		{"Cancel a draft", "/events/1:cancel", `{"reason": "No sound system"}`, "", 409, ""},
+		{"Publish an outdated version", "/events/1:publish", "", `"7"`, 412, ""},
+		{"Publish", "/events/1:publish", "", `"1"`, 200, event.StatusPublished},
+		{"Cancel without reason", "/events/1:cancel", `{}`, "", 422, ""},
+		{"Cancel", "/events/1:cancel", `{"reason": "No sound system"}`, "", 200, event.StatusCancelled},
+		{"Postpone a cancelled event", "/events/1:postpone", `{"reason": "Rain"}`, "", 409, ""},
+		{"Postpone", "/events/2:postpone", `{"reason": "Rain"}`, "", 200, event.StatusPostponed},
+		{"Invalid body", "/events/2:publish", `{"reason": `, "", 400, ""},
+		{"Missing event", "/events/9:publish", "", "", 404, ""},
+	}
+	for _, tc := range testCases {
+		headers := []string{}
+		if tc.ifMatch != "" {
+			headers = append(headers, "If-Match", tc.ifMatch)
+		}
+		w := do("POST", tc.path, tc.body, headers...)
+		if !assert.Equal(t, tc.expectedStatusCode, w.Code, "%s: %s", tc.name, w.Body.String()) || tc.expectedStatusCode != 200 {
+			continue
+		}
+		var changed event.Event
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&changed))
+		assert.Equal(t, tc.expectedStatus, changed.Status, tc.name)
+	}
+
+	w = do("GET", "/events/1", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"cancelled","status_reason":"No sound system"`)
+	assert.Equal(t, []int64{2, 1}, listed(""), "cancelled events stay listed")
+
+	w = do("PUT", "/events/1", `{"title": "Jojo", "status": "published", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"status":"cancelled"`, "the status only changes with the transitions")
+
+	w = do("GET", "/events/1.ics", "")
+	require.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), "STATUS:CANCELLED\r\n")
+}
+
+func Test_draftVisibility(t *testing.T) {
+	keys := auth.KeyMemoryRepository()
+	newKey := func(name string, role auth.Role) string {
+		key, _, err := keys.Create(context.Background(), name, role, zerolog.Nop())
+		require.NoError(t, err)
+		return key
+	}
+	owner, other, curator := newKey("jojo", auth.RolePromoter), newKey("ana", auth.RolePromoter), newKey("curator", auth.RoleCurator)
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC, Authenticator: &auth.Authenticator{Keys: keys}})
+	do := func(key, method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if key != "" {
+			r.Header.Set(auth.APIKeyHeader, key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	w := do(owner, "POST", "/events", `{"title": "Draft", "status": "draft", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	w = do(owner, "POST", "/events", `{"title": "Published", "status": "published", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`)
+	require.Equal(t, 200, w.Code, w.Body.String())
+
+	for _, path := range []string{"/events/1", "/events/1.ics"} {
+		assert.Equal(t, 404, do("", "GET", path, "").Code, "anonymous %s", path)
+		assert.Equal(t, 404, do(other, "GET", path, "").Code, "another promoter %s", path)
+		assert.Equal(t, 200, do(owner, "GET", path, "").Code, "the owner %s", path)
+		assert.Equal(t, 200, do(curator, "GET", path, "").Code, "a curator %s", path)
+	}
+	assert.Equal(t, 200, do("", "GET", "/events/2", "").Code)
+
+	assert.Equal(t, 401, do("", "GET", "/events?status=draft", "").Code)
+	assert.Equal(t, 401, do("", "GET", "/events.ics?status=published,draft", "").Code)
+	assert.Equal(t, 403, do(owner, "GET", "/events?status=draft", "").Code)
+	w = do(curator, "GET", "/events?status=draft", "")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"title":"Draft"`)
+
+	w = do("", "GET", "/events/export", "")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), `"title":"Draft"`)
+	assert.Contains(t, w.Body.String(), `"title":"Published"`)
+	w = do(curator, "GET", "/events/export", "")
+	assert.Contains(t, w.Body.String(), `"title":"Draft"`)
+}
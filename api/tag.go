@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/httplog"
+	"github.com/perebaj/ondehj/event"
+)
+
+const tagPath = "/tags"
+
+// maxFilterTags bounds the tags of a listing filter.
+const maxFilterTags = 20
+
+// parseTags reads the tag parameters, repeated or comma separated, and the
+// tag_match one telling whether the events need any or all of them.
+func parseTags(values url.Values) ([]string, bool, error) {
+	var tags []string
+	for _, value := range values["tag"] {
+		for _, tag := range strings.Split(value, ",") {
+			if tag = event.NormalizeTag(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	if len(tags) > maxFilterTags {
+		return nil, false, fmt.Errorf("at most %d tags can be filtered on", maxFilterTags)
+	}
+	switch match := values.Get("tag_match"); match {
+	case "", "any":
+		return tags, false, nil
+	case "all":
+		if len(tags) == 0 {
+			return nil, false, fmt.Errorf("tag_match needs tag")
+		}
+		return tags, true, nil
+	default:
+		return nil, false, fmt.Errorf("invalid tag_match %q, expected any or all", match)
+	}
+}
+
+func getAllTagsHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getAllTagsHandler")
+		counts, err := eventRepo.TagCounts(r.Context(), timeNow(), log)
+		if err != nil {
+			log.Err(err).Msg("Error counting tags")
+			writeError(w, r, err)
+			return
+		}
+		tagsJson, err := json.Marshal(counts)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling tags")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling tags")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(tagsJson)
+		log.Info().Msg("Tags retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func Test_getAllEventsHandlerTags(t *testing.T) {
+	testCases := []struct {
+		name               string
+		query              string
+		expectedTags       []string
+		expectedAllTags    bool
+		expectedStatusCode int
+	}{
+		{
+			name:               "Repeated tags",
+			query:              "?tag=techno&tag=Free+Entry",
+			expectedTags:       []string{"techno", "free-entry"},
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Comma separated tags matching all",
+			query:              "?tag=techno,queer&tag_match=all",
+			expectedTags:       []string{"techno", "queer"},
+			expectedAllTags:    true,
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Blank tags",
+			query:              "?tag=,+",
+			expectedStatusCode: 200,
+		},
+		{
+			name:               "Invalid tag_match",
+			query:              "?tag=techno&tag_match=some",
+			expectedStatusCode: 400,
+		},
+		{
+			name:               "tag_match without tag",
+			query:              "?tag_match=all",
+			expectedStatusCode: 400,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mockRepo := NewMockSQLRepository()
+			mockRepo.On("List", mock.Anything, mock.Anything).Return(&event.Page{Events: []event.Event{}}, nil)
+
+			req := httptest.NewRequest("GET", "/events"+tc.query, nil)
+			w := httptest.NewRecorder()
+			getAllEventsHandler(mockRepo, time.UTC).ServeHTTP(w, req)
+			res := w.Result()
+			assert.Equal(t, tc.expectedStatusCode, res.StatusCode)
+			if tc.expectedStatusCode != 200 {
+				mockRepo.AssertNotCalled(t, "List", mock.Anything, mock.Anything)
+				return
+			}
+			filter := mockRepo.Calls[0].Arguments.Get(1).(event.Filter)
+			assert.Equal(t, tc.expectedTags, filter.Tags)
+			assert.Equal(t, tc.expectedAllTags, filter.AllTags)
+		})
+	}
+}
+
+func Test_getAllTagsHandler(t *testing.T) {
+	now := time.Date(2023, time.May, 10, 22, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	defer func() { timeNow = time.Now }()
+
+	mockRepo := NewMockSQLRepository()
+	mockRepo.On("TagCounts", mock.Anything, now).Return([]event.TagCount{{Name: "techno", UpcomingEvents: 3}, {Name: "jazz", UpcomingEvents: 0}}, nil)
+
+	req := httptest.NewRequest("GET", "/tags", nil)
+	w := httptest.NewRecorder()
+	getAllTagsHandler(mockRepo).ServeHTTP(w, req)
+	res := w.Result()
+	body, _ := io.ReadAll(res.Body)
+	assert.Equal(t, 200, res.StatusCode)
+	assert.JSONEq(t, `[{"name":"techno","upcoming_events":3},{"name":"jazz","upcoming_events":0}]`, string(body))
+	mockRepo.AssertExpectations(t)
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+)
+
+// The trash holds the deleted events. eventPathId has a catch-all id, so these
+// routes are registered before it.
+const (
+	eventTrashPath   = "/events/trash"
+	eventRestorePath = "/events/{id:[0-9]+}:restore"
+)
+
+// defaultTrashRetention is how long the deleted events are kept when Config doesn't tell.
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+func getTrashHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getTrashHandler")
+		if !authorize(w, r, auth.ActionReview, "") {
+			return
+		}
+		events, err := eventRepo.Trash(r.Context(), log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving the trash")
+			writeError(w, r, err)
+			return
+		}
+		eventJson, err := json.Marshal(events)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling events")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(eventJson)
+		log.Info().Msg("Trash retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func restoreEventHandler(eventRepo event.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("restoreEventHandler")
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		if !authorizeEvent(w, r, eventRepo, id, auth.ActionEdit) {
+			return
+		}
+		restored, err := eventRepo.Restore(r.Context(), id, log)
+		if err != nil {
+			log.Err(err).Msg("Restore failed")
+			writeError(w, r, err)
+			return
+		}
+		eventJson, err := json.Marshal(restored)
+		if err != nil {
+			log.Err(err).Msg("Error marshalling events")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling events")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", etag(restored))
+		w.Write(eventJson)
+		log.Info().Msg("Event restored successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// purgeReport is the body of the purge responses.
+type purgeReport struct {
+	Purged int64     `json:"purged"`
+	Before time.Time `json:"before"`
+}
+
+// purgeTrashHandler permanently removes the events deleted more than retention ago.
+func purgeTrashHandler(eventRepo event.Repository, retention time.Duration) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("purgeTrashHandler")
+		if !authorize(w, r, auth.ActionAdminister, "") {
+			return
+		}
+		before := timeNow().Add(-retention)
+		purged, err := eventRepo.Purge(r.Context(), before, log)
+		if err != nil {
+			log.Err(err).Msg("Purge failed")
+			writeError(w, r, err)
+			return
+		}
+		reportJson, err := json.Marshal(purgeReport{Purged: purged, Before: before})
+		if err != nil {
+			log.Err(err).Msg("Error marshalling the report")
+			writeProblem(w, r, http.StatusInternalServerError, "Error marshalling the report")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(reportJson)
+		log.Info().Msgf("%d events purged", purged)
+	}
+	return http.HandlerFunc(fn)
+}
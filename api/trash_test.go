@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_eventTrash(t *testing.T) {
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC, TrashRetention: time.Hour})
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+	trash := func() []int64 {
+		w := do("GET", "/events/trash")
+		require.Equal(t, 200, w.Code, w.Body.String())
+		var events []event.Event
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&events))
+		ids := []int64{}
+		for _, e := range events {
+			assert.NotNil(t, e.DeletedAt)
+			ids = append(ids, e.ID)
+		}
+		return ids
+	}
+	for _, title := range []string{"Jojo", "Sarau"} {
+		w := httptest.NewRecorder()
+		body := `{"title": "` + title + `", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`
+		handler.ServeHTTP(w, httptest.NewRequest("POST", "/events", strings.NewReader(body)))
+		require.Equal(t, 200, w.Code, w.Body.String())
+	}
+	assert.Equal(t, []int64{}, trash())
+
+	assert.Equal(t, 200, do("DELETE", "/events/1").Code)
+	assert.Equal(t, 410, do("DELETE", "/events/1").Code, "deleted again")
+	assert.Equal(t, 410, do("GET", "/events/1").Code)
+	assert.Equal(t, 404, do("DELETE", "/events/9").Code)
+	assert.Equal(t, []int64{1}, trash())
+
+	w := do("POST", "/events/1:restore")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	assert.NotContains(t, w.Body.String(), "deleted_at")
+	assert.Equal(t, 200, do("GET", "/events/1").Code)
+	assert.Equal(t, 404, do("POST", "/events/1:restore").Code, "not in the trash anymore")
+	assert.Equal(t, []int64{}, trash())
+
+	assert.Equal(t, 200, do("DELETE", "/events/2").Code)
+	w = do("DELETE", "/events/trash")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"purged":0`, "deleted within the retention")
+	defer func(now func() time.Time) { timeNow = now }(timeNow)
+	timeNow = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	w = do("DELETE", "/events/trash")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"purged":1`)
+	assert.Equal(t, []int64{}, trash())
+	assert.Equal(t, 404, do("POST", "/events/2:restore").Code)
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/user"
+)
+
+const (
+	userSignupPath             = "/users:signup"
+	userVerifyEmailPath        = "/users:verify-email"
+	userResendVerificationPath = "/users:resend-verification"
+	userLoginPath              = "/users:login"
+	userForgotPasswordPath     = "/users:forgot-password"
+	userResetPasswordPath      = "/users:reset-password"
+)
+
+// The administration of the users, custom methods like eventBulkPath.
+const (
+	usersPath       = "/users"
+	userDisablePath = "/users/{id:[0-9]+}:disable"
+	userEnablePath  = "/users/{id:[0-9]+}:enable"
+	userSetRolePath = "/users/{id:[0-9]+}:set-role"
+)
+
+// publicPaths are the paths of the writes allowed without credentials, those
+// of the users who don't have any yet.
+var publicPaths = map[string]bool{
+	userSignupPath:             true,
+	userVerifyEmailPath:        true,
+	userResendVerificationPath: true,
+	userLoginPath:              true,
+	userForgotPasswordPath:     true,
+	userResetPasswordPath:      true,
+}
+
+// userRequest is the body of the requests of the users, each reads the fields
+// it needs.
+type userRequest struct {
+	Email    string `json:"email"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Token    string `json:"token"`
+	Role     string `json:"role"`
+}
+
+func decodeUserRequest(w http.ResponseWriter, r *http.Request) (userRequest, bool) {
+	log := httplog.LogEntry(r.Context())
+	var req userRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Err(err).Msg("Error decoding user request")
+		writeProblem(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return req, false
+	}
+	return req, true
+}
+
+func writeUserJSON(w http.ResponseWriter, r *http.Request, v any) {
+	log := httplog.LogEntry(r.Context())
+	userJson, err := json.Marshal(v)
+	if err != nil {
+		log.Err(err).Msg("Error marshalling user")
+		writeProblem(w, r, http.StatusInternalServerError, "Error marshalling user")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(userJson)
+}
+
+func signupHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("signupHandler")
+		req, ok := decodeUserRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := users.SignUp(r.Context(), req.Email, req.Name, req.Password, log); err != nil {
+			log.Err(err).Msg("Error signing up")
+			writeError(w, r, err)
+			return
+		}
+		// the same whether the email is taken or not
+		w.WriteHeader(http.StatusAccepted)
+		log.Info().Msg("Signup accepted")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func verifyEmailHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("verifyEmailHandler")
+		req, ok := decodeUserRequest(w, r)
+		if !ok {
+			return
+		}
+		u, err := users.VerifyEmail(r.Context(), req.Token, log)
+		if err != nil {
+			log.Err(err).Msg("Error verifying email")
+			writeError(w, r, err)
+			return
+		}
+		writeUserJSON(w, r, u)
+		log.Info().Msg("Email verified successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func resendVerificationHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("resendVerificationHandler")
+		req, ok := decodeUserRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := users.ResendVerification(r.Context(), req.Email, log); err != nil {
+			log.Err(err).Msg("Error resending verification")
+			writeError(w, r, err)
+			return
+		}
+		// the same whether the email is known or not
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func loginHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("loginHandler")
+		req, ok := decodeUserRequest(w, r)
+		if !ok {
+			return
+		}
+		session, err := users.Login(r.Context(), req.Email, req.Password, log)
+		if err != nil {
+			log.Err(err).Msg("Error logging in")
+			writeError(w, r, err)
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		writeUserJSON(w, r, session)
+		log.Info().Msg("User logged in successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func forgotPasswordHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("forgotPasswordHandler")
+		req, ok := decodeUserRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := users.ForgotPassword(r.Context(), req.Email, log); err != nil {
+			log.Err(err).Msg("Error sending password reset")
+			writeError(w, r, err)
+			return
+		}
+		// the same whether the email is known or not
+		w.WriteHeader(http.StatusAccepted)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func resetPasswordHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("resetPasswordHandler")
+		req, ok := decodeUserRequest(w, r)
+		if !ok {
+			return
+		}
+		if err := users.ResetPassword(r.Context(), req.Token, req.Password, log); err != nil {
+			log.Err(err).Msg("Error resetting password")
+			writeError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		log.Info().Msg("Password reset successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func getAllUsersHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getAllUsersHandler")
+		if !authorize(w, r, auth.ActionAdminister, "") {
+			return
+		}
+		all, err := users.All(r.Context(), log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving users")
+			writeError(w, r, err)
+			return
+		}
+		writeUserJSON(w, r, all)
+		log.Info().Msg("Users retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// setDisabledHandler disables the user of the path, or enables them again.
+func setDisabledHandler(users *user.Service, disabled bool) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("setDisabledHandler")
+		if !authorize(w, r, auth.ActionAdminister, "") {
+			return
+		}
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		u, err := users.SetDisabled(r.Context(), id, disabled, log)
+		if err != nil {
+			log.Err(err).Msg("Error disabling or enabling user")
+			writeError(w, r, err)
+			return
+		}
+		writeUserJSON(w, r, u)
+		log.Info().Msgf("User disabled: %t", disabled)
+	}
+	return http.HandlerFunc(fn)
+}
+
+func setRoleHandler(users *user.Service) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("setRoleHandler")
+		if !authorize(w, r, auth.ActionAdminister, "") {
+			return
+		}
+		idStr := mux.Vars(r)["id"]
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			log.Err(err).Msgf("Invalid id: %s", idStr)
+			writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+			return
+		}
+		req, ok := decodeUserRequest(w, r)
+		if !ok {
+			return
+		}
+		u, err := users.SetRole(r.Context(), id, req.Role, log)
+		if err != nil {
+			log.Err(err).Msg("Error setting role")
+			writeError(w, r, err)
+			return
+		}
+		writeUserJSON(w, r, u)
+		log.Info().Msg("Role set successfully")
+	}
+	return http.HandlerFunc(fn)
+}
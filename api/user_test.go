@@ -0,0 +1,166 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/user"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_users(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	var mails strings.Builder
+	users, err := user.NewService(user.UserMemoryRepository(), user.NewWriterMailer(&mails, "ondehoje <noreply@example.com>"),
+		auth.NewTokenSigner(secret, time.Hour), "https://ondehoje.example")
+	require.NoError(t, err)
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{
+		Location:      time.UTC,
+		Authenticator: &auth.Authenticator{Keys: auth.KeyMemoryRepository(), Tokens: auth.NewTokenVerifier(secret, nil), Accounts: users},
+		Users:         users,
+	})
+	do := func(path, body, bearer string) *httptest.ResponseRecorder {
+		method := "POST"
+		if body == "" {
+			method = "GET"
+		}
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		if bearer != "" {
+			r.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	tokenRe := regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`)
+	lastToken := func() string {
+		matches := tokenRe.FindAllStringSubmatch(mails.String(), -1)
+		require.NotEmpty(t, matches, mails.String())
+		return matches[len(matches)-1][1]
+	}
+
+	w := do("/users:signup", `{"email": "jojo@example.com", "name": "Jojo", "password": "correct horse"}`, "")
+	require.Equal(t, 202, w.Code, w.Body.String())
+	assert.Empty(t, w.Body.String())
+	w = do("/users:signup", `{"email": "jojo@example.com", "name": "Jojo", "password": "correct horse"}`, "")
+	assert.Equal(t, 202, w.Code, "the same whether the email is taken or not")
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, 422, do("/users:signup", `{"email": "jojo", "name": "Jojo", "password": "short"}`, "").Code)
+	assert.Equal(t, 400, do("/users:signup", `{`, "").Code)
+
+	login := `{"email": "jojo@example.com", "password": "correct horse"}`
+	assert.Equal(t, 403, do("/users:login", login, "").Code, "the email isn't verified")
+	assert.Equal(t, 400, do("/users:verify-email", `{"token": "nope"}`, "").Code)
+	assert.Equal(t, 200, do("/users:verify-email", `{"token": "`+lastToken()+`"}`, "").Code)
+
+	w = do("/users:login", `{"email": "jojo@example.com", "password": "wrong horse"}`, "")
+	assert.Equal(t, 401, w.Code)
+	assert.Equal(t, problemContentType, w.Header().Get("Content-Type"))
+	w = do("/users:login", login, "")
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var session user.Session
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&session))
+	assert.Equal(t, "Bearer", session.TokenType)
+
+	w = do("/events", `{"title": "Jojo", "start_time": "2030-05-13T23:00:00Z", "end_time": "2030-05-14T05:00:00Z"}`, session.Token)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var created event.Event
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	assert.Equal(t, "user:1", created.CreatedBy, "the tokens don't carry the email")
+
+	for _, path := range []string{"/events/1", "/events/1/history", "/events", "/events/export"} {
+		w = do(path, "", "")
+		require.Equal(t, 200, w.Code, w.Body.String())
+		assert.NotContains(t, w.Body.String(), "user:1", "%s hides the accounts from anonymous readers", path)
+		assert.Contains(t, do(path, "", session.Token).Body.String(), "user:1", path)
+	}
+
+	assert.Equal(t, 200, do("/users:login", login, "stale").Code, "the public paths ignore the credentials")
+
+	assert.Equal(t, 202, do("/users:forgot-password", `{"email": "nobody@example.com"}`, "").Code)
+	assert.Equal(t, 202, do("/users:forgot-password", `{"email": "jojo@example.com"}`, "").Code)
+	assert.Equal(t, 204, do("/users:reset-password", `{"token": "`+lastToken()+`", "password": "battery staple"}`, "").Code)
+	assert.Equal(t, 401, do("/users:login", login, "").Code)
+	assert.Equal(t, 200, do("/users:login", `{"email": "jojo@example.com", "password": "battery staple"}`, "").Code)
+}
+
+func Test_administerUsers(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	var mails strings.Builder
+	users, err := user.NewService(user.UserMemoryRepository(), user.NewWriterMailer(&mails, "ondehoje <noreply@example.com>"),
+		auth.NewTokenSigner(secret, time.Hour), "https://ondehoje.example")
+	require.NoError(t, err)
+	keys := auth.KeyMemoryRepository()
+	admin, _, err := keys.Create(context.Background(), "admin", auth.RoleAdmin, zerolog.Nop())
+	require.NoError(t, err)
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{
+		Location:      time.UTC,
+		Authenticator: &auth.Authenticator{Keys: keys, Tokens: auth.NewTokenVerifier(secret, nil), Accounts: users},
+		Users:         users,
+	})
+	do := func(method, path, body string, headers ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			r.Header.Set(headers[i], headers[i+1])
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w
+	}
+	asAdmin := []string{auth.APIKeyHeader, admin}
+
+	require.Equal(t, 202, do("POST", "/users:signup", `{"email": "jojo@example.com", "name": "Jojo", "password": "correct horse"}`).Code)
+	token := regexp.MustCompile(`\?token=([A-Za-z0-9_-]+)`).FindStringSubmatch(mails.String())
+	require.Len(t, token, 2)
+	require.Equal(t, 200, do("POST", "/users:verify-email", `{"token": "`+token[1]+`"}`).Code)
+	login := `{"email": "jojo@example.com", "password": "correct horse"}`
+	w := do("POST", "/users:login", login)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var session user.Session
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&session))
+	asJojo := []string{"Authorization", "Bearer " + session.Token}
+
+	assert.Equal(t, 401, do("GET", "/users", "").Code)
+	assert.Equal(t, 403, do("GET", "/users", "", asJojo...).Code)
+	assert.Equal(t, 403, do("POST", "/users/1:set-role", `{"role": "admin"}`, asJojo...).Code, "promoters can't promote themselves")
+	w = do("GET", "/users", "", asAdmin...)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	var listed []user.User
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, "jojo@example.com", listed[0].Email)
+	assert.NotContains(t, w.Body.String(), "password")
+
+	assert.Equal(t, 422, do("POST", "/users/1:set-role", `{"role": "root"}`, asAdmin...).Code)
+	assert.Equal(t, 404, do("POST", "/users/9:set-role", `{"role": "curator"}`, asAdmin...).Code)
+	w = do("POST", "/users/1:set-role", `{"role": "curator"}`, asAdmin...)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"role":"curator"`)
+	assert.Equal(t, 200, do("GET", "/events/trash", "", asJojo...).Code, "the session takes the new role")
+
+	assert.Equal(t, 404, do("POST", "/users/9:disable", "", asAdmin...).Code)
+	w = do("POST", "/users/1:disable", "", asAdmin...)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"disabled_at"`)
+	assert.Equal(t, 401, do("GET", "/events", "", asJojo...).Code, "the session stops working")
+	assert.Equal(t, 403, do("POST", "/users:login", login).Code)
+
+	w = do("POST", "/users/1:enable", "", asAdmin...)
+	require.Equal(t, 200, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), `"disabled_at"`)
+	assert.Equal(t, 200, do("GET", "/events", "", asJojo...).Code)
+	assert.Equal(t, 200, do("POST", "/users:login", login).Code)
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/httplog"
+	"github.com/gorilla/mux"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/validation"
+	"github.com/perebaj/ondehj/venue"
+)
+
+const (
+	venuePath   = "/venues"
+	venuePathId = "/venues/{id}"
+)
+
+func getAllVenuesHandler(venueRepo venue.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getAllVenuesHandler")
+		venues, err := venueRepo.All(r.Context(), log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving venues")
+			writeError(w, r, err)
+			return
+		}
+		writeVenueJSON(w, r, venues)
+		log.Info().Msg("Venues retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func getVenueByIDHandler(venueRepo venue.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("getVenueByIDHandler")
+		id, ok := venueID(w, r)
+		if !ok {
+			return
+		}
+		v, err := venueRepo.GetByID(r.Context(), id, log)
+		if err != nil {
+			log.Err(err).Msg("Error retrieving venue")
+			writeError(w, r, err)
+			return
+		}
+		writeVenueJSON(w, r, v)
+		log.Info().Msg("Venue retrieved successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func postCreateVenueHandler(venueRepo venue.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("postCreateVenueHandler")
+		requestVenue, ok := decodeVenue(w, r)
+		if !ok {
+			return
+		}
+		if !authorize(w, r, auth.ActionCreate, "") {
+			return
+		}
+		createdVenue, err := venueRepo.Create(r.Context(), requestVenue, log)
+		if err != nil {
+			log.Err(err).Msg("Error creating new Venue")
+			writeError(w, r, err)
+			return
+		}
+		writeVenueJSON(w, r, createdVenue)
+		log.Info().Msg("Venue created successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func updateVenueHandler(venueRepo venue.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("updateVenueHandler")
+		id, ok := venueID(w, r)
+		if !ok {
+			return
+		}
+		newVenue, ok := decodeVenue(w, r)
+		if !ok {
+			return
+		}
+		// nobody owns the venues, they're shared by the events of everyone
+		if !authorize(w, r, auth.ActionEdit, "") {
+			return
+		}
+		updatedVenue, err := venueRepo.Update(r.Context(), id, newVenue, log)
+		if err != nil {
+			log.Err(err).Msg("Update venue failed")
+			writeError(w, r, err)
+			return
+		}
+		writeVenueJSON(w, r, updatedVenue)
+		log.Info().Msg("Venue updated successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+func deleteVenueHandler(venueRepo venue.Repository) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		log := httplog.LogEntry(r.Context())
+		log.Info().Msg("deleteVenueHandler")
+		id, ok := venueID(w, r)
+		if !ok {
+			return
+		}
+		if !authorize(w, r, auth.ActionEdit, "") {
+			return
+		}
+		err := venueRepo.Delete(r.Context(), id, log)
+		if err != nil {
+			log.Err(err).Msg("Delete venue failed")
+			writeError(w, r, err)
+			return
+		}
+		log.Info().Msg("Venue deleted successfully")
+	}
+	return http.HandlerFunc(fn)
+}
+
+// venueID reads the id of the route, answering 400 when it's invalid.
+func venueID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	log := httplog.LogEntry(r.Context())
+	idStr := mux.Vars(r)["id"]
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		log.Err(err).Msgf("Invalid id: %s", idStr)
+		writeProblem(w, r, http.StatusBadRequest, "Invalid id")
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeVenue reads and validates the venue in the request body, answering
+// the problem when it's invalid.
+func decodeVenue(w http.ResponseWriter, r *http.Request) (venue.Venue, bool) {
+	log := httplog.LogEntry(r.Context())
+	var v venue.Venue
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		log.Err(err).Msg("Error decoding venue")
+		writeProblem(w, r, http.StatusBadRequest, "Invalid JSON body: "+err.Error())
+		return v, false
+	}
+	var verr *validation.Error
+	if errors.As(v.Validate(), &verr) {
+		log.Err(verr).Msg("Invalid Venue")
+		writeError(w, r, verr)
+		return v, false
+	}
+	return v, true
+}
+
+func writeVenueJSON(w http.ResponseWriter, r *http.Request, v any) {
+	log := httplog.LogEntry(r.Context())
+	venueJson, err := json.Marshal(v)
+	if err != nil {
+		log.Err(err).Msg("Error marshalling venues")
+		writeProblem(w, r, http.StatusInternalServerError, "Error marshalling venues")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(venueJson)
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_venueHandlers(t *testing.T) {
+	venues := venue.VenueMemoryRepository()
+	handler := HandlerFactory(event.EventMemoryRepository(venues), venues, Config{Location: time.UTC})
+	trackers := `{"name": "Trackers", "address": "Rua Dom José de Barros, 337", "city": "São Paulo", "coordinates": {"lat": -23.5446, "lng": -46.6406}, "instagram_page": "trackers"}`
+
+	testCases := []struct {
+		name               string
+		method             string
+		path               string
+		body               string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{"Create venue", "POST", "/venues", trackers, 200, `"id":1`},
+		{"Create duplicated venue", "POST", "/venues", trackers, 409, `"status":409`},
+		{"Create invalid venue", "POST", "/venues", `{"name": "", "capacity": -1, "coordinates": {"lat": 91, "lng": 0}}`, 422, `"field":"coordinates.lat"`},
+		{"Create venue with invalid JSON", "POST", "/venues", `{"name":`, 400, `"status":400`},
+		{"Get venue", "GET", "/venues/1", "", 200, `"name":"Trackers"`},
+		{"Get missing venue", "GET", "/venues/2", "", 404, `"detail":"Venue not found"`},
+		{"Get venue with invalid id", "GET", "/venues/abc", "", 400, `"detail":"Invalid id"`},
+		{"List venues", "GET", "/venues", "", 200, `"coordinates":{"lat":-23.5446,"lng":-46.6406}`},
+		{"Create event at the venue", "POST", "/events", `{"title": "Jojo", "venue_id": 1, "start_time": "2023-05-13T23:00:00Z", "end_time": "2023-05-14T05:00:00Z"}`, 200, `"venue":{"id":1,"name":"Trackers"`},
+		{"Create event at a missing venue", "POST", "/events", `{"title": "Jojo", "venue_id": 9, "start_time": "2023-05-13T23:00:00Z", "end_time": "2023-05-14T05:00:00Z"}`, 422, `"field":"venue_id"`},
+		{"Update venue", "PUT", "/venues/1", `{"name": "Trackers SP", "city": "São Paulo"}`, 200, `"coordinates":null`},
+		{"Events embed the updated venue", "GET", "/events/1", "", 200, `"name":"Trackers SP"`},
+		{"Update missing venue", "PUT", "/venues/2", `{"name": "Trackers"}`, 404, `"detail":"Venue not found"`},
+		{"Delete venue in use", "DELETE", "/venues/1", "", 409, `"status":409`},
+		{"Move the event out of the venue", "PATCH", "/events/1", `{"venue_id": null}`, 200, `"venue_id":null`},
+		{"Delete venue", "DELETE", "/venues/1", "", 200, ""},
+		{"Delete missing venue", "DELETE", "/venues/1", "", 404, `"detail":"Venue not found"`},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+		if tc.method == "PATCH" {
+			req.Header.Set("Content-Type", mergePatchContentType)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		res := w.Result()
+		// the cases share the repositories, so stop at the first failure
+		if !assert.Equal(t, tc.expectedStatusCode, res.StatusCode, tc.name) {
+			return
+		}
+		assert.Contains(t, w.Body.String(), tc.expectedBody, tc.name)
+	}
+
+	var listed []venue.Venue
+	res := httptest.NewRecorder()
+	handler.ServeHTTP(res, httptest.NewRequest("GET", "/venues", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&listed))
+	assert.Empty(t, listed)
+}
@@ -0,0 +1,149 @@
+// Package auth authenticates the clients of the API: the ingestion bots with
+// API keys, and the humans with JWT bearer tokens.
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// Method is how a principal authenticated.
+type Method string
+
+const (
+	MethodAPIKey Method = "api_key"
+	MethodJWT    Method = "jwt"
+)
+
+// Principal is the authenticated client of a request.
+type Principal struct {
+	// Subject is the name of the API key, or the sub claim of the token.
+	Subject string
+	Method  Method
+	Role    Role
+}
+
+// String identifies the principal in the logs and the history of the events,
+// the API keys being told apart from the users by a "key:" prefix.
+func (p Principal) String() string {
+	if p.Method == MethodAPIKey {
+		return "key:" + p.Subject
+	}
+	return p.Subject
+}
+
+// ErrInvalidCredentials is returned when a request has an unknown or revoked
+// API key, or a token that doesn't verify.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// APIKeyHeader is the header of the API keys, the tokens go in Authorization.
+const APIKeyHeader = "X-API-Key"
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal of a request.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal set by WithPrincipal, if any.
+func FromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// userSubjectPrefix starts the sub claim of the tokens signed for the users
+// who log in, followed by their id, so their email doesn't end up in the
+// history of the events.
+const userSubjectPrefix = "user:"
+
+// UserSubject returns the sub claim of the tokens of the user with the id.
+func UserSubject(id int64) string {
+	return userSubjectPrefix + strconv.FormatInt(id, 10)
+}
+
+// Accounts resolves the users of the tokens with a UserSubject.
+type Accounts interface {
+	// Role returns the current role of the user with the id, or an error
+	// wrapping ErrInvalidCredentials when they can't log in anymore.
+	Role(ctx context.Context, id int64, log zerolog.Logger) (Role, error)
+}
+
+// Authenticator checks the credentials of the requests.
+type Authenticator struct {
+	// Keys are the API keys, none are accepted when nil.
+	Keys KeyRepository
+	// Tokens verifies the bearer tokens, none are accepted when nil.
+	Tokens *TokenVerifier
+	// Accounts resolves the tokens of the users who log in, which take the
+	// role of the user rather than their role claim. They're refused when nil.
+	Accounts Accounts
+}
+
+// Authenticate returns the principal of r, or nil when r has no credentials.
+// ErrInvalidCredentials is returned when they don't check out.
+func (a *Authenticator) Authenticate(r *http.Request, log zerolog.Logger) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	authorization := r.Header.Get("Authorization")
+	switch {
+	case key != "" && authorization != "":
+		return nil, fmt.Errorf("%w: both an API key and an Authorization header", ErrInvalidCredentials)
+	case key != "":
+		if a.Keys == nil {
+			return nil, fmt.Errorf("%w: API keys aren't accepted", ErrInvalidCredentials)
+		}
+		apiKey, err := a.Keys.Lookup(r.Context(), key, log)
+		if err != nil {
+			return nil, err
+		}
+		return &Principal{Subject: apiKey.Name, Method: MethodAPIKey, Role: apiKey.Role}, nil
+	case authorization != "":
+		scheme, token, _ := strings.Cut(authorization, " ")
+		if !strings.EqualFold(scheme, "Bearer") || token == "" {
+			return nil, fmt.Errorf("%w: expected a bearer token", ErrInvalidCredentials)
+		}
+		if a.Tokens == nil {
+			return nil, fmt.Errorf("%w: tokens aren't accepted", ErrInvalidCredentials)
+		}
+		claims, err := a.Tokens.Verify(strings.TrimSpace(token))
+		if err != nil {
+			return nil, err
+		}
+		// the owners of the events are told apart by the prefix of the keys
+		if strings.HasPrefix(claims.Subject, "key:") {
+			return nil, fmt.Errorf("%w: the sub claim can't start with key:", ErrInvalidCredentials)
+		}
+		if id, ok := strings.CutPrefix(claims.Subject, userSubjectPrefix); ok {
+			return a.user(r.Context(), claims.Subject, id, log)
+		}
+		role, err := ParseRole(claims.Role)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+		}
+		return &Principal{Subject: claims.Subject, Method: MethodJWT, Role: role}, nil
+	}
+	return nil, nil
+}
+
+// user returns the principal of the token of a user, whose role may have
+// changed since they logged in.
+func (a *Authenticator) user(ctx context.Context, subject, id string, log zerolog.Logger) (*Principal, error) {
+	if a.Accounts == nil {
+		return nil, fmt.Errorf("%w: the tokens of the users aren't accepted", ErrInvalidCredentials)
+	}
+	userID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed sub claim %q", ErrInvalidCredentials, subject)
+	}
+	role, err := a.Accounts.Role(ctx, userID, log)
+	if err != nil {
+		return nil, err
+	}
+	return &Principal{Subject: subject, Method: MethodJWT, Role: role}, nil
+}
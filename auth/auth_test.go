@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/storage"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryKeyRepository(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	keys := KeyMemoryRepository()
+	key, apiKey, err := keys.Create(ctx, "agenda-bot", RolePromoter, log)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, keyPrefix))
+	assert.True(t, strings.HasPrefix(key, apiKey.Hint))
+	assert.Equal(t, "agenda-bot", apiKey.Name)
+
+	_, _, err = keys.Create(ctx, "agenda-bot", RolePromoter, log)
+	assert.ErrorIs(t, err, storage.ErrConflict)
+	_, _, err = keys.Create(ctx, " ", RolePromoter, log)
+	assert.Error(t, err)
+
+	found, err := keys.Lookup(ctx, key, log)
+	require.NoError(t, err)
+	assert.Equal(t, apiKey.ID, found.ID)
+	_, err = keys.Lookup(ctx, key+"x", log)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	require.NoError(t, keys.Revoke(ctx, apiKey.ID, log))
+	assert.ErrorIs(t, keys.Revoke(ctx, apiKey.ID, log), ErrKeyNotFound)
+	_, err = keys.Lookup(ctx, key, log)
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// the name is free again once revoked
+	_, rotated, err := keys.Create(ctx, "agenda-bot", RolePromoter, log)
+	require.NoError(t, err)
+	all, err := keys.All(ctx, log)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.NotNil(t, all[0].RevokedAt)
+	assert.Equal(t, rotated.ID, all[1].ID)
+	assert.Nil(t, all[1].RevokedAt)
+}
+
+func TestAuthenticate(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	keys := KeyMemoryRepository()
+	key, _, err := keys.Create(ctx, "agenda-bot", RolePromoter, log)
+	require.NoError(t, err)
+	exp := time.Now().Add(time.Hour).Unix()
+	token := signHS256(t, testSecret, map[string]any{"sub": "jojo", "exp": exp})
+	bearer := func(claims map[string]any) map[string]string {
+		claims["exp"] = exp
+		return map[string]string{"Authorization": "Bearer " + signHS256(t, testSecret, claims)}
+	}
+	authenticator := &Authenticator{Keys: keys, Tokens: NewTokenVerifier(testSecret, nil)}
+
+	testCases := []struct {
+		name      string
+		headers   map[string]string
+		principal *Principal
+		invalid   bool
+	}{
+		{name: "No credentials"},
+		{name: "API key", headers: map[string]string{"X-API-Key": key}, principal: &Principal{Subject: "agenda-bot", Method: MethodAPIKey, Role: RolePromoter}},
+		{name: "Unknown API key", headers: map[string]string{"X-API-Key": "ondehoje_nope"}, invalid: true},
+		{name: "Bearer token", headers: map[string]string{"Authorization": "Bearer " + token}, principal: &Principal{Subject: "jojo", Method: MethodJWT, Role: RolePromoter}},
+		{name: "Lowercase scheme", headers: map[string]string{"Authorization": "bearer " + token}, principal: &Principal{Subject: "jojo", Method: MethodJWT, Role: RolePromoter}},
+		{name: "Role claim", headers: bearer(map[string]any{"sub": "jojo", "role": "curator"}), principal: &Principal{Subject: "jojo", Method: MethodJWT, Role: RoleCurator}},
+		{name: "Unknown role claim", headers: bearer(map[string]any{"sub": "jojo", "role": "root"}), invalid: true},
+		{name: "Subject of a key", headers: bearer(map[string]any{"sub": "key:agenda-bot"}), invalid: true},
+		{name: "Basic scheme", headers: map[string]string{"Authorization": "Basic am9qbzpzZWNyZXQ="}, invalid: true},
+		{name: "Both", headers: map[string]string{"X-API-Key": key, "Authorization": "Bearer " + token}, invalid: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/events", nil)
+			for name, value := range tc.headers {
+				r.Header.Set(name, value)
+			}
+			principal, err := authenticator.Authenticate(r, log)
+			if tc.invalid {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.principal, principal)
+		})
+	}
+
+	t.Run("Users", func(t *testing.T) {
+		accounts := fakeAccounts{7: RoleCurator}
+		withAccounts := &Authenticator{Tokens: NewTokenVerifier(testSecret, nil), Accounts: accounts}
+		for _, tc := range []struct {
+			name      string
+			authn     *Authenticator
+			claims    map[string]any
+			principal *Principal
+		}{
+			{"Current role", withAccounts, map[string]any{"sub": UserSubject(7), "role": "admin"}, &Principal{Subject: "user:7", Method: MethodJWT, Role: RoleCurator}},
+			{"Unknown user", withAccounts, map[string]any{"sub": UserSubject(8)}, nil},
+			{"Malformed id", withAccounts, map[string]any{"sub": "user:jojo"}, nil},
+			{"Accounts not configured", authenticator, map[string]any{"sub": UserSubject(7)}, nil},
+		} {
+			r := httptest.NewRequest("POST", "/events", nil)
+			r.Header.Set("Authorization", bearer(tc.claims)["Authorization"])
+			principal, err := tc.authn.Authenticate(r, log)
+			if tc.principal == nil {
+				assert.ErrorIs(t, err, ErrInvalidCredentials, tc.name)
+				continue
+			}
+			require.NoError(t, err, tc.name)
+			assert.Equal(t, tc.principal, principal, tc.name)
+		}
+	})
+
+	t.Run("Tokens not configured", func(t *testing.T) {
+		r := httptest.NewRequest("POST", "/events", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		_, err := (&Authenticator{Keys: keys}).Authenticate(r, log)
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
+
+// fakeAccounts are the roles of the users by id.
+type fakeAccounts map[int64]Role
+
+func (a fakeAccounts) Role(ctx context.Context, id int64, log zerolog.Logger) (Role, error) {
+	role, ok := a[id]
+	if !ok {
+		return "", fmt.Errorf("%w: unknown user", ErrInvalidCredentials)
+	}
+	return role, nil
+}
+
+func TestPrincipal(t *testing.T) {
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+	ctx := WithPrincipal(context.Background(), Principal{Subject: "agenda-bot", Method: MethodAPIKey})
+	p, ok := FromContext(ctx)
+	require.True(t, ok)
+	assert.Equal(t, "key:agenda-bot", p.String())
+	assert.Equal(t, "jojo", Principal{Subject: "jojo", Method: MethodJWT}.String())
+}
+
+func TestAuthorize(t *testing.T) {
+	promoter := Principal{Subject: "jojo", Method: MethodJWT, Role: RolePromoter}
+	curator := Principal{Subject: "ana", Method: MethodJWT, Role: RoleCurator}
+	admin := Principal{Subject: "agenda-bot", Method: MethodAPIKey, Role: RoleAdmin}
+	testCases := []struct {
+		name      string
+		principal Principal
+		action    Action
+		owner     string
+		allowed   bool
+	}{
+		{name: "Promoter creates", principal: promoter, action: ActionCreate, allowed: true},
+		{name: "Promoter edits their own", principal: promoter, action: ActionEdit, owner: "jojo", allowed: true},
+		{name: "Promoter edits another one", principal: promoter, action: ActionEdit, owner: "ana"},
+		{name: "Promoter edits what nobody owns", principal: promoter, action: ActionEdit},
+		{name: "Promoter edits what a key of the same name owns", principal: promoter, action: ActionEdit, owner: "key:jojo"},
+		{name: "Promoter administers", principal: promoter, action: ActionAdminister, owner: "jojo"},
+		{name: "Promoter reviews", principal: promoter, action: ActionReview, owner: "jojo"},
+		{name: "Curator edits any", principal: curator, action: ActionEdit, owner: "jojo", allowed: true},
+		{name: "Curator reviews", principal: curator, action: ActionReview, allowed: true},
+		{name: "Curator administers", principal: curator, action: ActionAdminister},
+		{name: "Admin administers", principal: admin, action: ActionAdminister, allowed: true},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := Authorize(tc.principal, tc.action, tc.owner)
+			if tc.allowed {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrForbidden)
+			}
+		})
+	}
+}
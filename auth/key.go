@@ -0,0 +1,245 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/perebaj/ondehj/storage"
+	"github.com/rs/zerolog"
+)
+
+// ErrKeyNotFound is returned when revoking a key that doesn't exist or is
+// already revoked, it wraps pgx.ErrNoRows.
+var ErrKeyNotFound = fmt.Errorf("API key not found: %w", pgx.ErrNoRows)
+
+// keyPrefix starts every API key, so a leaked one is easy to recognize.
+const keyPrefix = "ondehoje_"
+
+// APIKey is an API key, like those of the ingestion bots. The key itself is only known when
+// it's created, the repositories keep its SHA-256.
+type APIKey struct {
+	ID int64 `json:"id"`
+	// Name tells the bots apart, it's unique among the keys not revoked.
+	Name string `json:"name"`
+	// Hint is the start of the key, to find which one a bot uses.
+	Hint      string    `json:"hint"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"created_at"`
+	// RevokedAt is nil while the key is accepted.
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+type KeyRepository interface {
+	// Create returns a new key named name with a role, along with the key
+	// itself, which can't be retrieved afterwards. It returns
+	// storage.ErrConflict when a key with that name isn't revoked.
+	Create(ctx context.Context, name string, role Role, log zerolog.Logger) (key string, apiKey *APIKey, err error)
+	// Lookup returns the key, or ErrInvalidCredentials when it's unknown or revoked.
+	Lookup(ctx context.Context, key string, log zerolog.Logger) (*APIKey, error)
+	// Revoke stops accepting a key, it returns ErrKeyNotFound when there's no such key not revoked.
+	Revoke(ctx context.Context, id int64, log zerolog.Logger) error
+	// All returns the keys ordered by id, the revoked ones included.
+	All(ctx context.Context, log zerolog.Logger) ([]APIKey, error)
+}
+
+// newKey returns a random key along with its hint and hash.
+func newKey() (key, hint, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, key[:len(keyPrefix)+4], hashKey(key), nil
+}
+
+// hashKey returns the hex SHA-256 of a key. The keys are random enough that a
+// slow hash isn't needed.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func checkKey(name string, role Role) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("the name of a key can't be empty")
+	}
+	if parsed, err := ParseRole(string(role)); err != nil || parsed != role {
+		return fmt.Errorf("invalid role %q of a key", role)
+	}
+	return nil
+}
+
+func translateError(err error) error {
+	return storage.TranslateError(err, ErrKeyNotFound)
+}
+
+const keyColumns = `id, name, hint, role, created_at, revoked_at`
+
+func scanKey(row pgx.Row, apiKey *APIKey) error {
+	return row.Scan(&apiKey.ID, &apiKey.Name, &apiKey.Hint, &apiKey.Role, &apiKey.CreatedAt, &apiKey.RevokedAt)
+}
+
+type SQLKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+var _ KeyRepository = (*SQLKeyRepository)(nil)
+
+func KeySQLRepository(db *pgxpool.Pool) *SQLKeyRepository {
+	return &SQLKeyRepository{db: db}
+}
+
+func (r *SQLKeyRepository) Create(ctx context.Context, name string, role Role, log zerolog.Logger) (string, *APIKey, error) {
+	if err := checkKey(name, role); err != nil {
+		return "", nil, err
+	}
+	key, hint, hash, err := newKey()
+	if err != nil {
+		log.Err(err).Msg("Create failed")
+		return "", nil, err
+	}
+	var apiKey APIKey
+	err = scanKey(r.db.QueryRow(ctx, `
+		INSERT INTO api_keys (name, hint, hash, role) VALUES ($1, $2, $3, $4) RETURNING `+keyColumns,
+		name, hint, hash, string(role)), &apiKey)
+	if err != nil {
+		log.Err(err).Msg("Create failed")
+		return "", nil, translateError(err)
+	}
+	return key, &apiKey, nil
+}
+
+func (r *SQLKeyRepository) Lookup(ctx context.Context, key string, log zerolog.Logger) (*APIKey, error) {
+	var apiKey APIKey
+	err := scanKey(r.db.QueryRow(ctx, `SELECT `+keyColumns+` FROM api_keys WHERE hash = $1 AND revoked_at IS NULL`, hashKey(key)), &apiKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("%w: unknown or revoked API key", ErrInvalidCredentials)
+	}
+	if err != nil {
+		log.Err(err).Msg("Lookup failed")
+		return nil, translateError(err)
+	}
+	return &apiKey, nil
+}
+
+func (r *SQLKeyRepository) Revoke(ctx context.Context, id int64, log zerolog.Logger) error {
+	res, err := r.db.Exec(ctx, `UPDATE api_keys SET revoked_at = now() WHERE id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		log.Err(err).Msg("Revoke failed")
+		return translateError(err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (r *SQLKeyRepository) All(ctx context.Context, log zerolog.Logger) ([]APIKey, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+keyColumns+` FROM api_keys ORDER BY id`)
+	if err != nil {
+		log.Err(err).Msg("All failed")
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+	keys := []APIKey{}
+	for rows.Next() {
+		var apiKey APIKey
+		if err := scanKey(rows, &apiKey); err != nil {
+			log.Err(err).Msg("All failed")
+			return nil, translateError(err)
+		}
+		keys = append(keys, apiKey)
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("All failed")
+		return nil, translateError(err)
+	}
+	return keys, nil
+}
+
+// MemoryKeyRepository is a KeyRepository keeping the keys in memory, with the
+// same semantics as SQLKeyRepository. It's meant for tests and local demos,
+// and is safe for concurrent use.
+type MemoryKeyRepository struct {
+	mu     sync.RWMutex
+	lastID int64
+	keys   map[int64]APIKey
+	// hashes are the hashes of the keys by id.
+	hashes map[int64]string
+}
+
+var _ KeyRepository = (*MemoryKeyRepository)(nil)
+
+func KeyMemoryRepository() *MemoryKeyRepository {
+	return &MemoryKeyRepository{keys: map[int64]APIKey{}, hashes: map[int64]string{}}
+}
+
+func (r *MemoryKeyRepository) Create(ctx context.Context, name string, role Role, log zerolog.Logger) (string, *APIKey, error) {
+	if err := checkKey(name, role); err != nil {
+		return "", nil, err
+	}
+	key, hint, hash, err := newKey()
+	if err != nil {
+		return "", nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, other := range r.keys {
+		if other.RevokedAt == nil && other.Name == name {
+			return "", nil, fmt.Errorf("%w: API key %q already exists", storage.ErrConflict, name)
+		}
+	}
+	r.lastID++
+	apiKey := APIKey{ID: r.lastID, Name: name, Hint: hint, Role: role, CreatedAt: time.Now().Round(time.Microsecond)}
+	r.keys[apiKey.ID] = apiKey
+	r.hashes[apiKey.ID] = hash
+	return key, &apiKey, nil
+}
+
+func (r *MemoryKeyRepository) Lookup(ctx context.Context, key string, log zerolog.Logger) (*APIKey, error) {
+	hash := hashKey(key)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for id, other := range r.hashes {
+		if other == hash && r.keys[id].RevokedAt == nil {
+			apiKey := r.keys[id]
+			return &apiKey, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: unknown or revoked API key", ErrInvalidCredentials)
+}
+
+func (r *MemoryKeyRepository) Revoke(ctx context.Context, id int64, log zerolog.Logger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	apiKey, ok := r.keys[id]
+	if !ok || apiKey.RevokedAt != nil {
+		return ErrKeyNotFound
+	}
+	revokedAt := time.Now().Round(time.Microsecond)
+	apiKey.RevokedAt = &revokedAt
+	r.keys[id] = apiKey
+	return nil
+}
+
+func (r *MemoryKeyRepository) All(ctx context.Context, log zerolog.Logger) ([]APIKey, error) {
+	r.mu.RLock()
+	keys := make([]APIKey, 0, len(r.keys))
+	for _, apiKey := range r.keys {
+		keys = append(keys, apiKey)
+	}
+	r.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
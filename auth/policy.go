@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Role grants the powers of a principal.
+type Role string
+
+const (
+	// RolePromoter creates events and edits only their own.
+	RolePromoter Role = "promoter"
+	// RoleCurator edits, publishes and reviews any event.
+	RoleCurator Role = "curator"
+	// RoleAdmin can do anything, like purging the trash and managing the users and keys.
+	RoleAdmin Role = "admin"
+)
+
+// ParseRole returns the role named s, promoter when s is empty.
+func ParseRole(s string) (Role, error) {
+	switch role := Role(s); role {
+	case "":
+		return RolePromoter, nil
+	case RolePromoter, RoleCurator, RoleAdmin:
+		return role, nil
+	}
+	return "", fmt.Errorf("unknown role %q, expected promoter, curator or admin", s)
+}
+
+// Action is what a principal asks to do.
+type Action string
+
+const (
+	// ActionCreate creates events and venues.
+	ActionCreate Action = "create"
+	// ActionEdit changes, deletes or restores something, like the status of an event.
+	ActionEdit Action = "edit"
+	// ActionReview reads what isn't public, like the trash.
+	ActionReview Action = "review"
+	// ActionAdminister covers the irreversible operations and the management
+	// of the users and keys.
+	ActionAdminister Action = "administer"
+)
+
+// ErrForbidden is returned when a principal isn't allowed an action.
+var ErrForbidden = errors.New("forbidden")
+
+// Authorize returns ErrForbidden when p may not do action on what owner
+// created, owner being the String of the principal that did or empty when
+// nobody owns it.
+func Authorize(p Principal, action Action, owner string) error {
+	switch {
+	case p.Role == RoleAdmin:
+		return nil
+	case action == ActionAdminister:
+		return fmt.Errorf("%w: only admins may do that", ErrForbidden)
+	case p.Role == RoleCurator, action == ActionCreate:
+		return nil
+	case action == ActionReview:
+		return fmt.Errorf("%w: only curators and admins may do that", ErrForbidden)
+	case owner != "" && owner == p.String():
+		return nil
+	}
+	return fmt.Errorf("%w: %s may only edit their own events", ErrForbidden, p)
+}
@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// Claims are the claims of a token the verifier looks at.
+type Claims struct {
+	Subject  string   `json:"sub"`
+	Issuer   string   `json:"iss,omitempty"`
+	Audience Audience `json:"aud,omitempty"`
+	// ExpiresAt, NotBefore and IssuedAt are Unix times, zero when absent.
+	ExpiresAt int64 `json:"exp,omitempty"`
+	NotBefore int64 `json:"nbf,omitempty"`
+	IssuedAt  int64 `json:"iat,omitempty"`
+	// Role is the name of the Role of the user, promoter when empty.
+	Role string `json:"role,omitempty"`
+}
+
+// Audience is the aud claim, a single string or an array of them.
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return errors.New("aud should be a string or an array of strings")
+	}
+	*a = many
+	return nil
+}
+
+// leeway is the clock skew tolerated checking exp and nbf.
+const leeway = time.Minute
+
+// TokenVerifier verifies the JWT bearer tokens of the users, signed with HS256
+// by a shared secret or with RS256 by a key of a local JWKS file.
+type TokenVerifier struct {
+	secret []byte
+	// keys are the RS256 public keys by key id.
+	keys map[string]*rsa.PublicKey
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+	now      func() time.Time
+}
+
+// NewTokenVerifier returns a verifier of the HS256 tokens signed with secret
+// and the RS256 tokens signed by keys, either may be empty to refuse that
+// algorithm.
+func NewTokenVerifier(secret []byte, keys map[string]*rsa.PublicKey) *TokenVerifier {
+	return &TokenVerifier{secret: secret, keys: keys, now: time.Now}
+}
+
+// TokenSigner issues the HS256 tokens of the users who log in, the
+// TokenVerifier with the same secret accepts them.
+type TokenSigner struct {
+	secret []byte
+	// TTL is how long the tokens are valid.
+	TTL time.Duration
+	// Issuer and Audience, when set, are the iss and aud claims of the tokens.
+	Issuer   string
+	Audience string
+	now      func() time.Time
+}
+
+func NewTokenSigner(secret []byte, ttl time.Duration) *TokenSigner {
+	return &TokenSigner{secret: secret, TTL: ttl, now: time.Now}
+}
+
+// Sign returns a token of the subject with a role, along with its claims.
+func (s *TokenSigner) Sign(subject string, role Role) (string, *Claims, error) {
+	now := s.now()
+	claims := Claims{
+		Subject:   subject,
+		Issuer:    s.Issuer,
+		ExpiresAt: now.Add(s.TTL).Unix(),
+		IssuedAt:  now.Unix(),
+		Role:      string(role),
+	}
+	if s.Audience != "" {
+		claims.Audience = Audience{s.Audience}
+	}
+	h, err := json.Marshal(header{Algorithm: "HS256"})
+	if err != nil {
+		return "", nil, err
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		return "", nil, err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), &claims, nil
+}
+
+type header struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+func invalidToken(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidCredentials, fmt.Sprintf(format, args...))
+}
+
+// Verify checks the signature and the claims of a token, the tokens without
+// an exp or a sub are refused. The errors wrap ErrInvalidCredentials.
+func (v *TokenVerifier) Verify(token string) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("malformed token")
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, invalidToken("malformed header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("malformed signature")
+	}
+	if err := v.verifySignature(h, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, invalidToken("malformed claims: %v", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verifySignature only accepts the algorithms a key is configured for, so a
+// token can't pick "none" or sign HS256 with the public RSA key.
+func (v *TokenVerifier) verifySignature(h header, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch h.Algorithm {
+	case "HS256":
+		if len(v.secret) == 0 {
+			return invalidToken("HS256 tokens aren't accepted")
+		}
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return invalidToken("bad signature")
+		}
+		return nil
+	case "RS256":
+		key, err := v.rsaKey(h.KeyID)
+		if err != nil {
+			return err
+		}
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return invalidToken("bad signature")
+		}
+		return nil
+	}
+	return invalidToken("unsupported algorithm %q", h.Algorithm)
+}
+
+// rsaKey returns the key kid, a token without kid may only use the key of a
+// JWKS with a single one.
+func (v *TokenVerifier) rsaKey(kid string) (*rsa.PublicKey, error) {
+	if len(v.keys) == 0 {
+		return nil, invalidToken("RS256 tokens aren't accepted")
+	}
+	if kid == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+	key, ok := v.keys[kid]
+	if !ok {
+		return nil, invalidToken("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+func (v *TokenVerifier) checkClaims(claims Claims) error {
+	now := v.now()
+	switch {
+	case claims.Subject == "":
+		return invalidToken("missing sub claim")
+	case claims.ExpiresAt == 0:
+		return invalidToken("missing exp claim")
+	case now.Add(-leeway).After(time.Unix(claims.ExpiresAt, 0)):
+		return invalidToken("expired token")
+	case claims.NotBefore != 0 && now.Add(leeway).Before(time.Unix(claims.NotBefore, 0)):
+		return invalidToken("token not valid yet")
+	case v.Issuer != "" && claims.Issuer != v.Issuer:
+		return invalidToken("unexpected issuer %q", claims.Issuer)
+	}
+	if v.Audience == "" {
+		return nil
+	}
+	for _, audience := range claims.Audience {
+		if audience == v.Audience {
+			return nil
+		}
+	}
+	return invalidToken("unexpected audience")
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// jwk is an RSA key of a JWKS, the other kinds of keys are skipped.
+type jwk struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	Modulus   string `json:"n"`
+	Exponent  string `json:"e"`
+}
+
+// ParseJWKS returns the RSA signing keys of a JSON Web Key Set by key id.
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.KeyType != "RSA" || (k.Use != "" && k.Use != "sig") || (k.Algorithm != "" && k.Algorithm != "RS256") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.Modulus)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus of key %q: %w", k.KeyID, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.Exponent)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent of key %q", k.KeyID)
+		}
+		if _, ok := keys[k.KeyID]; ok {
+			return nil, fmt.Errorf("duplicated key id %q", k.KeyID)
+		}
+		keys[k.KeyID] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("the JWKS has no RS256 signing key")
+	}
+	return keys, nil
+}
+
+// LoadJWKS reads the keys of a JWKS file, see ParseJWKS.
+func LoadJWKS(path string) (map[string]*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testSecret = []byte("a secret of at least thirty-two bytes")
+
+func encodeSegment(t *testing.T, v any) string {
+	data, err := json.Marshal(v)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signHS256 returns a token of the claims signed with secret.
+func signHS256(t *testing.T, secret []byte, claims map[string]any) string {
+	signed := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signRS256 returns a token of the claims signed with key, kid is left out when empty.
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]any) string {
+	h := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if kid != "" {
+		h["kid"] = kid
+	}
+	signed := encodeSegment(t, h) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// jwks returns the JWKS of the public keys, by key id.
+func jwks(t *testing.T, keys map[string]*rsa.PrivateKey) []byte {
+	set := map[string][]map[string]string{"keys": {}}
+	for kid, key := range keys {
+		set["keys"] = append(set["keys"], map[string]string{
+			"kty": "RSA",
+			"kid": kid,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		})
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	return data
+}
+
+func TestTokenVerifier(t *testing.T) {
+	now := time.Date(2030, 5, 10, 22, 0, 0, 0, time.UTC)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys, err := ParseJWKS(jwks(t, map[string]*rsa.PrivateKey{"k1": rsaKey}))
+	require.NoError(t, err)
+
+	claims := func(changes map[string]any) map[string]any {
+		c := map[string]any{"sub": "jojo", "iss": "ondehoje", "aud": "api", "exp": now.Add(time.Hour).Unix()}
+		for name, value := range changes {
+			if value == nil {
+				delete(c, name)
+			} else {
+				c[name] = value
+			}
+		}
+		return c
+	}
+	none := encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, claims(nil)) + "."
+	hs256 := signHS256(t, testSecret, claims(nil))
+	parts := strings.Split(hs256, ".")
+	tampered := parts[0] + "." + encodeSegment(t, claims(map[string]any{"sub": "admin"})) + "." + parts[2]
+
+	testCases := []struct {
+		name    string
+		token   string
+		subject string
+	}{
+		{name: "HS256", token: hs256, subject: "jojo"},
+		{name: "RS256", token: signRS256(t, rsaKey, "k1", claims(nil)), subject: "jojo"},
+		{name: "RS256 without kid, with a single key", token: signRS256(t, rsaKey, "", claims(nil)), subject: "jojo"},
+		{name: "Audience array", token: signHS256(t, testSecret, claims(map[string]any{"aud": []string{"web", "api"}})), subject: "jojo"},
+		{name: "Expired within the leeway", token: signHS256(t, testSecret, claims(map[string]any{"exp": now.Add(-30 * time.Second).Unix()})), subject: "jojo"},
+		{name: "Expired", token: signHS256(t, testSecret, claims(map[string]any{"exp": now.Add(-time.Hour).Unix()}))},
+		{name: "Without exp", token: signHS256(t, testSecret, claims(map[string]any{"exp": nil}))},
+		{name: "Without sub", token: signHS256(t, testSecret, claims(map[string]any{"sub": nil}))},
+		{name: "Not valid yet", token: signHS256(t, testSecret, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()}))},
+		{name: "Other issuer", token: signHS256(t, testSecret, claims(map[string]any{"iss": "evil"}))},
+		{name: "Other audience", token: signHS256(t, testSecret, claims(map[string]any{"aud": "web"}))},
+		{name: "Other secret", token: signHS256(t, []byte("another secret of thirty-two bytes"), claims(nil))},
+		{name: "Other RSA key", token: signRS256(t, otherKey, "k1", claims(nil))},
+		{name: "Unknown kid", token: signRS256(t, rsaKey, "k2", claims(nil))},
+		{name: "Tampered claims", token: tampered},
+		{name: "Algorithm none", token: none},
+		{name: "Malformed", token: "not.a-token"},
+	}
+	verifier := NewTokenVerifier(testSecret, keys)
+	verifier.Issuer = "ondehoje"
+	verifier.Audience = "api"
+	verifier.now = func() time.Time { return now }
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := verifier.Verify(tc.token)
+			if tc.subject == "" {
+				assert.ErrorIs(t, err, ErrInvalidCredentials)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.subject, got.Subject)
+		})
+	}
+
+	t.Run("HS256 signed with the public key", func(t *testing.T) {
+		// the classic confusion: the RSA public key used as an HMAC secret
+		rsaOnly := NewTokenVerifier(nil, keys)
+		rsaOnly.now = verifier.now
+		_, err := rsaOnly.Verify(signHS256(t, rsaKey.N.Bytes(), claims(nil)))
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	})
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keys, err := ParseJWKS(jwks(t, map[string]*rsa.PrivateKey{"k1": rsaKey}))
+	require.NoError(t, err)
+	require.Contains(t, keys, "k1")
+	assert.True(t, rsaKey.PublicKey.Equal(keys["k1"]))
+
+	for name, data := range map[string]string{
+		"Not JSON":        `keys`,
+		"No key":          `{"keys": []}`,
+		"Only an EC key":  `{"keys": [{"kty": "EC", "kid": "e1", "crv": "P-256"}]}`,
+		"Invalid modulus": `{"keys": [{"kty": "RSA", "kid": "k1", "n": "!", "e": "AQAB"}]}`,
+	} {
+		_, err := ParseJWKS([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestTokenSigner(t *testing.T) {
+	signer := NewTokenSigner(testSecret, time.Hour)
+	signer.Issuer, signer.Audience = "ondehoje", "api"
+	token, claims, err := signer.Sign("jojo@example.com", RoleCurator)
+	require.NoError(t, err)
+	assert.Equal(t, "curator", claims.Role)
+
+	verifier := NewTokenVerifier(testSecret, nil)
+	verifier.Issuer, verifier.Audience = "ondehoje", "api"
+	verified, err := verifier.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, claims, verified)
+
+	verifier.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, err = verifier.Verify(token)
+	assert.ErrorIs(t, err, ErrInvalidCredentials, "expired after the TTL")
+}
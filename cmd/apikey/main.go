@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/config"
+	"github.com/rs/zerolog"
+)
+
+const usage = `Usage: apikey <command>
+
+Commands:
+  create [-role ROLE] NAME  create an API key for the bot NAME, printed once.
+                           ROLE is promoter (default), curator or admin
+  list                     list the API keys, the revoked ones included
+  revoke ID                stop accepting the API key ID
+
+The database is configured with the same POSTGRES_* variables as ondehoje.
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	settings := config.FromEnv()
+	dbpool, err := pgxpool.New(context.Background(), settings.DatabaseURL())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to create connection pool: %v\n", err)
+		os.Exit(1)
+	}
+	defer dbpool.Close()
+
+	if err := run(context.Background(), auth.KeySQLRepository(dbpool), flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, keys auth.KeyRepository, args []string) error {
+	log := zerolog.Nop()
+	switch args[0] {
+	case "create":
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		roleName := flags.String("role", string(auth.RolePromoter), "role of the key")
+		if err := flags.Parse(args[1:]); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return fmt.Errorf("expected the name of the key")
+		}
+		role, err := auth.ParseRole(*roleName)
+		if err != nil {
+			return err
+		}
+		key, apiKey, err := keys.Create(ctx, flags.Arg(0), role, log)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Created %s key %d for %s, it won't be shown again:\n", apiKey.Role, apiKey.ID, apiKey.Name)
+		fmt.Println(key)
+		return nil
+	case "list":
+		all, err := keys.All(ctx, log)
+		if err != nil {
+			return err
+		}
+		for _, k := range all {
+			state := "active"
+			if k.RevokedAt != nil {
+				state = "revoked " + k.RevokedAt.Format("2006-01-02 15:04:05 MST")
+			}
+			fmt.Printf("%-4d %-30s %-8s %s... created %s, %s\n", k.ID, k.Name, k.Role, k.Hint, k.CreatedAt.Format("2006-01-02 15:04:05 MST"), state)
+		}
+		return nil
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("expected the id of the key")
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", args[1])
+		}
+		if err := keys.Revoke(ctx, id, log); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked key %d\n", id)
+		return nil
+	}
+	flag.Usage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
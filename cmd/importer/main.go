@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	_ "time/tzdata" // the alpine image ships without a zoneinfo database
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/perebaj/ondehj/config"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/importer"
+	"github.com/rs/zerolog"
+)
+
+const usage = `Usage: importer [flags] <file or URL>...
+
+Imports the events of iCalendar (.ics) files or URLs, webcal:// included.
+Importing a calendar again updates the events it imported before, matched by
+their UID, and reports how many events were created, updated and skipped.
+
+The database is configured with the same POSTGRES_* variables as ondehoje, and
+the floating times of the calendars are in its TIMEZONE.
+
+Flags:
+`
+
+func main() {
+	horizonDays := flag.Int("horizon-days", int(importer.DefaultHorizon.Hours()/24), "import the occurrences of recurring events up to this number of days ahead")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 || *horizonDays < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	settings := config.FromEnv()
+	location, err := time.LoadLocation(settings.Timezone)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to load timezone %q: %v\n", settings.Timezone, err)
+		os.Exit(1)
+	}
+	dbpool, err := pgxpool.New(context.Background(), settings.DatabaseURL())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to create connection pool: %v\n", err)
+		os.Exit(1)
+	}
+	defer dbpool.Close()
+
+	im := importer.Importer{
+		Events:   event.EventSQLRepository(dbpool),
+		Location: location,
+		Horizon:  time.Duration(*horizonDays) * 24 * time.Hour,
+	}
+	log := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+	var total importer.Report
+	failed := false
+	for _, source := range flag.Args() {
+		report, err := run(event.WithActor(context.Background(), "importer"), im, source, log)
+		total = total.Add(report)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", source, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s: %s\n", source, report)
+	}
+	if flag.NArg() > 1 {
+		fmt.Printf("Total: %s\n", total)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, im importer.Importer, source string, log zerolog.Logger) (importer.Report, error) {
+	r, err := open(ctx, source)
+	if err != nil {
+		return importer.Report{}, err
+	}
+	defer r.Close()
+	return im.Import(ctx, r, log.With().Str("source", source).Logger())
+}
+
+// open returns the content of a local file, or of an http(s) or webcal URL.
+func open(ctx context.Context, source string) (io.ReadCloser, error) {
+	if strings.HasPrefix(source, "webcal://") {
+		source = "https://" + strings.TrimPrefix(source, "webcal://")
+	}
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return cancelOnClose{res.Body, cancel}, nil
+}
+
+// cancelOnClose releases the context of a response when its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
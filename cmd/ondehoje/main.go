@@ -2,75 +2,105 @@ package main
 
 import (
 	"context"
+	"crypto/rsa"
 	"fmt"
 	"net/http"
 	"os"
+	"path/filepath"
 	"time"
+	_ "time/tzdata" // the alpine image ships without a zoneinfo database
 
 	"github.com/jackc/pgx/v5/pgxpool" // concurrency safe
 	"github.com/perebaj/ondehj/api"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/config"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/user"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
 	"golang.org/x/exp/slog"
 )
 
-func getEnvWithDefault(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if value == "" {
-		return defaultValue
-	}
-	return value
-}
-
-type Settings struct {
-	DatabaseHost     string
-	DatabasePort     string
-	DatabaseUser     string
-	DatabasePassword string
-	ServicePort      string
-	DatabaseName     string
-	SSLMode          string
-}
-
-// centralize all settings in a single struct
-//TODO(jojo): Remvoe the broken env vars to a single database url
-var settings = Settings{
-	DatabaseHost:     getEnvWithDefault("POSTGRES_HOST", "localhost"),
-	DatabasePort:     getEnvWithDefault("POSTGRES_PORT", "5432"),
-	DatabaseUser:     getEnvWithDefault("POSTGRES_USER", "postgres"),
-	DatabasePassword: getEnvWithDefault("POSTGRES_PASSWORD", "example_password"),
-	ServicePort:      getEnvWithDefault("PORT", "8000"),
-	DatabaseName:     getEnvWithDefault("POSTGRES_DB", "example_db"),
-	SSLMode:          getEnvWithDefault("POSTGRES_SSLMODE", "disable"),
-}
-
 func main() {
-	databaseUrl := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		settings.DatabaseUser,
-		settings.DatabasePassword,
-		settings.DatabaseHost,
-		settings.DatabasePort,
-		settings.DatabaseName,
-		settings.SSLMode,
-	)
+	settings := config.FromEnv()
 	slog.Info(slog.LevelInfo.String())
 	handler := slog.HandlerOptions{AddSource: true, Level: slog.LevelInfo}.NewJSONHandler(os.Stdout)
 	logger := slog.New(handler)
 	slog.SetDefault(logger)
 
-	dbpool, err := pgxpool.New(context.Background(), databaseUrl)
+	var eventRepo event.Repository
+	var venueRepo venue.Repository
+	var keyRepo auth.KeyRepository
+	var userRepo user.Repository
+	switch settings.Storage {
+	case "memory":
+		slog.Warn("Using the in-memory storage, events are lost on restart")
+		venues := venue.VenueMemoryRepository()
+		eventRepo, venueRepo = event.EventMemoryRepository(venues), venues
+		keys := auth.KeyMemoryRepository()
+		// there's no other way to get a key of the memory storage
+		key, _, err := keys.Create(context.Background(), "dev", auth.RoleAdmin, zerolog.Nop())
+		if err == nil {
+			err = writeDevKey(key)
+		}
+		if err != nil {
+			slog.Error(fmt.Sprintf("Unable to create the dev API key: %v", err))
+			os.Exit(1)
+		}
+		slog.Warn(fmt.Sprintf("Wrote the admin API key of the in-memory storage to %s", devKeyFile))
+		keyRepo = keys
+		userRepo = user.UserMemoryRepository()
+	case "postgres":
+		dbpool, err := pgxpool.New(context.Background(), settings.DatabaseURL())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Unable to create connection pool: %v\n", err)
+			os.Exit(1)
+		}
+		err = dbpool.Ping(context.Background())
+		if err != nil {
+			slog.Error(fmt.Sprintf("Unable to ping database: %v\n", err))
+			os.Exit(1)
+		}
+		slog.Info("Connected successfully to database")
+		defer dbpool.Close()
+		eventRepo = event.EventSQLRepository(dbpool)
+		venueRepo = venue.VenueSQLRepository(dbpool)
+		keyRepo = auth.KeySQLRepository(dbpool)
+		userRepo = user.UserSQLRepository(dbpool)
+	default:
+		slog.Error(fmt.Sprintf("Unknown storage %q, expected postgres or memory", settings.Storage))
+		os.Exit(1)
+	}
+
+	location, err := time.LoadLocation(settings.Timezone)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to create connection pool: %v\n", err)
+		slog.Error(fmt.Sprintf("Unable to load timezone %q: %v", settings.Timezone, err))
 		os.Exit(1)
 	}
-	err = dbpool.Ping(context.Background())
+
+	trashRetention, err := time.ParseDuration(settings.TrashRetention)
+	if err != nil || trashRetention <= 0 {
+		slog.Error(fmt.Sprintf("Invalid trash retention %q, expected a positive duration such as 720h", settings.TrashRetention))
+		os.Exit(1)
+	}
+
+	tokens, err := tokenVerifier(settings)
+	if err != nil {
+		slog.Error(fmt.Sprintf("Unable to verify bearer tokens: %v", err))
+		os.Exit(1)
+	}
+	authenticator := &auth.Authenticator{Keys: keyRepo, Tokens: tokens}
+
+	users, err := userService(settings, userRepo)
 	if err != nil {
-		slog.Error(fmt.Sprintf("Unable to ping database: %v\n", err))
+		slog.Error(fmt.Sprintf("Unable to set up the user accounts: %v", err))
 		os.Exit(1)
 	}
-	slog.Info("Connected successfully to database")
-	defer dbpool.Close()
+	if users != nil {
+		authenticator.Accounts = users
+	}
 
-	mux := api.HandlerFactory(dbpool)
+	mux := api.HandlerFactory(eventRepo, venueRepo, api.Config{Location: location, TrashRetention: trashRetention, Authenticator: authenticator, Users: users})
 	slog.Info(fmt.Sprintf("Starting server on port %s", settings.ServicePort))
 	srv := http.Server{
 		Addr:         fmt.Sprintf(":%s", settings.ServicePort),
@@ -84,3 +114,119 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// minSecretLength is the shortest HS256 secret accepted, as long as the hash.
+const minSecretLength = 32
+
+// tokenVerifier returns the verifier of the bearer tokens configured by the
+// settings, or nil when they configure neither a secret nor a JWKS file.
+func tokenVerifier(settings config.Settings) (*auth.TokenVerifier, error) {
+	if settings.JWTSecret == "" && settings.JWKSFile == "" {
+		slog.Warn("Neither JWT_SECRET nor JWKS_FILE is set, bearer tokens are refused")
+		return nil, nil
+	}
+	if settings.JWTSecret != "" && len(settings.JWTSecret) < minSecretLength {
+		return nil, fmt.Errorf("JWT_SECRET should have at least %d bytes", minSecretLength)
+	}
+	var keys map[string]*rsa.PublicKey
+	if settings.JWKSFile != "" {
+		var err error
+		keys, err = auth.LoadJWKS(settings.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	verifier := auth.NewTokenVerifier([]byte(settings.JWTSecret), keys)
+	verifier.Issuer = settings.JWTIssuer
+	verifier.Audience = settings.JWTAudience
+	return verifier, nil
+}
+
+// userService returns the service of the user accounts configured by the
+// settings, or nil when there's no JWT_SECRET to sign their sessions.
+func userService(settings config.Settings, users user.Repository) (*user.Service, error) {
+	if settings.JWTSecret == "" {
+		slog.Warn("JWT_SECRET isn't set, users can't sign up nor log in")
+		return nil, nil
+	}
+	ttl, err := time.ParseDuration(settings.SessionTTL)
+	if err != nil || ttl <= 0 {
+		return nil, fmt.Errorf("invalid session TTL %q, expected a positive duration such as 24h", settings.SessionTTL)
+	}
+	signer := auth.NewTokenSigner([]byte(settings.JWTSecret), ttl)
+	signer.Issuer = settings.JWTIssuer
+	signer.Audience = settings.JWTAudience
+	mailer, err := newMailer(settings)
+	if err != nil {
+		return nil, err
+	}
+	return user.NewService(users, mailer, signer, settings.AppURL)
+}
+
+// devMailFile is where the emails are written by default with the in-memory
+// storage, to follow the links locally.
+var devMailFile = filepath.Join(os.TempDir(), "ondehoje-mail.txt")
+
+// devKeyFile is where the admin API key of the in-memory storage is written.
+// It's never logged, the logs may be shipped elsewhere.
+var devKeyFile = filepath.Join(os.TempDir(), "ondehoje-api-key.txt")
+
+// writeDevKey replaces the content of devKeyFile with key, readable by the
+// user running the server only.
+func writeDevKey(key string) error {
+	f, err := os.OpenFile(devKeyFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// the mode of an existing file isn't changed by OpenFile
+	if err := f.Chmod(0o600); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, key)
+	return err
+}
+
+// newMailer returns the mailer of the settings. The emails hold the links
+// logging in to the accounts, so they're never written to the logs, and
+// MAILER must be set but with the in-memory storage.
+func newMailer(settings config.Settings) (user.Mailer, error) {
+	dev := settings.Storage == "memory"
+	mailer := settings.Mailer
+	if mailer == "" {
+		if !dev {
+			return nil, fmt.Errorf("MAILER is required, expected smtp or file")
+		}
+		mailer = "file"
+	}
+	switch mailer {
+	case "smtp":
+		if settings.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required to send emails through SMTP")
+		}
+		return &user.SMTPMailer{
+			Host:     settings.SMTPHost,
+			Port:     settings.SMTPPort,
+			Username: settings.SMTPUsername,
+			Password: settings.SMTPPassword,
+			From:     settings.MailFrom,
+		}, nil
+	case "file":
+		path := settings.MailFile
+		if path == "" {
+			if !dev {
+				return nil, fmt.Errorf("MAIL_FILE is required to write the emails to a file")
+			}
+			path = devMailFile
+		}
+		// the file stays open as long as the server runs
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		slog.Warn(fmt.Sprintf("Emails are written to %s instead of being sent", path))
+		return user.NewWriterMailer(f, settings.MailFrom), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q, expected smtp or file", mailer)
+	}
+}
@@ -0,0 +1,97 @@
+// Package config reads the settings shared by the ondehoje binaries from the environment.
+package config
+
+import (
+	"fmt"
+	"os"
+)
+
+func getEnvWithDefault(key, defaultValue string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+type Settings struct {
+	DatabaseHost     string
+	DatabasePort     string
+	DatabaseUser     string
+	DatabasePassword string
+	ServicePort      string
+	DatabaseName     string
+	SSLMode          string
+	Timezone         string
+	// Storage is where events are kept: "postgres", or "memory" to run
+	// without a database, losing everything on restart.
+	Storage string
+	// TrashRetention is how long the deleted events can be restored before
+	// they're purged, as a Go duration.
+	TrashRetention string
+	// JWTSecret verifies the HS256 bearer tokens, none are accepted when empty.
+	JWTSecret string
+	// JWKSFile is the path of a JWKS file with the keys verifying the RS256
+	// bearer tokens, none are accepted when empty.
+	JWKSFile string
+	// JWTIssuer and JWTAudience, when set, must match the iss and aud claims of the tokens.
+	JWTIssuer   string
+	JWTAudience string
+	// SessionTTL is how long the tokens of the users who log in are valid,
+	// as a Go duration.
+	SessionTTL string
+	// AppURL is where the links sent by email point to.
+	AppURL string
+	// Mailer is how the emails are sent: "smtp", or "file" to write them to
+	// MailFile. It has no default, the emails hold the links logging in to the
+	// accounts, but with STORAGE=memory they're written to a file.
+	Mailer       string
+	MailFile     string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+}
+
+// FromEnv centralizes all settings in a single struct.
+// TODO(jojo): Remove the broken env vars to a single database url
+func FromEnv() Settings {
+	return Settings{
+		DatabaseHost:     getEnvWithDefault("POSTGRES_HOST", "localhost"),
+		DatabasePort:     getEnvWithDefault("POSTGRES_PORT", "5432"),
+		DatabaseUser:     getEnvWithDefault("POSTGRES_USER", "postgres"),
+		DatabasePassword: getEnvWithDefault("POSTGRES_PASSWORD", "example_password"),
+		ServicePort:      getEnvWithDefault("PORT", "8000"),
+		DatabaseName:     getEnvWithDefault("POSTGRES_DB", "example_db"),
+		SSLMode:          getEnvWithDefault("POSTGRES_SSLMODE", "disable"),
+		Timezone:         getEnvWithDefault("TIMEZONE", "America/Sao_Paulo"),
+		Storage:          getEnvWithDefault("STORAGE", "postgres"),
+		TrashRetention:   getEnvWithDefault("TRASH_RETENTION", "720h"),
+		JWTSecret:        os.Getenv("JWT_SECRET"),
+		JWKSFile:         os.Getenv("JWKS_FILE"),
+		JWTIssuer:        os.Getenv("JWT_ISSUER"),
+		JWTAudience:      os.Getenv("JWT_AUDIENCE"),
+		SessionTTL:       getEnvWithDefault("SESSION_TTL", "24h"),
+		AppURL:           getEnvWithDefault("APP_URL", "http://localhost:8000"),
+		Mailer:           os.Getenv("MAILER"),
+		MailFile:         os.Getenv("MAIL_FILE"),
+		MailFrom:         getEnvWithDefault("MAIL_FROM", "ondehoje <noreply@ondehoje.local>"),
+		SMTPHost:         os.Getenv("SMTP_HOST"),
+		SMTPPort:         getEnvWithDefault("SMTP_PORT", "587"),
+		SMTPUsername:     os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:     os.Getenv("SMTP_PASSWORD"),
+	}
+}
+
+func (s Settings) DatabaseURL() string {
+	return fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
+		s.DatabaseUser,
+		s.DatabasePassword,
+		s.DatabaseHost,
+		s.DatabasePort,
+		s.DatabaseName,
+		s.SSLMode,
+	)
+}
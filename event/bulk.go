@@ -0,0 +1,137 @@
+package event
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// BulkResult is the outcome of one of the events given to CreateMany: the
+// created Event, or why it wasn't created. Both are nil for the events of a
+// rolled back atomic batch that didn't fail themselves.
+type BulkResult struct {
+	Event *Event
+	Err   error
+}
+
+// errRolledBack aborts the transaction of an atomic batch, the failure is in the results.
+var errRolledBack = errors.New("batch rolled back")
+
+// rowError reports whether err is the fault of the event being written, and
+// not of the storage.
+func rowError(err error) bool {
+	var verr *ValidationError
+	return errors.As(err, &verr) || errors.Is(err, ErrConflict) || errors.Is(err, ErrConstraintViolation)
+}
+
+func (r *SQLRepository) CreateMany(ctx context.Context, events []Event, atomic bool, log zerolog.Logger) ([]BulkResult, error) {
+	results := make([]BulkResult, len(events))
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		for i := range events {
+			e := events[i]
+			e.SourceUID = ""
+			var err error
+			if atomic {
+				err = insertEvent(ctx, tx, &e)
+			} else {
+				// a savepoint, so a failure doesn't abort the transaction
+				err = pgx.BeginFunc(ctx, tx, func(savepoint pgx.Tx) error {
+					return insertEvent(ctx, savepoint, &e)
+				})
+			}
+			if err == nil {
+				results[i].Event = &e
+				continue
+			}
+			err = translateError(err)
+			if !rowError(err) {
+				return err
+			}
+			results[i].Err = err
+			if atomic {
+				return errRolledBack
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errRolledBack) {
+		for i := range results {
+			results[i].Event = nil
+		}
+		return results, nil
+	}
+	if err != nil {
+		log.Err(err).Msg("CreateMany failed")
+		return nil, translateError(err)
+	}
+	return results, nil
+}
+
+func (r *SQLRepository) Each(ctx context.Context, log zerolog.Logger, fn func(Event) error) error {
+	rows, err := r.db.Query(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.deleted_at IS NULL ORDER BY e.id`)
+	if err != nil {
+		log.Err(err).Msg("Each failed")
+		return translateError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var event Event
+		if err := scanEvent(rows, &event); err != nil {
+			log.Err(err).Msg("Each failed")
+			return translateError(err)
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("Each failed")
+		return translateError(err)
+	}
+	return nil
+}
+
+func (r *MemoryRepository) CreateMany(ctx context.Context, events []Event, atomic bool, log zerolog.Logger) ([]BulkResult, error) {
+	results := make([]BulkResult, len(events))
+	for i, e := range events {
+		if err := r.checkVenue(ctx, e, log); err != nil {
+			results[i].Err = err
+			if atomic {
+				return results, nil
+			}
+		}
+	}
+	r.mu.Lock()
+	for i, e := range events {
+		if results[i].Err == nil {
+			e.SourceUID = ""
+			inserted := r.insert(ctx, e)
+			results[i].Event = &inserted
+		}
+	}
+	r.mu.Unlock()
+	for i := range results {
+		if results[i].Event != nil {
+			e := r.withVenue(ctx, *results[i].Event, log)
+			results[i].Event = &e
+		}
+	}
+	return results, nil
+}
+
+// Each calls fn with every event ordered by id. The events are copied first,
+// so fn may call the repository.
+func (r *MemoryRepository) Each(ctx context.Context, log zerolog.Logger, fn func(Event) error) error {
+	events, err := r.All(ctx, log)
+	if err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
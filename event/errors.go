@@ -0,0 +1,49 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/perebaj/ondehj/storage"
+)
+
+var (
+	ErrDeleteFailed = errors.New("Delete failed")
+	// ErrNotFound is returned when an event doesn't exist, it wraps pgx.ErrNoRows.
+	ErrNotFound = fmt.Errorf("event not found: %w", pgx.ErrNoRows)
+	// ErrGone is returned when an event is in the trash, it wraps ErrNotFound
+	// since the event can't be read nor written until it's restored.
+	ErrGone = fmt.Errorf("event was deleted: %w", ErrNotFound)
+	// ErrVersionMismatch is returned when a conditional write targets an outdated version of an event.
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrConflict is returned when a write clashes with existing data, like a duplicated unique value.
+	ErrConflict = storage.ErrConflict
+	// ErrConstraintViolation is returned when a write breaks a database constraint
+	// the validation didn't catch.
+	ErrConstraintViolation = storage.ErrConstraintViolation
+	// ErrUnavailable is returned when the database can't be reached, the operation may be retried.
+	ErrUnavailable = storage.ErrUnavailable
+)
+
+// translateError turns the errors returned by pgx into the errors of this package,
+// so callers can tell a missing event from an outage without knowing about pgx.
+func translateError(err error) error {
+	if errors.Is(err, ErrGone) {
+		// it wraps pgx.ErrNoRows, but tells more than ErrNotFound
+		return ErrGone
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.ConstraintName == "events_venue_id_fkey" {
+		return unknownVenue()
+	}
+	return storage.TranslateError(err, ErrNotFound)
+}
+
+// unknownVenue is the error of a write referencing a venue that doesn't exist.
+func unknownVenue() error {
+	verr := ValidationError{Subject: "event"}
+	verr.Add("venue_id", "doesn't match any venue")
+	return &verr
+}
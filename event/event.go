@@ -2,18 +2,15 @@ package event
 
 import (
 	"context"
-	"errors"
-	"fmt"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/perebaj/ondehj/venue"
 	"github.com/rs/zerolog"
 )
 
-var (
-	ErrDeleteFailed = errors.New("Delete failed")
-)
-
 type Event struct {
 	ID            int64     `json:"id"`
 	Title         string    `json:"title"`
@@ -22,15 +19,135 @@ type Event struct {
 	StartTime     time.Time `json:"start_time"`
 	EndTime       time.Time `json:"end_time"`
 	InstagramPage string    `json:"instagram_page"`
+	// Tags are the scenes of the event, like techno or free-entry, in their
+	// canonical form (see NormalizeTag) and sorted.
+	Tags []string `json:"tags"`
+	// Status is where the event is in its lifecycle, it's set on creation then
+	// changed with Repository.Transition only. New events are published by default.
+	Status Status `json:"status"`
+	// StatusReason tells why the event got its status, like why it's cancelled.
+	StatusReason string `json:"status_reason,omitempty"`
+	// Recurrence is the RRULE (RFC 5545) of a recurring event, such as
+	// FREQ=WEEKLY;BYDAY=TH, the event then being its first occurrence. The
+	// listings return the occurrences of the series instead of the series.
+	Recurrence string `json:"recurrence,omitempty"`
+	// ExceptionDates are the starts of the occurrences of the series that don't take place.
+	ExceptionDates []time.Time `json:"exception_dates,omitempty"`
+	// Overrides cancel or move some occurrences of the series, they're set with
+	// Repository.SetOverride and ignored on writes.
+	Overrides []Override `json:"overrides,omitempty"`
+	// Occurrence is the original start of an occurrence of a series, only set
+	// by List on the occurrences it expands.
+	Occurrence *time.Time `json:"occurrence,omitempty"`
+	// VenueID references the venue of the event, Location is then just a hint.
+	VenueID *int64 `json:"venue_id"`
+	// Venue is the venue referenced by VenueID, filled by the repositories and ignored on writes.
+	Venue *venue.Venue `json:"venue,omitempty"`
+	// DistanceKm is the distance from the venue to Filter.Near, only set by List around a position.
+	DistanceKm *float64 `json:"distance_km,omitempty"`
+	// Snippet is an HTML excerpt with the matches of Filter.Query within <mark>
+	// tags, only set by List when searching.
+	Snippet string `json:"snippet,omitempty"`
+	// SourceUID identifies the event in the calendar it was imported from, it's
+	// only set by Import.
+	SourceUID string `json:"source_uid,omitempty"`
+	// rank is how well the event matches Filter.Query, for the cursors.
+	rank float64
+	// CreatedBy is the actor who created the event (see WithActor), who owns
+	// it. It's empty when the event was created anonymously, it's set by the
+	// repositories and ignored on writes.
+	CreatedBy string    `json:"created_by,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt is when the event was moved to the trash, only set on the
+	// events returned by Repository.Trash.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Version is incremented on every update, it's used for optimistic concurrency.
+	Version int64 `json:"version"`
 }
 
 type Repository interface {
 	Create(ctx context.Context, event Event, log zerolog.Logger) (*Event, error)
-	Migrate() error
-	Delete(ctx context.Context, id int64, log zerolog.Logger) error
+	// Delete moves an event to the trash, it's then left out everywhere but
+	// Trash and ErrGone is returned when it's deleted again. ErrNotFound is
+	// returned when the event doesn't exist, or was purged. When version isn't
+	// zero, the event is deleted only if it's still at that version, otherwise
+	// ErrVersionMismatch is returned.
+	Delete(ctx context.Context, id int64, version int64, log zerolog.Logger) error
+	// Trash returns the deleted events, the most recently deleted first.
+	Trash(ctx context.Context, log zerolog.Logger) ([]Event, error)
+	// Restore takes an event out of the trash, returning ErrNotFound when it
+	// isn't there.
+	Restore(ctx context.Context, id int64, log zerolog.Logger) (*Event, error)
+	// Purge permanently removes the events deleted before the given instant,
+	// and returns how many there were.
+	Purge(ctx context.Context, before time.Time, log zerolog.Logger) (int64, error)
+	// History returns the changes of an event, the oldest first. Every write
+	// records its change in the same transaction, with the actor of ctx (see
+	// WithActor). The history outlives the purged events, ErrNotFound is
+	// returned when the event never existed.
+	History(ctx context.Context, id int64, log zerolog.Logger) ([]Change, error)
+	// Revert updates an event with its editable fields as they were at a
+	// version, which makes a new version. The status and the overrides are
+	// left as they are. ErrVersionNotFound is returned when the history
+	// doesn't have the version.
+	Revert(ctx context.Context, id int64, version int64, log zerolog.Logger) (*Event, error)
 	All(ctx context.Context, log zerolog.Logger) ([]Event, error)
+	List(ctx context.Context, filter Filter, log zerolog.Logger) (*Page, error)
 	GetByID(ctx context.Context, id int64, log zerolog.Logger) (*Event, error)
+	// Update overwrites an event. When newEvent.Version isn't zero, the event is updated
+	// only if it's still at that version, otherwise ErrVersionMismatch is returned.
 	Update(ctx context.Context, id int64, newEvent Event, log zerolog.Logger) (*Event, error)
+	// Patch updates only the fields set in patch, atomically. Like Update, it's
+	// conditional when patch.Version isn't zero. The patched event is validated
+	// and a *ValidationError is returned when it's invalid.
+	Patch(ctx context.Context, id int64, patch Patch, log zerolog.Logger) (*Event, error)
+	// TagCounts returns every tag with the number of events still running after
+	// since, recurring events counting as running. Only published events count.
+	TagCounts(ctx context.Context, since time.Time, log zerolog.Logger) ([]TagCount, error)
+	// Import creates or updates the event with the SourceUID of event, and
+	// reports which. The venue of an imported event is kept when event has none.
+	// A deleted event stays in the trash, it's reported unchanged.
+	Import(ctx context.Context, event Event, log zerolog.Logger) (*Event, ImportResult, error)
+	// CreateMany creates events in a single transaction, and reports the outcome
+	// of each one. When atomic, the first failure rolls back the whole batch.
+	// The events aren't validated, the error is only set when the storage fails.
+	CreateMany(ctx context.Context, events []Event, atomic bool, log zerolog.Logger) ([]BulkResult, error)
+	// Each calls fn with every event ordered by id, streaming them from the
+	// storage. It stops at the first error of fn and returns it.
+	Each(ctx context.Context, log zerolog.Logger, fn func(Event) error) error
+	// SetOverride overrides an occurrence of a recurring event, replacing its
+	// previous override. ErrNotRecurring is returned when the event has no
+	// recurrence. The occurrence isn't checked against the recurrence, an
+	// override of a start that isn't an occurrence is just ignored.
+	SetOverride(ctx context.Context, id int64, override Override, log zerolog.Logger) (*Event, error)
+	// Transition changes the status of an event, recording why. It returns
+	// ErrInvalidTransition when the state machine doesn't allow it. Like
+	// Delete, it's conditional when version isn't zero.
+	Transition(ctx context.Context, id int64, to Status, reason string, version int64, log zerolog.Logger) (*Event, error)
+	// DeleteOverride restores an occurrence of a recurring event, returning
+	// ErrOverrideNotFound when it isn't overridden.
+	DeleteOverride(ctx context.Context, id int64, occurrence time.Time, log zerolog.Logger) (*Event, error)
+	// Owner returns the CreatedBy of an event, even when it's in the trash, to
+	// check who may change it.
+	Owner(ctx context.Context, id int64, log zerolog.Logger) (string, error)
+}
+
+// columns lists the columns of the events aliased as e, joined with their
+// venues aliased as v, in the order scanEvent reads them.
+const columns = `e.id, e.title, e.description, e.location, e.start_time, e.end_time, e.instagram_page, e.created_at, e.updated_at, e.version, e.deleted_at, e.created_by, e.status, e.status_reason, ` + tagsColumn + `, coalesce(e.source_uid, ''), coalesce(e.recurrence, ''), e.exception_dates, ` + overridesColumn + `, e.venue_id, ` + venue.JoinedColumns
+
+// joinVenues follows the events table in the FROM clauses, to read the events
+// with their venues.
+const joinVenues = ` e LEFT JOIN venues v ON v.id = e.venue_id`
+
+// scanEvent reads the columns, followed by the extra ones.
+func scanEvent(row pgx.Row, event *Event, extra ...any) error {
+	var joined venue.Joined
+	dest := append([]any{&event.ID, &event.Title, &event.Description, &event.Location, &event.StartTime, &event.EndTime, &event.InstagramPage, &event.CreatedAt, &event.UpdatedAt, &event.Version, &event.DeletedAt, &event.CreatedBy, &event.Status, &event.StatusReason, &event.Tags, &event.SourceUID, &event.Recurrence, &event.ExceptionDates, &event.Overrides, &event.VenueID}, joined.Dest()...)
+	err := row.Scan(append(dest, extra...)...)
+	event.Venue = joined.Venue()
+	return err
 }
 
 type SQLRepository struct {
@@ -41,89 +158,281 @@ func EventSQLRepository(db *pgxpool.Pool) *SQLRepository {
 	return &SQLRepository{db: db}
 }
 
-func (r *SQLRepository) Update(ctx context.Context, id int64, newEvent Event, log zerolog.Logger) (*Event, error) {
+// querier is implemented by both *pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
 
-	err := r.db.QueryRow(ctx,
-		`UPDATE events SET title = $1, description = $2, location = $3, instagram_page = $4, start_time = $5, end_time = $6 WHERE id = $7 RETURNING id`,
-		newEvent.Title, newEvent.Description, newEvent.Location, newEvent.InstagramPage, newEvent.StartTime, newEvent.EndTime, id).Scan(
-		&newEvent.ID)
+// getEvent reads the event id, unless it's in the trash.
+func getEvent(ctx context.Context, db querier, id int64, event *Event) error {
+	return scanEvent(db.QueryRow(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.id = $1 AND e.deleted_at IS NULL`, id), event)
+}
+
+// lockEvent reads the event id for update, even when it's in the trash. db
+// must be a transaction.
+func lockEvent(ctx context.Context, db querier, id int64, event *Event) error {
+	return scanEvent(db.QueryRow(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.id = $1 FOR UPDATE OF e`, id), event)
+}
+
+// lockLiveEvent is lockEvent returning ErrGone for the events in the trash.
+func lockLiveEvent(ctx context.Context, db querier, id int64, event *Event) error {
+	if err := lockEvent(ctx, db, id, event); err != nil {
+		return err
+	}
+	if event.DeletedAt != nil {
+		return ErrGone
+	}
+	return nil
+}
+
+// updateEvent overwrites current, locked by lockEvent, with newEvent and
+// records the change as op. db should be a transaction, the event and its
+// tags are written separately. The overrides are kept, unless the event isn't
+// recurring anymore.
+func updateEvent(ctx context.Context, db querier, current Event, newEvent *Event, op Operation) error {
+	recurrence := normalizeRecurrence(newEvent.Recurrence)
+	_, err := db.Exec(ctx,
+		`UPDATE events SET title = $1, description = $2, location = $3, instagram_page = $4, start_time = $5, end_time = $6, venue_id = $8,
+			recurrence = nullif($9, ''), exception_dates = $10, updated_at = now(), version = version + 1
+		WHERE id = $7`,
+		newEvent.Title, newEvent.Description, newEvent.Location, newEvent.InstagramPage, newEvent.StartTime, newEvent.EndTime, current.ID, newEvent.VenueID,
+		recurrence, normalizeExceptionDates(newEvent.ExceptionDates))
+	if err != nil {
+		return err
+	}
+	if err := setTags(ctx, db, current.ID, newEvent.Tags); err != nil {
+		return err
+	}
+	if recurrence == "" {
+		if _, err := db.Exec(ctx, `DELETE FROM event_overrides WHERE event_id = $1`, current.ID); err != nil {
+			return err
+		}
+	}
+	if err := getEvent(ctx, db, current.ID, newEvent); err != nil {
+		return err
+	}
+	return record(ctx, db, op, &current, newEvent)
+}
 
+func (r *SQLRepository) Update(ctx context.Context, id int64, newEvent Event, log zerolog.Logger) (*Event, error) {
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockLiveEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		if newEvent.Version != 0 && newEvent.Version != current.Version {
+			return ErrVersionMismatch
+		}
+		return updateEvent(ctx, tx, current, &newEvent, OperationUpdate)
+	})
 	if err != nil {
 		log.Err(err).Msg("Update failed")
-		return nil, err
+		return nil, translateError(err)
 	}
 	return &newEvent, nil
 
 }
 
+func (r *SQLRepository) Patch(ctx context.Context, id int64, patch Patch, log zerolog.Logger) (*Event, error) {
+	var patched Event
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockLiveEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		if patch.Version != 0 && patch.Version != current.Version {
+			return ErrVersionMismatch
+		}
+		patched = patch.Apply(current)
+		if err := patched.Validate(); err != nil {
+			return err
+		}
+		return updateEvent(ctx, tx, current, &patched, OperationUpdate)
+	})
+	if err != nil {
+		log.Err(err).Msg("Patch failed")
+		return nil, translateError(err)
+	}
+	return &patched, nil
+}
+
+// GetByID returns ErrNotFound when the event doesn't exist, and ErrGone when it's in the trash.
 func (r *SQLRepository) GetByID(ctx context.Context, id int64, log zerolog.Logger) (*Event, error) {
 	var event Event
-	err := r.db.QueryRow(
-		ctx,
-		`SELECT id, title, description, location, start_time, end_time, instagram_page FROM events WHERE id = $1`, id).Scan(&event.ID, &event.Title, &event.Description, &event.Location, &event.StartTime, &event.EndTime, &event.InstagramPage)
-
+	err := scanEvent(r.db.QueryRow(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.id = $1`, id), &event)
+	if err == nil && event.DeletedAt != nil {
+		return nil, ErrGone
+	}
 	if err != nil {
 		log.Err(err).Msg("GetByID failed")
-		return nil, err
+		return nil, translateError(err)
 	}
 	return &event, nil
 }
 
-func (r *SQLRepository) Create(ctx context.Context, event Event, log zerolog.Logger) (*Event, error) {
+func (r *SQLRepository) Owner(ctx context.Context, id int64, log zerolog.Logger) (string, error) {
+	var owner string
+	err := r.db.QueryRow(ctx, `SELECT created_by FROM events WHERE id = $1`, id).Scan(&owner)
+	if err != nil {
+		log.Err(err).Msg("Owner failed")
+		return "", translateError(err)
+	}
+	return owner, nil
+}
+
+// insertEvent inserts event and its tags, then reads it back and records its
+// creation. db should be a transaction. Events are published unless they have
+// another status, and owned by the actor of ctx.
+func insertEvent(ctx context.Context, db querier, event *Event) error {
+	if event.Status == "" {
+		event.Status = StatusPublished
+	}
 	var id int64
-	err := r.db.QueryRow(ctx, `
-		INSERT INTO events (title, description, location, instagram_page, start_time, end_time) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
-		event.Title, event.Description, event.Location, event.InstagramPage, event.StartTime, event.EndTime).Scan(&id)
+	err := db.QueryRow(ctx, `
+		INSERT INTO events (title, description, location, instagram_page, start_time, end_time, venue_id, source_uid, recurrence, exception_dates, status, status_reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, nullif($8, ''), nullif($9, ''), $10, $11, $12, $13) RETURNING id`,
+		event.Title, event.Description, event.Location, event.InstagramPage, event.StartTime, event.EndTime, event.VenueID, event.SourceUID,
+		normalizeRecurrence(event.Recurrence), normalizeExceptionDates(event.ExceptionDates), string(event.Status), event.StatusReason, ownerFrom(ctx)).Scan(&id)
 	if err != nil {
-		log.Err(err).Msg("Create failed")
-		return nil, err
+		return err
 	}
-	event.ID = id
-	return &event, nil
+	if err := setTags(ctx, db, id, event.Tags); err != nil {
+		return err
+	}
+	if err := getEvent(ctx, db, id, event); err != nil {
+		return err
+	}
+	return record(ctx, db, OperationCreate, nil, event)
 }
 
-func (r *SQLRepository) Migrate() error {
-	query := `
-		CREATE TABLE events (
-			id SERIAL PRIMARY KEY,
-			title TEXT NOT NULL,
-			description TEXT,
-			location TEXT,
-			start_time TIMESTAMP WITH TIME ZONE NOT NULL,
-			end_time TIMESTAMP WITH TIME ZONE NOT NULL,
-			instagram_page TEXT
-		);
-	`
-	fmt.Println("Creating events table...")
-	_, err := r.db.Exec(context.Background(), query)
-	return err
+func (r *SQLRepository) Create(ctx context.Context, event Event, log zerolog.Logger) (*Event, error) {
+	event.SourceUID = ""
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		return insertEvent(ctx, tx, &event)
+	})
+	if err != nil {
+		log.Err(err).Msg("Create failed")
+		return nil, translateError(err)
+	}
+	return &event, nil
 }
 
-func (r *SQLRepository) Delete(ctx context.Context, id int64, log zerolog.Logger) error {
-	res, err := r.db.Exec(ctx, `DELETE FROM events WHERE id = $1`, id)
-	rowsAffcected := res.RowsAffected()
-	if rowsAffcected == 0 {
-		return ErrDeleteFailed
+func (r *SQLRepository) Delete(ctx context.Context, id int64, version int64, log zerolog.Logger) error {
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockLiveEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		if version != 0 && version != current.Version {
+			return ErrVersionMismatch
+		}
+		deleted := current
+		err := tx.QueryRow(ctx, `
+			UPDATE events SET deleted_at = now(), updated_at = now(), version = version + 1
+			WHERE id = $1 RETURNING deleted_at, updated_at, version`, id).Scan(&deleted.DeletedAt, &deleted.UpdatedAt, &deleted.Version)
+		if err != nil {
+			return err
+		}
+		return record(ctx, tx, OperationDelete, &current, &deleted)
+	})
+	if err != nil {
+		log.Err(err).Msg("Delete failed")
+		return translateError(err)
 	}
-	return err
+	return nil
 }
 
+// All returns every event ordered by id.
 func (r *SQLRepository) All(ctx context.Context, log zerolog.Logger) ([]Event, error) {
 	log.Info().Msg("Get All database connection")
-	rows, err := r.db.Query(ctx, `SELECT * FROM events`)
+	rows, err := r.db.Query(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.deleted_at IS NULL ORDER BY e.id`)
 	if err != nil {
-		return nil, err
+		return nil, translateError(err)
 	}
 	defer rows.Close()
 	var events []Event
 	for rows.Next() {
 		var event Event
-		err = rows.Scan(&event.ID, &event.Title, &event.Description, &event.Location, &event.StartTime, &event.EndTime, &event.InstagramPage)
+		err = scanEvent(rows, &event)
 		if err != nil {
 			log.Err(err).Msg("Get All events failed")
-			return nil, err
+			return nil, translateError(err)
 		}
 		events = append(events, event)
 	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("Get All events failed")
+		return nil, translateError(err)
+	}
 	return events, nil
 }
+
+// List expands the recurring events in Go: the single events are paginated by
+// the database, the series are all read, then their occurrences are merged in.
+func (r *SQLRepository) List(ctx context.Context, filter Filter, log zerolog.Logger) (*Page, error) {
+	if err := filter.check(); err != nil {
+		return nil, err
+	}
+	q := query{conds: []string{"e.deleted_at IS NULL", "e.recurrence IS NULL"}}
+	filter.apply(&q)
+	orderBy := filter.orderBy(&q)
+	events, err := r.list(ctx, q, orderBy)
+	if err != nil {
+		log.Err(err).Msg("List failed")
+		return nil, translateError(err)
+	}
+
+	// the series are filtered on everything but the times of their occurrences
+	seriesFilter := filter
+	seriesFilter.From, seriesFilter.To, seriesFilter.Cursor = time.Time{}, time.Time{}, nil
+	q = query{conds: []string{"e.deleted_at IS NULL", "e.recurrence IS NOT NULL"}}
+	seriesFilter.apply(&q)
+	series, err := r.list(ctx, q, " ORDER BY e.id")
+	if err != nil {
+		log.Err(err).Msg("List failed")
+		return nil, translateError(err)
+	}
+	if len(series) == 0 {
+		return filter.page(events), nil
+	}
+	for _, s := range series {
+		for _, occurrence := range filter.occurrences(s) {
+			if filter.matchesWindow(occurrence) {
+				events = append(events, occurrence)
+			}
+		}
+	}
+	filter.sortEvents(events)
+	if filter.Limit > 0 && len(events) > filter.Limit+1 {
+		events = events[:filter.Limit+1]
+	}
+	return filter.page(events), nil
+}
+
+// list reads the events selected by q, with their distance and search columns.
+func (r *SQLRepository) list(ctx context.Context, q query, orderBy string) ([]Event, error) {
+	rows, err := r.db.Query(ctx,
+		`SELECT `+columns+`, `+q.distanceColumn()+`, `+q.searchColumns()+` FROM events`+joinVenues+q.whereClause()+orderBy,
+		q.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		var rank *float64
+		var snippet *string
+		err = scanEvent(rows, &event, &event.DistanceKm, &rank, &snippet)
+		if err != nil {
+			return nil, err
+		}
+		if rank != nil && snippet != nil {
+			event.rank, event.Snippet = *rank, highlight(*snippet)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,1266 @@
+// Package eventtest is a conformance suite for event.Repository implementations,
+// so every backend can be verified the same way.
+//
+//	func TestMyRepository(t *testing.T) {
+//		eventtest.RunRepositoryTests(t, func(t *testing.T) eventtest.Repositories {
+//			venues := newEmptyVenueRepository(t)
+//			return eventtest.Repositories{Events: newEmptyRepository(t, venues), Venues: venues}
+//		})
+//	}
+package eventtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Repositories are the repositories of a backend, sharing the same storage.
+type Repositories struct {
+	Events event.Repository
+	Venues venue.Repository
+}
+
+// RunRepositoryTests runs the whole suite, newRepos must return empty repositories
+// for every subtest.
+func RunRepositoryTests(t *testing.T, newRepos func(t *testing.T) Repositories) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, r Repositories)
+	}{
+		{"Create", testCreate},
+		{"GetByID", testGetByID},
+		{"Update", testUpdate},
+		{"Patch", testPatch},
+		{"Delete", testDelete},
+		{"All", testAll},
+		{"ListOrdering", testListOrdering},
+		{"ListFilters", testListFilters},
+		{"ListPagination", testListPagination},
+		{"ConcurrentCreates", testConcurrentCreates},
+		{"ConcurrentConditionalUpdates", testConcurrentConditionalUpdates},
+		{"ListNear", testListNear},
+		{"ListSearch", testListSearch},
+		{"Venues", testVenues},
+		{"VenueConflicts", testVenueConflicts},
+		{"EventVenue", testEventVenue},
+		{"Tags", testTags},
+		{"ListTags", testListTags},
+		{"TagCounts", testTagCounts},
+		{"Import", testImport},
+		{"CreateMany", testCreateMany},
+		{"Each", testEach},
+		{"Recurrence", testRecurrence},
+		{"RecurrenceTimezone", testRecurrenceTimezone},
+		{"RecurrenceWindow", testRecurrenceWindow},
+		{"Overrides", testOverrides},
+		{"Status", testStatus},
+		{"Trash", testTrash},
+		{"History", testHistory},
+		{"Owner", testOwner},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.fn(t, newRepos(t))
+		})
+	}
+}
+
+var (
+	ctx = context.Background()
+	log = zerolog.Nop()
+	// base is the start of the fixture events, in the future so they're upcoming.
+	base = time.Date(2030, time.May, 10, 22, 0, 0, 0, time.UTC)
+)
+
+// newEvent returns a valid event starting hours after base and lasting 4 hours.
+func newEvent(title string, hours int) event.Event {
+	start := base.Add(time.Duration(hours) * time.Hour)
+	return event.Event{
+		Title:         title,
+		Description:   "A night of " + title,
+		Location:      "Trackers",
+		StartTime:     start,
+		EndTime:       start.Add(4 * time.Hour),
+		InstagramPage: "onde.hoje",
+	}
+}
+
+func create(t *testing.T, repo event.Repository, e event.Event) *event.Event {
+	t.Helper()
+	created, err := repo.Create(ctx, e, log)
+	require.NoError(t, err)
+	return created
+}
+
+func assertSameEvent(t *testing.T, expected, actual event.Event) {
+	t.Helper()
+	assert.Equal(t, expected.Title, actual.Title)
+	assert.Equal(t, expected.Description, actual.Description)
+	assert.Equal(t, expected.Location, actual.Location)
+	assert.Equal(t, expected.InstagramPage, actual.InstagramPage)
+	assert.True(t, expected.StartTime.Equal(actual.StartTime), "start_time: expected %v, got %v", expected.StartTime, actual.StartTime)
+	assert.True(t, expected.EndTime.Equal(actual.EndTime), "end_time: expected %v, got %v", expected.EndTime, actual.EndTime)
+}
+
+func ids(events []event.Event) []int64 {
+	ids := []int64{}
+	for _, e := range events {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func testCreate(t *testing.T, r Repositories) {
+	first := create(t, r.Events, newEvent("techno", 0))
+	second := create(t, r.Events, newEvent("punk", 1))
+
+	assert.NotZero(t, first.ID)
+	assert.Greater(t, second.ID, first.ID, "ids must be increasing")
+	assertSameEvent(t, newEvent("techno", 0), *first)
+	assert.Equal(t, int64(1), first.Version)
+	assert.False(t, first.CreatedAt.IsZero())
+	assert.True(t, first.CreatedAt.Equal(first.UpdatedAt))
+}
+
+func testGetByID(t *testing.T, r Repositories) {
+	created := create(t, r.Events, newEvent("jazz", 0))
+
+	found, err := r.Events.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	assertSameEvent(t, *created, *found)
+	assert.Equal(t, created.Version, found.Version)
+	assert.True(t, created.CreatedAt.Equal(found.CreatedAt))
+
+	_, err = r.Events.GetByID(ctx, created.ID+1000, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+}
+
+func testUpdate(t *testing.T, r Repositories) {
+	created := create(t, r.Events, newEvent("jazz", 0))
+
+	changed := newEvent("free jazz", 2)
+	changed.InstagramPage = ""
+	updated, err := r.Events.Update(ctx, created.ID, changed, log)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, updated.ID)
+	assertSameEvent(t, changed, *updated)
+	assert.Equal(t, created.Version+1, updated.Version)
+	assert.True(t, created.CreatedAt.Equal(updated.CreatedAt))
+	assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt))
+
+	found, err := r.Events.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	assertSameEvent(t, changed, *found)
+
+	stale := changed
+	stale.Version = created.Version
+	_, err = r.Events.Update(ctx, created.ID, stale, log)
+	assert.ErrorIs(t, err, event.ErrVersionMismatch)
+
+	current := changed
+	current.Version = updated.Version
+	_, err = r.Events.Update(ctx, created.ID, current, log)
+	assert.NoError(t, err)
+
+	_, err = r.Events.Update(ctx, created.ID+1000, changed, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+	missing := changed
+	missing.Version = 1
+	_, err = r.Events.Update(ctx, created.ID+1000, missing, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+}
+
+func testPatch(t *testing.T, r Repositories) {
+	created := create(t, r.Events, newEvent("slam", 0))
+
+	location, empty := "Casa do Mancha", ""
+	patched, err := r.Events.Patch(ctx, created.ID, event.Patch{Location: &location, InstagramPage: &empty}, log)
+	require.NoError(t, err)
+	expected := newEvent("slam", 0)
+	expected.Location = location
+	expected.InstagramPage = ""
+	assertSameEvent(t, expected, *patched)
+	assert.Equal(t, created.Version+1, patched.Version)
+
+	_, err = r.Events.Patch(ctx, created.ID, event.Patch{Location: &location, Version: created.Version}, log)
+	assert.ErrorIs(t, err, event.ErrVersionMismatch)
+
+	before := created.StartTime.Add(-time.Hour)
+	_, err = r.Events.Patch(ctx, created.ID, event.Patch{EndTime: &before}, log)
+	var verr *event.ValidationError
+	assert.ErrorAs(t, err, &verr)
+	found, err := r.Events.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	assertSameEvent(t, expected, *found)
+
+	_, err = r.Events.Patch(ctx, created.ID+1000, event.Patch{Location: &location}, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+}
+
+func testDelete(t *testing.T, r Repositories) {
+	created := create(t, r.Events, newEvent("punk", 0))
+
+	err := r.Events.Delete(ctx, created.ID, created.Version+1, log)
+	assert.ErrorIs(t, err, event.ErrVersionMismatch)
+
+	err = r.Events.Delete(ctx, created.ID, created.Version, log)
+	require.NoError(t, err)
+	_, err = r.Events.GetByID(ctx, created.ID, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+
+	err = r.Events.Delete(ctx, created.ID, 0, log)
+	assert.ErrorIs(t, err, event.ErrGone, "the event is in the trash")
+
+	err = r.Events.Delete(ctx, created.ID+1000, 0, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+	assert.NotErrorIs(t, err, event.ErrGone)
+}
+
+func testAll(t *testing.T, r Repositories) {
+	events, err := r.Events.All(ctx, log)
+	require.NoError(t, err)
+	assert.Empty(t, events)
+
+	first := create(t, r.Events, newEvent("techno", 5))
+	second := create(t, r.Events, newEvent("punk", 1))
+	events, err = r.Events.All(ctx, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{first.ID, second.ID}, ids(events), "All is ordered by id")
+}
+
+func testListOrdering(t *testing.T, r Repositories) {
+	late := create(t, r.Events, newEvent("late", 3))
+	early := create(t, r.Events, newEvent("early", 0))
+	tieA := create(t, r.Events, newEvent("tie a", 1))
+	tieB := create(t, r.Events, newEvent("tie b", 1))
+
+	page, err := r.Events.List(ctx, event.Filter{}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{early.ID, tieA.ID, tieB.ID, late.ID}, ids(page.Events), "ordered by start_time then id")
+	assert.Nil(t, page.Next)
+
+	page, err = r.Events.List(ctx, event.Filter{Sort: event.SortStartTimeDesc}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{late.ID, tieB.ID, tieA.ID, early.ID}, ids(page.Events))
+}
+
+func testListFilters(t *testing.T, r Repositories) {
+	// each event lasts 4 hours
+	first := create(t, r.Events, newEvent("first", 0))
+	second := create(t, r.Events, newEvent("second", 6))
+	third := create(t, r.Events, newEvent("third", 24))
+
+	testCases := []struct {
+		name     string
+		filter   event.Filter
+		expected []int64
+	}{
+		{"Window", event.Filter{From: base.Add(5 * time.Hour), To: base.Add(12 * time.Hour)}, []int64{second.ID}},
+		{"Overlapping window", event.Filter{From: base.Add(3 * time.Hour), To: base.Add(7 * time.Hour)}, []int64{first.ID, second.ID}},
+		{"Window end is exclusive", event.Filter{From: base.Add(5 * time.Hour), To: base.Add(6 * time.Hour)}, []int64{}},
+		{"From only", event.Filter{From: base.Add(9 * time.Hour)}, []int64{second.ID, third.ID}},
+		{"To only", event.Filter{To: base.Add(time.Hour)}, []int64{first.ID}},
+		{"Happening at", event.HappeningAt(base.Add(2 * time.Hour)), []int64{first.ID}},
+		{"Happening at the start", event.HappeningAt(base.Add(6 * time.Hour)), []int64{second.ID}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := r.Events.List(ctx, tc.filter, log)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ids(page.Events))
+		})
+	}
+
+	t.Run("Updated since", func(t *testing.T) {
+		time.Sleep(10 * time.Millisecond)
+		updated, err := r.Events.Update(ctx, first.ID, newEvent("first", 0), log)
+		require.NoError(t, err)
+		page, err := r.Events.List(ctx, event.Filter{UpdatedSince: updated.UpdatedAt}, log)
+		require.NoError(t, err)
+		assert.Equal(t, []int64{first.ID}, ids(page.Events))
+	})
+}
+
+func testListPagination(t *testing.T, r Repositories) {
+	var expected []int64
+	for i := 0; i < 7; i++ {
+		// pairs of events starting at the same time to exercise the id tie-breaker
+		expected = append(expected, create(t, r.Events, newEvent("party", i/2)).ID)
+	}
+
+	for _, sort := range []event.Sort{event.SortStartTime, event.SortStartTimeDesc} {
+		t.Run(string(sort), func(t *testing.T) {
+			filter := event.Filter{Sort: sort, Limit: 3}
+			var got []int64
+			pages := 0
+			for {
+				page, err := r.Events.List(ctx, filter, log)
+				require.NoError(t, err)
+				assert.LessOrEqual(t, len(page.Events), 3)
+				got = append(got, ids(page.Events)...)
+				pages++
+				if page.Next == nil {
+					break
+				}
+				require.Less(t, pages, 10, "pagination doesn't end")
+				filter.Cursor = page.Next
+			}
+			assert.Equal(t, 3, pages)
+			want := append([]int64{}, expected...)
+			if sort == event.SortStartTimeDesc {
+				for i, j := 0, len(want)-1; i < j; i, j = i+1, j-1 {
+					want[i], want[j] = want[j], want[i]
+				}
+			}
+			assert.Equal(t, want, got)
+		})
+	}
+
+	t.Run("Cursor of another sort", func(t *testing.T) {
+		page, err := r.Events.List(ctx, event.Filter{Limit: 1}, log)
+		require.NoError(t, err)
+		_, err = r.Events.List(ctx, event.Filter{Limit: 1, Sort: event.SortStartTimeDesc, Cursor: page.Next}, log)
+		assert.ErrorIs(t, err, event.ErrInvalidCursor)
+	})
+}
+
+func testConcurrentCreates(t *testing.T, r Repositories) {
+	const n = 20
+	var wg sync.WaitGroup
+	created := make(chan int64, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e, err := r.Events.Create(ctx, newEvent("party", i), log)
+			if assert.NoError(t, err) {
+				created <- e.ID
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(created)
+
+	unique := map[int64]bool{}
+	for id := range created {
+		unique[id] = true
+	}
+	assert.Len(t, unique, n, "ids must be unique")
+	events, err := r.Events.All(ctx, log)
+	require.NoError(t, err)
+	assert.Len(t, events, n)
+}
+
+func testConcurrentConditionalUpdates(t *testing.T, r Repositories) {
+	created := create(t, r.Events, newEvent("party", 0))
+
+	const n = 10
+	var wg sync.WaitGroup
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e := newEvent("party", i)
+			e.Version = created.Version
+			_, err := r.Events.Update(ctx, created.ID, e, log)
+			results <- err
+		}(i)
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, event.ErrVersionMismatch):
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	assert.Equal(t, 1, succeeded, "only one update of the same version may win")
+	found, err := r.Events.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, created.Version+1, found.Version)
+}
+
+func newVenue(name string) venue.Venue {
+	return venue.Venue{
+		Name:          name,
+		Address:       "Rua Dom José de Barros, 337",
+		Neighbourhood: "República",
+		City:          "São Paulo",
+		Capacity:      300,
+		Coordinates:   &venue.Coordinates{Latitude: -23.5446, Longitude: -46.6406},
+		InstagramPage: "trackers",
+	}
+}
+
+func createVenue(t *testing.T, repo venue.Repository, v venue.Venue) *venue.Venue {
+	t.Helper()
+	created, err := repo.Create(ctx, v, log)
+	require.NoError(t, err)
+	return created
+}
+
+func testVenues(t *testing.T, r Repositories) {
+	created := createVenue(t, r.Venues, newVenue("Trackers"))
+	assert.NotZero(t, created.ID)
+	assert.False(t, created.CreatedAt.IsZero())
+	expected := newVenue("Trackers")
+	expected.ID, expected.CreatedAt, expected.UpdatedAt = created.ID, created.CreatedAt, created.UpdatedAt
+	assert.Equal(t, expected, *created)
+
+	found, err := r.Venues.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, created.Name, found.Name)
+	assert.Equal(t, created.Coordinates, found.Coordinates)
+	assert.True(t, created.CreatedAt.Equal(found.CreatedAt))
+
+	changed := newVenue("Trackers")
+	changed.Coordinates = nil
+	changed.Capacity = 0
+	updated, err := r.Venues.Update(ctx, created.ID, changed, log)
+	require.NoError(t, err)
+	assert.Equal(t, created.ID, updated.ID)
+	assert.Nil(t, updated.Coordinates)
+	assert.Zero(t, updated.Capacity)
+	assert.True(t, created.CreatedAt.Equal(updated.CreatedAt))
+	assert.False(t, updated.UpdatedAt.Before(created.UpdatedAt))
+
+	other := createVenue(t, r.Venues, newVenue("Casa do Mancha"))
+	all, err := r.Venues.All(ctx, log)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, other.ID, all[0].ID, "All is ordered by name")
+	assert.Equal(t, created.ID, all[1].ID)
+
+	require.NoError(t, r.Venues.Delete(ctx, created.ID, log))
+	_, err = r.Venues.GetByID(ctx, created.ID, log)
+	assert.ErrorIs(t, err, venue.ErrNotFound)
+	assert.ErrorIs(t, r.Venues.Delete(ctx, created.ID, log), venue.ErrNotFound)
+	_, err = r.Venues.Update(ctx, created.ID, changed, log)
+	assert.ErrorIs(t, err, venue.ErrNotFound)
+}
+
+func testVenueConflicts(t *testing.T, r Repositories) {
+	createVenue(t, r.Venues, newVenue("Trackers"))
+	_, err := r.Venues.Create(ctx, newVenue("TRACKERS"), log)
+	assert.ErrorIs(t, err, event.ErrConflict, "names are unique in a city, ignoring case")
+
+	elsewhere := newVenue("Trackers")
+	elsewhere.City = "Rio de Janeiro"
+	createVenue(t, r.Venues, elsewhere)
+
+	other := createVenue(t, r.Venues, newVenue("Casa do Mancha"))
+	_, err = r.Venues.Update(ctx, other.ID, newVenue("trackers"), log)
+	assert.ErrorIs(t, err, event.ErrConflict)
+}
+
+func testEventVenue(t *testing.T, r Repositories) {
+	trackers := createVenue(t, r.Venues, newVenue("Trackers"))
+
+	e := newEvent("techno", 0)
+	e.VenueID = &trackers.ID
+	created := create(t, r.Events, e)
+	require.NotNil(t, created.Venue)
+	assert.Equal(t, trackers.ID, *created.VenueID)
+	assert.Equal(t, "Trackers", created.Venue.Name)
+
+	renamed := newVenue("Trackers SP")
+	_, err := r.Venues.Update(ctx, trackers.ID, renamed, log)
+	require.NoError(t, err)
+	found, err := r.Events.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	require.NotNil(t, found.Venue)
+	assert.Equal(t, "Trackers SP", found.Venue.Name, "events embed the current venue details")
+	page, err := r.Events.List(ctx, event.Filter{}, log)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	require.NotNil(t, page.Events[0].Venue)
+	assert.Equal(t, trackers.ID, page.Events[0].Venue.ID)
+	create(t, r.Events, newEvent("elsewhere", 1))
+	page, err = r.Events.List(ctx, event.Filter{VenueID: trackers.ID}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{created.ID}, ids(page.Events))
+
+	assert.ErrorIs(t, r.Venues.Delete(ctx, trackers.ID, log), venue.ErrInUse)
+
+	unknown := trackers.ID + 1000
+	e.VenueID = &unknown
+	var verr *event.ValidationError
+	_, err = r.Events.Create(ctx, e, log)
+	assert.ErrorAs(t, err, &verr)
+	_, err = r.Events.Update(ctx, created.ID, e, log)
+	assert.ErrorAs(t, err, &verr)
+	_, err = r.Events.Patch(ctx, created.ID, event.Patch{VenueID: &unknown}, log)
+	assert.ErrorAs(t, err, &verr)
+
+	var none int64
+	patched, err := r.Events.Patch(ctx, created.ID, event.Patch{VenueID: &none}, log)
+	require.NoError(t, err)
+	assert.Nil(t, patched.VenueID)
+	assert.Nil(t, patched.Venue)
+	assert.NoError(t, r.Venues.Delete(ctx, trackers.ID, log))
+}
+
+func testListNear(t *testing.T, r Repositories) {
+	at := func(name string, latitude, longitude float64) *int64 {
+		v := newVenue(name)
+		v.Coordinates = &venue.Coordinates{Latitude: latitude, Longitude: longitude}
+		return &createVenue(t, r.Venues, v).ID
+	}
+	here := at("Trackers", -23.5446, -46.6406)
+	// 0.0135 degrees of latitude to the south, about 1.5 km
+	nearby := at("Casa do Mancha", -23.5581, -46.6406)
+	// about 20 km away
+	far := at("Sitio", -23.7246, -46.6406)
+	unplaced := newVenue("Nowhere")
+	unplaced.Coordinates = nil
+	nowhere := &createVenue(t, r.Venues, unplaced).ID
+
+	eventAt := func(title string, hours int, venueID *int64) int64 {
+		e := newEvent(title, hours)
+		e.VenueID = venueID
+		return create(t, r.Events, e).ID
+	}
+	closeFirst := eventAt("close first", 0, nearby)
+	hereLater := eventAt("here later", 5, here)
+	hereSooner := eventAt("here sooner", 1, here)
+	eventAt("far", 0, far)
+	eventAt("nowhere", 0, nowhere)
+	eventAt("no venue", 0, nil)
+
+	near := &event.Near{Latitude: -23.5446, Longitude: -46.6406, RadiusKm: 5}
+	page, err := r.Events.List(ctx, event.Filter{Near: near}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{hereSooner, hereLater, closeFirst}, ids(page.Events), "ordered by distance then start_time")
+	require.Len(t, page.Events, 3)
+	for _, e := range page.Events {
+		require.NotNil(t, e.DistanceKm)
+		require.NotNil(t, e.Venue)
+	}
+	assert.InDelta(t, 0, *page.Events[0].DistanceKm, 0.001)
+	assert.InDelta(t, 1.503, *page.Events[2].DistanceKm, 0.01)
+
+	page, err = r.Events.List(ctx, event.Filter{Near: near, Sort: event.SortStartTime}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{closeFirst, hereSooner, hereLater}, ids(page.Events))
+
+	wide := &event.Near{Latitude: near.Latitude, Longitude: near.Longitude, RadiusKm: 25}
+	filter := event.Filter{Near: wide, Limit: 1}
+	var got []int64
+	for {
+		page, err := r.Events.List(ctx, filter, log)
+		require.NoError(t, err)
+		got = append(got, ids(page.Events)...)
+		if page.Next == nil {
+			break
+		}
+		require.Less(t, len(got), 10, "pagination doesn't end")
+		filter.Cursor = page.Next
+	}
+	assert.Len(t, got, 4)
+	assert.Equal(t, []int64{hereSooner, hereLater, closeFirst}, got[:3])
+
+	page, err = r.Events.List(ctx, event.Filter{}, log)
+	require.NoError(t, err)
+	assert.Len(t, page.Events, 6)
+	for _, e := range page.Events {
+		assert.Nil(t, e.DistanceKm, "distances are only computed around a position")
+	}
+
+	_, err = r.Events.List(ctx, event.Filter{Sort: event.SortDistance}, log)
+	assert.Error(t, err)
+}
+
+func testListSearch(t *testing.T, r Repositories) {
+	inTitle := newEvent("Festa em São Paulo", 3)
+	inTitle.Description = "Techno até o sol nascer"
+	inDescription := newEvent("Jam de jazz", 1)
+	inDescription.Description = "A melhor jam de sao paulo, toda quarta"
+	elsewhere := newEvent("Sarau no Rio", 0)
+	elsewhere.Description = "Poesia e cerveja"
+	titleID := create(t, r.Events, inTitle).ID
+	descriptionID := create(t, r.Events, inDescription).ID
+	create(t, r.Events, elsewhere)
+
+	page, err := r.Events.List(ctx, event.Filter{Query: "sao paulo"}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{titleID, descriptionID}, ids(page.Events), "matches in the title rank first")
+	require.Len(t, page.Events, 2)
+	assert.Contains(t, page.Events[0].Snippet, "<mark>São</mark> <mark>Paulo</mark>")
+	assert.Contains(t, page.Events[1].Snippet, "<mark>sao</mark> <mark>paulo</mark>")
+
+	page, err = r.Events.List(ctx, event.Filter{Query: "SÃO PAULO", Sort: event.SortStartTime}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{descriptionID, titleID}, ids(page.Events))
+
+	page, err = r.Events.List(ctx, event.Filter{Query: "forró"}, log)
+	require.NoError(t, err)
+	assert.Empty(t, page.Events)
+
+	filter := event.Filter{Query: "paulo", Limit: 1}
+	var got []int64
+	for {
+		page, err := r.Events.List(ctx, filter, log)
+		require.NoError(t, err)
+		got = append(got, ids(page.Events)...)
+		if page.Next == nil {
+			break
+		}
+		require.Less(t, len(got), 10, "pagination doesn't end")
+		filter.Cursor = page.Next
+	}
+	assert.Equal(t, []int64{titleID, descriptionID}, got)
+
+	page, err = r.Events.List(ctx, event.Filter{}, log)
+	require.NoError(t, err)
+	for _, e := range page.Events {
+		assert.Empty(t, e.Snippet, "snippets are only computed when searching")
+	}
+
+	_, err = r.Events.List(ctx, event.Filter{Sort: event.SortRelevance}, log)
+	assert.Error(t, err)
+}
+
+func testTags(t *testing.T, r Repositories) {
+	e := newEvent("techno", 0)
+	e.Tags = []string{"Techno", "free entry", "techno"}
+	created := create(t, r.Events, e)
+	assert.Equal(t, []string{"free-entry", "techno"}, created.Tags, "tags are normalized, unique and sorted")
+
+	got, err := r.Events.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"free-entry", "techno"}, got.Tags)
+
+	untagged := create(t, r.Events, newEvent("punk", 1))
+	assert.Equal(t, []string{}, untagged.Tags)
+
+	e.Tags = []string{"queer", "techno"}
+	updated, err := r.Events.Update(ctx, created.ID, e, log)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"queer", "techno"}, updated.Tags, "update replaces the tags")
+
+	tags := []string{"jazz"}
+	patched, err := r.Events.Patch(ctx, created.ID, event.Patch{Title: &e.Title}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"queer", "techno"}, patched.Tags, "patch keeps the tags it doesn't set")
+	patched, err = r.Events.Patch(ctx, created.ID, event.Patch{Tags: &tags}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jazz"}, patched.Tags)
+
+	all, err := r.Events.All(ctx, log)
+	require.NoError(t, err)
+	require.Len(t, all, 2)
+	assert.Equal(t, []string{"jazz"}, all[0].Tags)
+	assert.Equal(t, []string{}, all[1].Tags)
+}
+
+func testListTags(t *testing.T, r Repositories) {
+	tagged := func(title string, hours int, tags ...string) int64 {
+		e := newEvent(title, hours)
+		e.Tags = tags
+		return create(t, r.Events, e).ID
+	}
+	technoQueer := tagged("techno queer", 0, "techno", "queer")
+	techno := tagged("techno", 1, "techno")
+	jazz := tagged("jazz", 2, "jazz")
+	tagged("untagged", 3)
+
+	testCases := []struct {
+		name     string
+		filter   event.Filter
+		expected []int64
+	}{
+		{"One tag", event.Filter{Tags: []string{"techno"}}, []int64{technoQueer, techno}},
+		{"Any tag", event.Filter{Tags: []string{"queer", "jazz"}}, []int64{technoQueer, jazz}},
+		{"All tags", event.Filter{Tags: []string{"techno", "queer"}, AllTags: true}, []int64{technoQueer}},
+		{"All tags, repeated", event.Filter{Tags: []string{"techno", "Techno"}, AllTags: true}, []int64{technoQueer, techno}},
+		{"Unknown tag", event.Filter{Tags: []string{"forró"}}, []int64{}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := r.Events.List(ctx, tc.filter, log)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ids(page.Events))
+		})
+	}
+}
+
+func testTagCounts(t *testing.T, r Repositories) {
+	counts, err := r.Events.TagCounts(ctx, base, log)
+	require.NoError(t, err)
+	assert.Equal(t, []event.TagCount{}, counts)
+
+	past := newEvent("past techno", -48)
+	past.Tags = []string{"techno", "jazz"}
+	create(t, r.Events, past)
+	for i, tags := range [][]string{{"techno", "queer"}, {"techno"}, {"queer"}} {
+		e := newEvent("upcoming", i)
+		e.Tags = tags
+		create(t, r.Events, e)
+	}
+	draft := newEvent("draft", 0)
+	draft.Tags, draft.Status = []string{"jazz"}, event.StatusDraft
+	create(t, r.Events, draft)
+	series := newEvent("past series", -48)
+	series.Tags, series.Recurrence = []string{"samba"}, "FREQ=WEEKLY"
+	create(t, r.Events, series)
+	ended := newEvent("ended series", -24*30)
+	ended.Tags, ended.Recurrence = []string{"forro"}, "FREQ=WEEKLY;COUNT=3"
+	create(t, r.Events, ended)
+	until := newEvent("series until", -24*30)
+	until.Tags, until.Recurrence = []string{"choro"}, "FREQ=WEEKLY;UNTIL=20300601T000000Z"
+	create(t, r.Events, until)
+
+	counts, err = r.Events.TagCounts(ctx, base, log)
+	require.NoError(t, err)
+	assert.Equal(t, []event.TagCount{
+		{Name: "queer", UpcomingEvents: 2},
+		{Name: "techno", UpcomingEvents: 2},
+		{Name: "choro", UpcomingEvents: 1},
+		{Name: "samba", UpcomingEvents: 1},
+		{Name: "forro", UpcomingEvents: 0},
+		{Name: "jazz", UpcomingEvents: 0},
+	}, counts, "ties are ordered by name, drafts and ended series don't count but running series do")
+}
+
+func testImport(t *testing.T, r Repositories) {
+	e := newEvent("techno", 0)
+	e.Tags = []string{"Techno"}
+	e.SourceUID = "techno@coletivo"
+	imported, result, err := r.Events.Import(ctx, e, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.ImportCreated, result)
+	assert.Equal(t, "techno@coletivo", imported.SourceUID)
+	assert.Equal(t, []string{"techno"}, imported.Tags)
+	assertSameEvent(t, e, *imported)
+
+	again, result, err := r.Events.Import(ctx, e, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.ImportUnchanged, result)
+	assert.Equal(t, imported.ID, again.ID)
+	assert.Equal(t, imported.Version, again.Version, "unchanged events aren't written")
+
+	trackers := createVenue(t, r.Venues, newVenue("Trackers"))
+	_, err = r.Events.Patch(ctx, imported.ID, event.Patch{VenueID: &trackers.ID}, log)
+	require.NoError(t, err)
+	e.Title = "techno all night"
+	updated, result, err := r.Events.Import(ctx, e, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.ImportUpdated, result)
+	assert.Equal(t, imported.ID, updated.ID)
+	assert.Equal(t, "techno all night", updated.Title)
+	require.NotNil(t, updated.VenueID, "the venue set by hand is kept")
+	assert.Equal(t, trackers.ID, *updated.VenueID)
+
+	other := newEvent("punk", 1)
+	other.SourceUID = "punk@coletivo"
+	_, result, err = r.Events.Import(ctx, other, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.ImportCreated, result)
+
+	created := create(t, r.Events, e)
+	assert.Empty(t, created.SourceUID, "only imports set the source uid")
+	_, _, err = r.Events.Import(ctx, newEvent("no uid", 2), log)
+	assert.Error(t, err)
+
+	all, err := r.Events.All(ctx, log)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
+
+func testCreateMany(t *testing.T, r Repositories) {
+	trackers := createVenue(t, r.Venues, newVenue("Trackers"))
+	unknown := trackers.ID + 1000
+	atVenue := newEvent("techno", 0)
+	atVenue.VenueID = &trackers.ID
+	atVenue.Tags = []string{"techno"}
+	nowhere := newEvent("punk", 1)
+	nowhere.VenueID = &unknown
+	batch := []event.Event{atVenue, nowhere, newEvent("jazz", 2)}
+
+	results, err := r.Events.CreateMany(ctx, batch, true, log)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	var verr *event.ValidationError
+	assert.ErrorAs(t, results[1].Err, &verr)
+	for _, result := range results {
+		assert.Nil(t, result.Event, "an atomic batch is rolled back")
+	}
+	all, err := r.Events.All(ctx, log)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	results, err = r.Events.CreateMany(ctx, batch, false, log)
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.NotNil(t, results[0].Event)
+	assert.NoError(t, results[0].Err)
+	assertSameEvent(t, atVenue, *results[0].Event)
+	assert.Equal(t, []string{"techno"}, results[0].Event.Tags)
+	require.NotNil(t, results[0].Event.Venue)
+	assert.Equal(t, "Trackers", results[0].Event.Venue.Name)
+	assert.Nil(t, results[1].Event)
+	assert.ErrorAs(t, results[1].Err, &verr)
+	require.NotNil(t, results[2].Event)
+	all, err = r.Events.All(ctx, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{results[0].Event.ID, results[2].Event.ID}, ids(all))
+
+	results, err = r.Events.CreateMany(ctx, []event.Event{newEvent("samba", 3)}, true, log)
+	require.NoError(t, err)
+	require.NotNil(t, results[0].Event)
+}
+
+func testEach(t *testing.T, r Repositories) {
+	var created []int64
+	for i, title := range []string{"techno", "punk", "jazz"} {
+		created = append(created, create(t, r.Events, newEvent(title, 3-i)).ID)
+	}
+	var got []int64
+	err := r.Events.Each(ctx, log, func(e event.Event) error {
+		got = append(got, e.ID)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, created, got, "events are ordered by id")
+
+	stop := errors.New("stop")
+	got = nil
+	err = r.Events.Each(ctx, log, func(e event.Event) error {
+		got = append(got, e.ID)
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Len(t, got, 1)
+}
+
+// starts returns the start times of events, in UTC.
+func starts(events []event.Event) []time.Time {
+	starts := []time.Time{}
+	for _, e := range events {
+		starts = append(starts, e.StartTime.UTC())
+	}
+	return starts
+}
+
+func newSeries(title string, recurrence string) event.Event {
+	e := newEvent(title, 0)
+	e.EndTime = e.StartTime.Add(3 * time.Hour)
+	e.Recurrence = recurrence
+	return e
+}
+
+func testRecurrence(t *testing.T, r Repositories) {
+	week := 7 * 24 * time.Hour
+	jam := newSeries("jam", "FREQ=WEEKLY;COUNT=5")
+	jam.ExceptionDates = []time.Time{base.Add(week)}
+	series := create(t, r.Events, jam)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=5", series.Recurrence)
+	require.Len(t, series.ExceptionDates, 1)
+	assert.True(t, base.Add(week).Equal(series.ExceptionDates[0]))
+	party := create(t, r.Events, newEvent("party", 48))
+
+	page, err := r.Events.List(ctx, event.Filter{From: base, To: base.Add(5 * week)}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{series.ID, party.ID, series.ID, series.ID, series.ID}, ids(page.Events))
+	assert.Equal(t, []time.Time{base, base.Add(48 * time.Hour), base.Add(2 * week), base.Add(3 * week), base.Add(4 * week)}, starts(page.Events))
+	require.NotNil(t, page.Events[2].Occurrence)
+	assert.True(t, base.Add(2*week).Equal(*page.Events[2].Occurrence))
+	assert.True(t, page.Events[2].EndTime.Equal(base.Add(2*week+3*time.Hour)))
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=5", page.Events[2].Recurrence)
+	assert.Nil(t, page.Events[1].Occurrence, "single events aren't occurrences")
+
+	var paged []event.Event
+	filter := event.Filter{From: base, Limit: 2}
+	for i := 0; i < 5; i++ {
+		page, err := r.Events.List(ctx, filter, log)
+		require.NoError(t, err)
+		paged = append(paged, page.Events...)
+		if page.Next == nil {
+			break
+		}
+		filter.Cursor = page.Next
+	}
+	assert.Equal(t, []time.Time{base, base.Add(48 * time.Hour), base.Add(2 * week), base.Add(3 * week), base.Add(4 * week)}, starts(paged), "occurrences are paginated like events")
+
+	page, err = r.Events.List(ctx, event.Filter{From: base.Add(2*week + 4*time.Hour), To: base.Add(3*week + time.Hour)}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{base.Add(3 * week)}, starts(page.Events), "only the occurrences overlapping the window")
+
+	page, err = r.Events.List(ctx, event.Filter{From: base, Sort: event.SortStartTimeDesc}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{base.Add(4 * week), base.Add(3 * week), base.Add(2 * week), base.Add(48 * time.Hour), base}, starts(page.Events))
+
+	endless := create(t, r.Events, newSeries("sarau", "FREQ=MONTHLY;BYDAY=1TU"))
+	page, err = r.Events.List(ctx, event.Filter{From: base, To: base.AddDate(1, 0, 0)}, log)
+	require.NoError(t, err)
+	sarau := 0
+	for _, e := range page.Events {
+		if e.ID == endless.ID {
+			sarau++
+			assert.Equal(t, time.Tuesday, e.StartTime.UTC().Weekday())
+		}
+	}
+	assert.Equal(t, 12, sarau, "a monthly series has 12 occurrences in a year")
+
+	noRecurrence := ""
+	patched, err := r.Events.Patch(ctx, series.ID, event.Patch{Recurrence: &noRecurrence, ExceptionDates: &[]time.Time{}}, log)
+	require.NoError(t, err)
+	assert.Empty(t, patched.Recurrence)
+	page, err = r.Events.List(ctx, event.Filter{From: base, To: base.Add(5 * week)}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{series.ID, party.ID, endless.ID}, ids(page.Events), "a series without recurrence is a single event again")
+}
+
+func testRecurrenceWindow(t *testing.T, r Repositories) {
+	now := time.Now().UTC()
+	daily := newSeries("roda", "FREQ=DAILY")
+	daily.StartTime = now.AddDate(-5, 0, 0).Truncate(time.Hour)
+	daily.EndTime = daily.StartTime.Add(3 * time.Hour)
+	series := create(t, r.Events, daily)
+
+	page, err := r.Events.List(ctx, event.Filter{Limit: 1}, log)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	assert.Equal(t, series.ID, page.Events[0].ID)
+	assert.True(t, page.Events[0].EndTime.After(now), "the listing starts at the occurrence running now, not at the start of the series: %v", page.Events[0].StartTime)
+
+	page, err = r.Events.List(ctx, event.Filter{Sort: event.SortStartTimeDesc, Limit: 1}, log)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 1)
+	assert.True(t, page.Events[0].StartTime.After(now.AddDate(0, 11, 0)), "the occurrences reach the horizon: %v", page.Events[0].StartTime)
+
+	past := daily.StartTime.AddDate(1, 0, 0)
+	page, err = r.Events.List(ctx, event.Filter{From: past, To: past.AddDate(0, 0, 7)}, log)
+	require.NoError(t, err)
+	assert.Len(t, page.Events, 7, "the past occurrences are listed with From")
+}
+
+func testRecurrenceTimezone(t *testing.T, r Repositories) {
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	// daylight saving time starts on 2030-03-10 in New York
+	start := time.Date(2030, time.March, 9, 20, 0, 0, 0, newYork)
+	e := newEvent("jam", 0)
+	e.StartTime, e.EndTime = start, start.Add(3*time.Hour)
+	e.Recurrence = "FREQ=DAILY;COUNT=3"
+	create(t, r.Events, e)
+
+	page, err := r.Events.List(ctx, event.Filter{From: start, Location: newYork}, log)
+	require.NoError(t, err)
+	require.Len(t, page.Events, 3)
+	for _, occurrence := range page.Events {
+		assert.Equal(t, 20, occurrence.StartTime.In(newYork).Hour(), "the wall clock time is kept")
+	}
+	assert.Equal(t, 23*time.Hour, page.Events[1].StartTime.Sub(page.Events[0].StartTime))
+}
+
+func testOverrides(t *testing.T, r Repositories) {
+	week := 7 * 24 * time.Hour
+	series := create(t, r.Events, newSeries("jam", "FREQ=WEEKLY;COUNT=4"))
+
+	cancelled, err := r.Events.SetOverride(ctx, series.ID, event.Override{Occurrence: base.Add(week), Cancelled: true}, log)
+	require.NoError(t, err)
+	assert.Equal(t, series.Version+1, cancelled.Version, "overriding changes the version")
+	movedStart, movedEnd := base.Add(2*week+24*time.Hour), base.Add(2*week+30*time.Hour)
+	moved, err := r.Events.SetOverride(ctx, series.ID, event.Override{Occurrence: base.Add(2 * week), StartTime: &movedStart, EndTime: &movedEnd}, log)
+	require.NoError(t, err)
+	require.Len(t, moved.Overrides, 2)
+	assert.True(t, base.Add(week).Equal(moved.Overrides[0].Occurrence), "overrides are ordered by occurrence")
+	assert.True(t, moved.Overrides[0].Cancelled)
+	assert.Nil(t, moved.Overrides[0].StartTime)
+	require.NotNil(t, moved.Overrides[1].StartTime)
+	assert.True(t, movedStart.Equal(*moved.Overrides[1].StartTime))
+	assertSameEvent(t, *series, *moved)
+
+	page, err := r.Events.List(ctx, event.Filter{From: base, To: base.Add(4 * week)}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{base, movedStart, base.Add(3 * week)}, starts(page.Events))
+	assert.True(t, base.Add(2*week).Equal(*page.Events[1].Occurrence))
+	assert.True(t, movedEnd.Equal(page.Events[1].EndTime))
+
+	// moved out of the window, then into another one
+	far := base.Add(10 * week)
+	farEnd := far.Add(time.Hour)
+	_, err = r.Events.SetOverride(ctx, series.ID, event.Override{Occurrence: base.Add(3 * week), StartTime: &far, EndTime: &farEnd}, log)
+	require.NoError(t, err)
+	page, err = r.Events.List(ctx, event.Filter{From: base, To: base.Add(4 * week)}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{base, movedStart}, starts(page.Events))
+	page, err = r.Events.List(ctx, event.Filter{From: base.Add(9 * week), To: base.Add(11 * week)}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{far}, starts(page.Events))
+
+	restored, err := r.Events.DeleteOverride(ctx, series.ID, base.Add(week), log)
+	require.NoError(t, err)
+	assert.Len(t, restored.Overrides, 2)
+	page, err = r.Events.List(ctx, event.Filter{From: base, To: base.Add(4 * week)}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []time.Time{base, base.Add(week), movedStart}, starts(page.Events))
+	_, err = r.Events.DeleteOverride(ctx, series.ID, base.Add(week), log)
+	assert.ErrorIs(t, err, event.ErrOverrideNotFound)
+
+	single := create(t, r.Events, newEvent("party", 1))
+	_, err = r.Events.SetOverride(ctx, single.ID, event.Override{Occurrence: single.StartTime, Cancelled: true}, log)
+	assert.ErrorIs(t, err, event.ErrNotRecurring)
+	_, err = r.Events.SetOverride(ctx, single.ID+1000, event.Override{Occurrence: base, Cancelled: true}, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+
+	noRecurrence := ""
+	patched, err := r.Events.Patch(ctx, series.ID, event.Patch{Recurrence: &noRecurrence}, log)
+	require.NoError(t, err)
+	assert.Empty(t, patched.Overrides, "the overrides go with the recurrence")
+}
+
+func testStatus(t *testing.T, r Repositories) {
+	draft := newEvent("techno", 0)
+	draft.Status = event.StatusDraft
+	created := create(t, r.Events, draft)
+	assert.Equal(t, event.StatusDraft, created.Status)
+	published := create(t, r.Events, newEvent("punk", 1))
+	assert.Equal(t, event.StatusPublished, published.Status, "events are published by default")
+
+	page, err := r.Events.List(ctx, event.Filter{Statuses: event.PublicStatuses}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{published.ID}, ids(page.Events), "drafts aren't public")
+	page, err = r.Events.List(ctx, event.Filter{}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{created.ID, published.ID}, ids(page.Events))
+
+	_, err = r.Events.Transition(ctx, created.ID, event.StatusCancelled, "no venue", 0, log)
+	assert.ErrorIs(t, err, event.ErrInvalidTransition, "drafts are published first")
+	_, err = r.Events.Transition(ctx, created.ID, event.StatusPublished, "", created.Version+1, log)
+	assert.ErrorIs(t, err, event.ErrVersionMismatch)
+	_, err = r.Events.Transition(ctx, created.ID+1000, event.StatusPublished, "", 0, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+
+	live, err := r.Events.Transition(ctx, created.ID, event.StatusPublished, "", created.Version, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.StatusPublished, live.Status)
+	assert.Equal(t, created.Version+1, live.Version)
+	assertSameEvent(t, *created, *live)
+
+	cancelled, err := r.Events.Transition(ctx, live.ID, event.StatusCancelled, " Rain ", 0, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.StatusCancelled, cancelled.Status)
+	assert.Equal(t, "Rain", cancelled.StatusReason)
+	found, err := r.Events.GetByID(ctx, live.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.StatusCancelled, found.Status)
+	assert.Equal(t, "Rain", found.StatusReason)
+
+	_, err = r.Events.Transition(ctx, live.ID, event.StatusPostponed, "rain again", 0, log)
+	assert.ErrorIs(t, err, event.ErrInvalidTransition)
+	postponed, err := r.Events.Transition(ctx, published.ID, event.StatusPostponed, "new date soon", 0, log)
+	require.NoError(t, err)
+	page, err = r.Events.List(ctx, event.Filter{Statuses: []event.Status{event.StatusCancelled, event.StatusPostponed}}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{live.ID, postponed.ID}, ids(page.Events))
+
+	changed := newEvent("techno all night", 0)
+	changed.Status = event.StatusDraft
+	updated, err := r.Events.Update(ctx, live.ID, changed, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.StatusCancelled, updated.Status, "updates don't change the status")
+
+	republished, err := r.Events.Transition(ctx, live.ID, event.StatusPublished, "", 0, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.StatusPublished, republished.Status)
+	assert.Empty(t, republished.StatusReason)
+}
+
+func testTrash(t *testing.T, r Repositories) {
+	trash, err := r.Events.Trash(ctx, log)
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+
+	trackers := createVenue(t, r.Venues, newVenue("Trackers"))
+	techno := newEvent("techno", 0)
+	techno.Tags, techno.VenueID = []string{"techno"}, &trackers.ID
+	techno.SourceUID = "techno@coletivo"
+	imported, _, err := r.Events.Import(ctx, techno, log)
+	require.NoError(t, err)
+	samba := create(t, r.Events, newEvent("samba", 1))
+	jazz := create(t, r.Events, newEvent("jazz", 2))
+	require.NoError(t, r.Events.Delete(ctx, imported.ID, 0, log))
+	require.NoError(t, r.Events.Delete(ctx, samba.ID, 0, log))
+
+	page, err := r.Events.List(ctx, event.Filter{}, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{jazz.ID}, ids(page.Events), "deleted events aren't listed")
+	all, err := r.Events.All(ctx, log)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{jazz.ID}, ids(all))
+	counts, err := r.Events.TagCounts(ctx, base, log)
+	require.NoError(t, err)
+	assert.Empty(t, counts, "the tags of deleted events aren't counted")
+	_, err = r.Events.GetByID(ctx, samba.ID, log)
+	assert.ErrorIs(t, err, event.ErrGone)
+	_, err = r.Events.Update(ctx, samba.ID, newEvent("samba", 1), log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+	_, err = r.Events.Transition(ctx, samba.ID, event.StatusCancelled, "Rain", 0, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+	again, result, err := r.Events.Import(ctx, techno, log)
+	require.NoError(t, err)
+	assert.Equal(t, event.ImportUnchanged, result, "deleted events stay in the trash")
+	assert.Equal(t, imported.ID, again.ID)
+	assert.ErrorIs(t, r.Venues.Delete(ctx, trackers.ID, log), venue.ErrInUse, "the trash keeps its venues")
+
+	trash, err = r.Events.Trash(ctx, log)
+	require.NoError(t, err)
+	require.Equal(t, []int64{samba.ID, imported.ID}, ids(trash), "the most recently deleted first")
+	require.NotNil(t, trash[0].DeletedAt)
+	assert.Equal(t, samba.Version+1, trash[0].Version)
+	assert.Equal(t, "Trackers", trash[1].Venue.Name)
+
+	restored, err := r.Events.Restore(ctx, imported.ID, log)
+	require.NoError(t, err)
+	assert.Nil(t, restored.DeletedAt)
+	assert.Equal(t, imported.Version+2, restored.Version)
+	assert.Equal(t, []string{"techno"}, restored.Tags)
+	found, err := r.Events.GetByID(ctx, imported.ID, log)
+	require.NoError(t, err)
+	assertSameEvent(t, techno, *found)
+	_, err = r.Events.Restore(ctx, imported.ID, log)
+	assert.ErrorIs(t, err, event.ErrNotFound, "the event isn't in the trash anymore")
+
+	purged, err := r.Events.Purge(ctx, trash[0].DeletedAt.Add(-time.Hour), log)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), purged, "samba was deleted afterwards")
+	purged, err = r.Events.Purge(ctx, time.Now().Add(time.Hour), log)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	trash, err = r.Events.Trash(ctx, log)
+	require.NoError(t, err)
+	assert.Empty(t, trash)
+	_, err = r.Events.Restore(ctx, samba.ID, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+	err = r.Events.Delete(ctx, samba.ID, 0, log)
+	assert.ErrorIs(t, err, event.ErrNotFound, "purged events are gone for good")
+	assert.NotErrorIs(t, err, event.ErrGone)
+}
+
+func testHistory(t *testing.T, r Repositories) {
+	jojo := event.WithActor(ctx, "jojo")
+	created, err := r.Events.Create(jojo, newEvent("techno", 0), log)
+	require.NoError(t, err)
+	changed := *created
+	changed.Title, changed.Tags = "techno all night", []string{"techno"}
+	_, err = r.Events.Update(jojo, created.ID, changed, log)
+	require.NoError(t, err)
+	location := "Jojo's"
+	_, err = r.Events.Patch(ctx, created.ID, event.Patch{Location: &location}, log)
+	require.NoError(t, err)
+	_, err = r.Events.Transition(jojo, created.ID, event.StatusCancelled, "Rain", 0, log)
+	require.NoError(t, err)
+	require.NoError(t, r.Events.Delete(jojo, created.ID, 0, log))
+	_, err = r.Events.Revert(jojo, created.ID, 1, log)
+	assert.ErrorIs(t, err, event.ErrGone)
+	_, err = r.Events.Restore(jojo, created.ID, log)
+	require.NoError(t, err)
+
+	reverted, err := r.Events.Revert(jojo, created.ID, 1, log)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), reverted.Version)
+	assert.Equal(t, "techno", reverted.Title)
+	assert.Empty(t, reverted.Tags)
+	assert.Equal(t, event.StatusCancelled, reverted.Status, "the status isn't reverted")
+	_, err = r.Events.Revert(jojo, created.ID, 99, log)
+	assert.ErrorIs(t, err, event.ErrVersionNotFound)
+
+	history, err := r.Events.History(ctx, created.ID, log)
+	require.NoError(t, err)
+	require.Len(t, history, 7)
+	operations := []event.Operation{}
+	for i, change := range history {
+		assert.Equal(t, created.ID, change.EventID)
+		assert.Equal(t, int64(i+1), change.Version)
+		assert.False(t, change.ChangedAt.IsZero())
+		operations = append(operations, change.Operation)
+	}
+	assert.Equal(t, []event.Operation{
+		event.OperationCreate, event.OperationUpdate, event.OperationUpdate, event.OperationStatus,
+		event.OperationDelete, event.OperationRestore, event.OperationRevert,
+	}, operations)
+	assert.Equal(t, "jojo", history[0].Actor)
+	assert.Equal(t, event.AnonymousActor, history[2].Actor)
+	assert.Equal(t, event.FieldDiff{Old: nil, New: "techno"}, history[0].Diff["title"], "everything is new on creation")
+	assert.Equal(t, map[string]event.FieldDiff{
+		"title": {Old: "techno", New: "techno all night"},
+		"tags":  {Old: []any{}, New: []any{"techno"}},
+	}, history[1].Diff)
+	assert.Equal(t, map[string]event.FieldDiff{"location": {Old: "Trackers", New: "Jojo's"}}, history[2].Diff)
+	assert.Equal(t, event.FieldDiff{Old: "published", New: "cancelled"}, history[3].Diff["status"])
+	assert.Contains(t, history[4].Diff, "deleted_at")
+	assert.Nil(t, history[4].Diff["deleted_at"].Old)
+	assert.Nil(t, history[5].Diff["deleted_at"].New)
+	assert.Equal(t, event.FieldDiff{Old: "techno all night", New: "techno"}, history[6].Diff["title"])
+
+	require.NoError(t, r.Events.Delete(ctx, created.ID, 0, log))
+	_, err = r.Events.Purge(event.WithActor(ctx, "key:admin"), time.Now().Add(time.Hour), log)
+	require.NoError(t, err)
+	history, err = r.Events.History(ctx, created.ID, log)
+	require.NoError(t, err)
+	require.Len(t, history, 9, "the history outlives the purge")
+	purge := history[8]
+	assert.Equal(t, event.OperationPurge, purge.Operation)
+	assert.Equal(t, "key:admin", purge.Actor)
+	assert.Equal(t, history[7].Version+1, purge.Version)
+	assert.Equal(t, event.FieldDiff{Old: "techno"}, purge.Diff["title"])
+	_, err = r.Events.History(ctx, created.ID+1000, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+}
+
+func testOwner(t *testing.T, r Repositories) {
+	bot := event.WithActor(ctx, "key:agenda-bot")
+	techno := newEvent("techno", 0)
+	techno.CreatedBy = "jojo"
+	created, err := r.Events.Create(bot, techno, log)
+	require.NoError(t, err)
+	assert.Equal(t, "key:agenda-bot", created.CreatedBy, "set by the repository")
+	anonymous := create(t, r.Events, newEvent("samba", 1))
+	assert.Empty(t, anonymous.CreatedBy)
+	samba := newEvent("samba", 1)
+	samba.SourceUID = "samba@coletivo"
+	imported, _, err := r.Events.Import(bot, samba, log)
+	require.NoError(t, err)
+	assert.Equal(t, "key:agenda-bot", imported.CreatedBy)
+
+	changed := *created
+	changed.Title, changed.CreatedBy = "techno all night", "ana"
+	updated, err := r.Events.Update(event.WithActor(ctx, "ana"), created.ID, changed, log)
+	require.NoError(t, err)
+	assert.Equal(t, "key:agenda-bot", updated.CreatedBy, "the owner doesn't change")
+	got, err := r.Events.GetByID(ctx, created.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, "key:agenda-bot", got.CreatedBy)
+
+	owner, err := r.Events.Owner(ctx, created.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, "key:agenda-bot", owner)
+	require.NoError(t, r.Events.Delete(ctx, created.ID, 0, log))
+	owner, err = r.Events.Owner(ctx, created.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, "key:agenda-bot", owner, "even in the trash")
+	owner, err = r.Events.Owner(ctx, anonymous.ID, log)
+	require.NoError(t, err)
+	assert.Empty(t, owner)
+	_, err = r.Events.Owner(ctx, created.ID+1000, log)
+	assert.ErrorIs(t, err, event.ErrNotFound)
+}
@@ -0,0 +1,453 @@
+package event
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Sort is the order of the events returned by Repository.List.
+type Sort string
+
+const (
+	SortStartTime     Sort = "start_time"
+	SortStartTimeDesc Sort = "-start_time"
+	// SortDistance orders the events by the distance of their venue to Filter.Near,
+	// then by start time.
+	SortDistance Sort = "distance"
+	// SortRelevance orders the events by how well they match Filter.Query, then by start time.
+	SortRelevance Sort = "relevance"
+)
+
+// ParseSort validates a sort parameter. An empty value means SortStartTime.
+func ParseSort(s string) (Sort, error) {
+	switch Sort(s) {
+	case "":
+		return SortStartTime, nil
+	case SortStartTime, SortStartTimeDesc, SortDistance, SortRelevance:
+		return Sort(s), nil
+	}
+	return "", fmt.Errorf("invalid sort %q, expected %s, %s, %s or %s", s, SortStartTime, SortStartTimeDesc, SortDistance, SortRelevance)
+}
+
+var (
+	// errSortWithoutPosition is returned when sorting by distance to nowhere.
+	errSortWithoutPosition = errors.New("sorting by distance needs a position")
+	// errSortWithoutQuery is returned when sorting by relevance without searching.
+	errSortWithoutQuery = errors.New("sorting by relevance needs a query")
+)
+
+// Near keeps only the events whose venue is within RadiusKm of a position.
+type Near struct {
+	Latitude  float64
+	Longitude float64
+	RadiusKm  float64
+}
+
+// earthRadiusKm is the radius of the sphere earthdistance uses, so distances
+// computed in memory match the ones of Postgres.
+const earthRadiusKm = 6378.168
+
+// distanceKm returns the great-circle distance between the position of n and
+// the given one, with the haversine formula.
+func (n Near) distanceKm(latitude, longitude float64) float64 {
+	rad := func(deg float64) float64 { return deg * math.Pi / 180 }
+	dLat := rad(latitude - n.Latitude)
+	dLng := rad(longitude - n.Longitude)
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(rad(n.Latitude))*math.Cos(rad(latitude))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Filter narrows down the events returned by Repository.List.
+// Zero values mean "no restriction".
+type Filter struct {
+	// From keeps only the events that are still running after it (end_time > From).
+	From time.Time
+	// To keeps only the events that started before it (start_time < To).
+	To time.Time
+	// UpdatedSince keeps only the events created or updated at or after it.
+	UpdatedSince time.Time
+	// Near keeps only the events taking place around a position, their
+	// Event.DistanceKm is then set.
+	Near *Near
+	// Query keeps only the events matching a web search query, in Portuguese and
+	// ignoring accents, their Event.Snippet is then set.
+	Query string
+	// VenueID keeps only the events taking place at this venue.
+	VenueID int64
+	// Tags keeps only the events having any of these tags, or all of them when
+	// AllTags is set. They are normalized like the tags of the events.
+	Tags    []string
+	AllTags bool
+	// Statuses keeps only the events having one of these statuses, see PublicStatuses.
+	Statuses []Status
+	// Sort defaults to SortRelevance when Query is set, to SortDistance when Near
+	// is set, to SortStartTime otherwise.
+	Sort Sort
+	// Location is the timezone the recurring events are expanded in, so their
+	// occurrences keep the same wall clock time. UTC when nil.
+	Location *time.Location
+	// Limit is the maximum number of events in a page.
+	Limit int
+	// Cursor resumes the listing right after the last event of a previous page.
+	Cursor *Cursor
+}
+
+// Cursor is the keyset position of an event in a listing: the (start_time, id)
+// of the last event of a page, preceded by its distance or its rank when sorting
+// by distance or relevance, for a given sort order.
+type Cursor struct {
+	Sort       Sort      `json:"s"`
+	DistanceKm float64   `json:"d,omitempty"`
+	Rank       float64   `json:"r,omitempty"`
+	StartTime  time.Time `json:"t"`
+	ID         int64     `json:"id"`
+}
+
+// Page is a slice of a listing. Next is nil on the last page.
+type Page struct {
+	Events []Event
+	Next   *Cursor
+}
+
+// Encode returns the opaque form of the cursor handed to the clients.
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if _, err := ParseSort(string(c.Sort)); err != nil || c.StartTime.IsZero() {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func cursorOf(e Event, sort Sort) *Cursor {
+	c := &Cursor{Sort: sort, StartTime: e.StartTime, ID: e.ID}
+	if sort == SortDistance && e.DistanceKm != nil {
+		c.DistanceKm = *e.DistanceKm
+	}
+	if sort == SortRelevance {
+		c.Rank = e.rank
+	}
+	return c
+}
+
+// Today returns a Filter matching the events that overlap the current day in loc.
+func Today(now time.Time, loc *time.Location) Filter {
+	start := startOfDay(now, loc)
+	return Filter{From: start, To: start.AddDate(0, 0, 1)}
+}
+
+// Tomorrow returns a Filter matching the events that overlap the next day in loc.
+func Tomorrow(now time.Time, loc *time.Location) Filter {
+	start := startOfDay(now, loc).AddDate(0, 0, 1)
+	return Filter{From: start, To: start.AddDate(0, 0, 1)}
+}
+
+// weekendStartHour is when the weekend starts on Friday, the parties of
+// Friday night are part of it.
+const weekendStartHour = 18
+
+// Weekend returns a Filter matching the events that overlap the current weekend
+// in loc, or the next one when called from Monday to Thursday. A weekend goes
+// from Friday 18:00 to Monday 00:00.
+func Weekend(now time.Time, loc *time.Location) Filter {
+	today := startOfDay(now, loc)
+	var friday time.Time
+	switch today.Weekday() {
+	case time.Saturday:
+		friday = today.AddDate(0, 0, -1)
+	case time.Sunday:
+		friday = today.AddDate(0, 0, -2)
+	default:
+		friday = today.AddDate(0, 0, int(time.Friday-today.Weekday()))
+	}
+	start := time.Date(friday.Year(), friday.Month(), friday.Day(), weekendStartHour, 0, 0, 0, loc)
+	return Filter{From: start, To: friday.AddDate(0, 0, 3)}
+}
+
+// HappeningAt returns a Filter matching the events that are running at the given instant.
+func HappeningAt(now time.Time) Filter {
+	return Filter{From: now, To: now}
+}
+
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+}
+
+// query accumulates the WHERE conditions and the positional arguments of a SQL statement.
+type query struct {
+	conds []string
+	args  []any
+	// distance is the expression of the distance in km to Filter.Near, when set.
+	distance string
+	// rank and snippet are the expressions of the rank and the raw snippet of
+	// the events matching Filter.Query, when set.
+	rank, snippet string
+}
+
+// arg registers a new positional argument and returns its placeholder.
+func (q *query) arg(v any) string {
+	q.args = append(q.args, v)
+	return fmt.Sprintf("$%d", len(q.args))
+}
+
+func (q *query) where(cond string) {
+	q.conds = append(q.conds, cond)
+}
+
+// distanceColumn is the distance_km column of the selected events, null unless Filter.Near is set.
+func (q *query) distanceColumn() string {
+	if q.distance == "" {
+		return "NULL::float8"
+	}
+	return q.distance
+}
+
+// searchColumns are the rank and snippet columns of the selected events, null unless Filter.Query is set.
+func (q *query) searchColumns() string {
+	if q.rank == "" {
+		return "NULL::float8, NULL::text"
+	}
+	return q.rank + ", " + q.snippet
+}
+
+func (q *query) whereClause() string {
+	if len(q.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(q.conds, " AND ")
+}
+
+func (f Filter) sort() Sort {
+	if f.Sort == "" {
+		switch {
+		case f.Query != "":
+			return SortRelevance
+		case f.Near != nil:
+			return SortDistance
+		}
+		return SortStartTime
+	}
+	return f.Sort
+}
+
+// check reports the filters that can't be applied.
+func (f Filter) check() error {
+	if f.Cursor != nil && f.Cursor.Sort != f.sort() {
+		return ErrInvalidCursor
+	}
+	if f.sort() == SortDistance && f.Near == nil {
+		return errSortWithoutPosition
+	}
+	if f.sort() == SortRelevance && f.Query == "" {
+		return errSortWithoutQuery
+	}
+	return nil
+}
+
+func (f Filter) apply(q *query) {
+	if f.Near != nil {
+		origin := fmt.Sprintf("ll_to_earth(%s, %s)", q.arg(f.Near.Latitude), q.arg(f.Near.Longitude))
+		radius := q.arg(f.Near.RadiusKm * 1000)
+		// the earth_box condition uses the index of the venues, it's a bit larger than the radius
+		q.where(fmt.Sprintf("earth_box(%s, %s) @> ll_to_earth(v.latitude, v.longitude)", origin, radius))
+		q.where(fmt.Sprintf("earth_distance(%s, ll_to_earth(v.latitude, v.longitude)) <= %s", origin, radius))
+		q.distance = fmt.Sprintf("earth_distance(%s, ll_to_earth(v.latitude, v.longitude)) / 1000", origin)
+	}
+	if f.Query != "" {
+		tsquery := fmt.Sprintf("websearch_to_tsquery('pt_unaccent', %s)", q.arg(f.Query))
+		q.where("e.search @@ " + tsquery)
+		q.rank = fmt.Sprintf("ts_rank(e.search, %s)::float8", tsquery)
+		q.snippet = fmt.Sprintf("ts_headline('pt_unaccent', concat_ws(' · ', e.title, nullif(e.location, ''), nullif(e.instagram_page, ''), nullif(e.description, '')), %s, %s)", tsquery, q.arg(headlineOptions))
+	}
+	if f.VenueID != 0 {
+		q.where("e.venue_id = " + q.arg(f.VenueID))
+	}
+	if tags := normalizeTags(f.Tags); len(tags) > 0 {
+		tagged := fmt.Sprintf("SELECT count(*) FROM event_tags et JOIN tags t ON t.id = et.tag_id WHERE et.event_id = e.id AND t.name = ANY(%s)", q.arg(tags))
+		if f.AllTags {
+			q.where(fmt.Sprintf("(%s) = %d", tagged, len(tags)))
+		} else {
+			q.where(fmt.Sprintf("(%s) > 0", tagged))
+		}
+	}
+	if len(f.Statuses) > 0 {
+		q.where("e.status = ANY(" + q.arg(statusStrings(f.Statuses)) + ")")
+	}
+	if !f.From.IsZero() {
+		q.where("e.end_time > " + q.arg(f.From))
+	}
+	if !f.To.IsZero() {
+		if f.To.Equal(f.From) {
+			q.where("e.start_time <= " + q.arg(f.To))
+		} else {
+			q.where("e.start_time < " + q.arg(f.To))
+		}
+	}
+	if !f.UpdatedSince.IsZero() {
+		q.where("e.updated_at >= " + q.arg(f.UpdatedSince))
+	}
+}
+
+// distanceKm is the in-memory counterpart of the distance column, e must carry its venue.
+func (f Filter) distanceKm(e Event) *float64 {
+	if f.Near == nil || e.Venue == nil || e.Venue.Coordinates == nil {
+		return nil
+	}
+	d := f.Near.distanceKm(e.Venue.Coordinates.Latitude, e.Venue.Coordinates.Longitude)
+	return &d
+}
+
+// matches is the in-memory counterpart of apply and of the cursor condition of orderBy.
+// e must carry its venue, distance and rank. The occurrences of the recurring
+// events are matched one by one.
+func (f Filter) matches(e Event) bool {
+	if f.Near != nil && (e.DistanceKm == nil || *e.DistanceKm > f.Near.RadiusKm) {
+		return false
+	}
+	if f.Query != "" {
+		if _, ok := searchRank(e, f.Query); !ok {
+			return false
+		}
+	}
+	if f.VenueID != 0 && (e.VenueID == nil || *e.VenueID != f.VenueID) {
+		return false
+	}
+	if tags := normalizeTags(f.Tags); len(tags) > 0 {
+		having := 0
+		for _, tag := range tags {
+			for _, t := range e.Tags {
+				if t == tag {
+					having++
+				}
+			}
+		}
+		if having == 0 || f.AllTags && having < len(tags) {
+			return false
+		}
+	}
+	if len(f.Statuses) > 0 {
+		listed := false
+		for _, status := range f.Statuses {
+			listed = listed || e.Status == status
+		}
+		if !listed {
+			return false
+		}
+	}
+	if !f.UpdatedSince.IsZero() && e.UpdatedAt.Before(f.UpdatedSince) {
+		return false
+	}
+	return f.matchesWindow(e)
+}
+
+// matchesWindow is the in-memory counterpart of the conditions of apply on the
+// times of the events, and of the cursor condition of orderBy.
+func (f Filter) matchesWindow(e Event) bool {
+	if !f.From.IsZero() && !e.EndTime.After(f.From) {
+		return false
+	}
+	if !f.To.IsZero() {
+		if f.To.Equal(f.From) {
+			if e.StartTime.After(f.To) {
+				return false
+			}
+		} else if !e.StartTime.Before(f.To) {
+			return false
+		}
+	}
+	if f.Cursor != nil && !f.less(*f.Cursor, *cursorOf(e, f.sort())) {
+		return false
+	}
+	return true
+}
+
+// less reports whether the position a comes before b in the sort order.
+func (f Filter) less(a, b Cursor) bool {
+	switch f.sort() {
+	case SortStartTimeDesc:
+		a, b = b, a
+	case SortDistance:
+		if a.DistanceKm != b.DistanceKm {
+			return a.DistanceKm < b.DistanceKm
+		}
+	case SortRelevance:
+		if a.Rank != b.Rank {
+			return a.Rank > b.Rank
+		}
+	}
+	if !a.StartTime.Equal(b.StartTime) {
+		return a.StartTime.Before(b.StartTime)
+	}
+	return a.ID < b.ID
+}
+
+// sortEvents is the in-memory counterpart of the ORDER BY clause of orderBy.
+func (f Filter) sortEvents(events []Event) {
+	sort.Slice(events, func(i, j int) bool {
+		return f.less(*cursorOf(events[i], f.sort()), *cursorOf(events[j], f.sort()))
+	})
+}
+
+// orderBy adds the keyset condition of the cursor to q and returns the ORDER BY
+// and LIMIT clauses. One more row than the limit is requested to detect the last page.
+func (f Filter) orderBy(q *query) string {
+	var clause string
+	switch f.sort() {
+	case SortDistance:
+		if f.Cursor != nil {
+			q.where(fmt.Sprintf("(%s, e.start_time, e.id) > (%s, %s, %s)", q.distance, q.arg(f.Cursor.DistanceKm), q.arg(f.Cursor.StartTime), q.arg(f.Cursor.ID)))
+		}
+		clause = fmt.Sprintf(" ORDER BY %s, e.start_time, e.id", q.distance)
+	case SortRelevance:
+		// the rank is negated to compare the rows in a single direction
+		if f.Cursor != nil {
+			q.where(fmt.Sprintf("(-%s, e.start_time, e.id) > (%s, %s, %s)", q.rank, q.arg(-f.Cursor.Rank), q.arg(f.Cursor.StartTime), q.arg(f.Cursor.ID)))
+		}
+		clause = fmt.Sprintf(" ORDER BY %s DESC, e.start_time, e.id", q.rank)
+	default:
+		direction, comparison := "ASC", ">"
+		if f.sort() == SortStartTimeDesc {
+			direction, comparison = "DESC", "<"
+		}
+		if f.Cursor != nil {
+			q.where(fmt.Sprintf("(e.start_time, e.id) %s (%s, %s)", comparison, q.arg(f.Cursor.StartTime), q.arg(f.Cursor.ID)))
+		}
+		clause = fmt.Sprintf(" ORDER BY e.start_time %s, e.id %s", direction, direction)
+	}
+	if f.Limit > 0 {
+		clause += " LIMIT " + q.arg(f.Limit+1)
+	}
+	return clause
+}
+
+// page cuts the events fetched with orderBy down to the limit and computes the next cursor.
+func (f Filter) page(events []Event) *Page {
+	if f.Limit <= 0 || len(events) <= f.Limit {
+		return &Page{Events: events}
+	}
+	events = events[:f.Limit]
+	return &Page{Events: events, Next: cursorOf(events[len(events)-1], f.sort())}
+}
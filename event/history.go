@@ -0,0 +1,296 @@
+package event
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// Operation is the kind of change of an entry of the history.
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	// OperationUpdate covers Update, Patch and the updates of Import.
+	OperationUpdate  Operation = "update"
+	OperationDelete  Operation = "delete"
+	OperationRestore Operation = "restore"
+	// OperationStatus is a transition of the status.
+	OperationStatus Operation = "status"
+	// OperationOverride sets or removes an override of an occurrence.
+	OperationOverride Operation = "override"
+	OperationRevert   Operation = "revert"
+	// OperationPurge permanently removes an event from the trash, the change
+	// has the fields it had as old values.
+	OperationPurge Operation = "purge"
+)
+
+// AnonymousActor is the actor of the changes made without WithActor.
+const AnonymousActor = "anonymous"
+
+// ErrVersionNotFound is returned when reverting to a version the history doesn't have.
+var ErrVersionNotFound = errors.New("version not found in the history")
+
+// Change is an entry of the history of an event. Every write of an event adds
+// one, in the same transaction, and it's never modified afterwards.
+type Change struct {
+	ID      int64 `json:"id"`
+	EventID int64 `json:"event_id"`
+	// Version is the version of the event after the change.
+	Version   int64     `json:"version"`
+	Operation Operation `json:"operation"`
+	// Actor is who made the change, see WithActor. It's hidden from the
+	// anonymous readers.
+	Actor     string    `json:"actor,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+	// Diff has the old and new values of the changed fields, by their JSON
+	// name. The old values are null on creation.
+	Diff map[string]FieldDiff `json:"diff"`
+	// snapshot has the fields after the change, to revert to them.
+	snapshot map[string]any
+}
+
+// FieldDiff is the change of a field, with the values of its JSON form.
+type FieldDiff struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+type actorKey struct{}
+
+// WithActor returns a context whose writes are recorded in the history as made by actor.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set by WithActor, or AnonymousActor.
+func ActorFrom(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return AnonymousActor
+}
+
+// ownerFrom returns the CreatedBy of the events created with ctx: its actor,
+// or nobody when it's anonymous.
+func ownerFrom(ctx context.Context) string {
+	if actor := ActorFrom(ctx); actor != AnonymousActor {
+		return actor
+	}
+	return ""
+}
+
+// unaudited are the fields left out of the history: they change on every
+// write, they never change, or they aren't stored with the event.
+var unaudited = []string{"id", "created_by", "created_at", "updated_at", "version", "venue", "distance_km", "snippet", "occurrence"}
+
+// snapshot returns the audited fields of event in their JSON form, nil for a nil event.
+func snapshot(event *Event) map[string]any {
+	if event == nil {
+		return nil
+	}
+	var fields map[string]any
+	data, err := json.Marshal(event)
+	if err == nil {
+		err = json.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		// an Event always has a JSON form
+		panic(err)
+	}
+	for _, name := range unaudited {
+		delete(fields, name)
+	}
+	return fields
+}
+
+// diff compares two snapshots, the fields missing from one are null.
+func diff(old, new map[string]any) map[string]FieldDiff {
+	changes := map[string]FieldDiff{}
+	for name, value := range new {
+		if !reflect.DeepEqual(old[name], value) {
+			changes[name] = FieldDiff{Old: old[name], New: value}
+		}
+	}
+	for name, value := range old {
+		if _, ok := new[name]; !ok {
+			changes[name] = FieldDiff{Old: value}
+		}
+	}
+	return changes
+}
+
+// fromSnapshot returns the event with the fields of a snapshot.
+func fromSnapshot(fields map[string]any) (Event, error) {
+	var event Event
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return event, err
+	}
+	err = json.Unmarshal(data, &event)
+	return event, err
+}
+
+// newChange returns the change of an event from old to event, without its id
+// and time. old is nil on creation, and event is nil on purge, which gets the
+// version following old and no fields.
+func newChange(ctx context.Context, op Operation, old, event *Event) Change {
+	change := Change{Operation: op, Actor: ActorFrom(ctx), snapshot: map[string]any{}}
+	if event == nil {
+		change.EventID, change.Version = old.ID, old.Version+1
+	} else {
+		change.EventID, change.Version = event.ID, event.Version
+		change.snapshot = snapshot(event)
+	}
+	change.Diff = diff(snapshot(old), change.snapshot)
+	return change
+}
+
+// record adds the change of an event from old to event to the history, db
+// should be the transaction of the change. See newChange.
+func record(ctx context.Context, db querier, op Operation, old, event *Event) error {
+	change := newChange(ctx, op, old, event)
+	_, err := db.Exec(ctx, `
+		INSERT INTO event_history (event_id, version, operation, actor, diff, snapshot) VALUES ($1, $2, $3, $4, $5, $6)`,
+		change.EventID, change.Version, string(change.Operation), change.Actor, change.Diff, change.snapshot)
+	return err
+}
+
+func (r *SQLRepository) History(ctx context.Context, id int64, log zerolog.Logger) ([]Change, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, event_id, version, operation, actor, changed_at, diff FROM event_history WHERE event_id = $1 ORDER BY id`, id)
+	if err != nil {
+		log.Err(err).Msg("History failed")
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+	changes := []Change{}
+	for rows.Next() {
+		var change Change
+		err := rows.Scan(&change.ID, &change.EventID, &change.Version, &change.Operation, &change.Actor, &change.ChangedAt, &change.Diff)
+		if err != nil {
+			log.Err(err).Msg("History failed")
+			return nil, translateError(err)
+		}
+		changes = append(changes, change)
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("History failed")
+		return nil, translateError(err)
+	}
+	if len(changes) > 0 {
+		return changes, nil
+	}
+	// the events written before the history have none
+	var exists bool
+	err = r.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM events WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		log.Err(err).Msg("History failed")
+		return nil, translateError(err)
+	}
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return changes, nil
+}
+
+func (r *SQLRepository) Revert(ctx context.Context, id int64, version int64, log zerolog.Logger) (*Event, error) {
+	var reverted Event
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		if current.DeletedAt != nil {
+			return ErrGone
+		}
+		var fields map[string]any
+		err := tx.QueryRow(ctx, `SELECT snapshot FROM event_history WHERE event_id = $1 AND version = $2`, id, version).Scan(&fields)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrVersionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		reverted, err = fromSnapshot(fields)
+		if err != nil {
+			return err
+		}
+		if err := reverted.Validate(); err != nil {
+			return err
+		}
+		return updateEvent(ctx, tx, current, &reverted, OperationRevert)
+	})
+	if err != nil {
+		log.Err(err).Msg("Revert failed")
+		return nil, translateError(err)
+	}
+	return &reverted, nil
+}
+
+// record adds the change of an event from old to event to the history, r.mu
+// must be held. See newChange.
+func (r *MemoryRepository) record(ctx context.Context, op Operation, old, event *Event) {
+	r.lastChangeID++
+	change := newChange(ctx, op, old, event)
+	change.ID = r.lastChangeID
+	if event == nil {
+		change.ChangedAt = now()
+	} else {
+		change.ChangedAt = event.UpdatedAt
+	}
+	r.history[change.EventID] = append(r.history[change.EventID], change)
+}
+
+func (r *MemoryRepository) History(ctx context.Context, id int64, log zerolog.Logger) ([]Change, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	changes := append([]Change{}, r.history[id]...)
+	if len(changes) == 0 {
+		return nil, ErrNotFound
+	}
+	return changes, nil
+}
+
+func (r *MemoryRepository) Revert(ctx context.Context, id int64, version int64, log zerolog.Logger) (*Event, error) {
+	r.mu.RLock()
+	_, err := r.current(id)
+	var fields map[string]any
+	for _, change := range r.history[id] {
+		if change.Version == version {
+			fields = change.snapshot
+		}
+	}
+	r.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, ErrVersionNotFound
+	}
+	reverted, err := fromSnapshot(fields)
+	if err != nil {
+		return nil, err
+	}
+	if err := reverted.Validate(); err != nil {
+		return nil, err
+	}
+	if err := r.checkVenue(ctx, reverted, log); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	current, err := r.current(id)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	reverted = r.update(ctx, OperationRevert, current, reverted)
+	r.mu.Unlock()
+	reverted = r.withVenue(ctx, reverted, log)
+	return &reverted, nil
+}
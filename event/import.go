@@ -0,0 +1,148 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// ImportResult tells what Repository.Import did.
+type ImportResult int
+
+const (
+	ImportCreated ImportResult = iota
+	ImportUpdated
+	// ImportUnchanged means the event was already up to date, it's left untouched.
+	ImportUnchanged
+)
+
+func (r ImportResult) String() string {
+	switch r {
+	case ImportCreated:
+		return "created"
+	case ImportUpdated:
+		return "updated"
+	case ImportUnchanged:
+		return "unchanged"
+	}
+	return fmt.Sprintf("ImportResult(%d)", int(r))
+}
+
+// errNoSourceUID is returned when importing an event that doesn't come from a calendar.
+var errNoSourceUID = errors.New("an imported event needs a source uid")
+
+// sameImport reports whether importing event over current changes nothing.
+func sameImport(current, event Event) bool {
+	if len(current.Tags) != len(event.Tags) {
+		return false
+	}
+	for i := range current.Tags {
+		if current.Tags[i] != event.Tags[i] {
+			return false
+		}
+	}
+	dates := normalizeExceptionDates(event.ExceptionDates)
+	if len(current.ExceptionDates) != len(dates) {
+		return false
+	}
+	for i := range dates {
+		if !current.ExceptionDates[i].Equal(dates[i]) {
+			return false
+		}
+	}
+	sameVenue := current.VenueID == nil && event.VenueID == nil ||
+		current.VenueID != nil && event.VenueID != nil && *current.VenueID == *event.VenueID
+	return sameVenue &&
+		current.Title == event.Title &&
+		current.Description == event.Description &&
+		current.Location == event.Location &&
+		current.InstagramPage == event.InstagramPage &&
+		current.Recurrence == normalizeRecurrence(event.Recurrence) &&
+		current.StartTime.Equal(event.StartTime.Round(time.Microsecond)) &&
+		current.EndTime.Equal(event.EndTime.Round(time.Microsecond))
+}
+
+func (r *SQLRepository) Import(ctx context.Context, event Event, log zerolog.Logger) (*Event, ImportResult, error) {
+	if event.SourceUID == "" {
+		return nil, 0, errNoSourceUID
+	}
+	event.Tags = normalizeTags(event.Tags)
+	result := ImportCreated
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		err := scanEvent(tx.QueryRow(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.source_uid = $1 FOR UPDATE OF e`, event.SourceUID), &current)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return insertEvent(ctx, tx, &event)
+		}
+		if err != nil {
+			return err
+		}
+		if current.DeletedAt != nil {
+			result, event = ImportUnchanged, current
+			return nil
+		}
+		if event.VenueID == nil {
+			event.VenueID = current.VenueID
+		}
+		if sameImport(current, event) {
+			result, event = ImportUnchanged, current
+			return nil
+		}
+		result = ImportUpdated
+		return updateEvent(ctx, tx, current, &event, OperationUpdate)
+	})
+	if err != nil {
+		log.Err(err).Msg("Import failed")
+		return nil, 0, translateError(err)
+	}
+	return &event, result, nil
+}
+
+func (r *MemoryRepository) Import(ctx context.Context, event Event, log zerolog.Logger) (*Event, ImportResult, error) {
+	if event.SourceUID == "" {
+		return nil, 0, errNoSourceUID
+	}
+	event.Tags = normalizeTags(event.Tags)
+	if err := r.checkVenue(ctx, event, log); err != nil {
+		return nil, 0, err
+	}
+	r.mu.Lock()
+	var current *Event
+	for _, e := range r.events {
+		if e.SourceUID == event.SourceUID {
+			e := e
+			current = &e
+			break
+		}
+	}
+	for _, e := range r.trash {
+		if e.SourceUID == event.SourceUID {
+			e := e
+			current = &e
+			break
+		}
+	}
+	var result ImportResult
+	switch {
+	case current != nil && current.DeletedAt != nil:
+		result, event = ImportUnchanged, *current
+	case current == nil:
+		result, event = ImportCreated, r.insert(ctx, event)
+	default:
+		if event.VenueID == nil {
+			event.VenueID = current.VenueID
+		}
+		if sameImport(*current, event) {
+			result, event = ImportUnchanged, *current
+		} else {
+			result, event = ImportUpdated, r.update(ctx, OperationUpdate, *current, event)
+		}
+	}
+	r.mu.Unlock()
+	event = r.withVenue(ctx, event, log)
+	return &event, result, nil
+}
@@ -0,0 +1,302 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+)
+
+// MemoryRepository is a Repository keeping the events in memory, with the same
+// semantics as SQLRepository. It's meant for tests and local demos, and is safe
+// for concurrent use.
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	lastID int64
+	events map[int64]Event
+	// trash holds the deleted events, with their DeletedAt set.
+	trash map[int64]Event
+	// history has the changes of the events by event id, oldest first.
+	history      map[int64][]Change
+	lastChangeID int64
+	// venues is never called while mu is held, it calls back usesVenue.
+	venues *venue.MemoryRepository
+}
+
+var _ Repository = (*MemoryRepository)(nil)
+
+// EventMemoryRepository returns a repository whose events reference the venues
+// of the given one, which refuses to delete the venues in use.
+func EventMemoryRepository(venues *venue.MemoryRepository) *MemoryRepository {
+	r := &MemoryRepository{events: map[int64]Event{}, trash: map[int64]Event{}, history: map[int64][]Change{}, venues: venues}
+	venues.SetInUse(r.usesVenue)
+	return r
+}
+
+func (r *MemoryRepository) usesVenue(id int64) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, event := range r.events {
+		if event.VenueID != nil && *event.VenueID == id {
+			return true
+		}
+	}
+	// like the foreign key, the trash keeps its venues
+	for _, event := range r.trash {
+		if event.VenueID != nil && *event.VenueID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkVenue mimics the foreign key of the venue_id column.
+func (r *MemoryRepository) checkVenue(ctx context.Context, event Event, log zerolog.Logger) error {
+	if event.VenueID == nil {
+		return nil
+	}
+	_, err := r.venues.GetByID(ctx, *event.VenueID, log)
+	if errors.Is(err, venue.ErrNotFound) {
+		return unknownVenue()
+	}
+	return err
+}
+
+// withVenue returns the event with the current details of its venue, the
+// stored events only keep the id.
+func (r *MemoryRepository) withVenue(ctx context.Context, event Event, log zerolog.Logger) Event {
+	event.Venue = nil
+	if event.VenueID != nil {
+		event.Venue, _ = r.venues.GetByID(ctx, *event.VenueID, log)
+	}
+	return event
+}
+
+// now mimics the precision of the timestamps stored by Postgres.
+func now() time.Time {
+	return time.Now().Round(time.Microsecond)
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, event Event, log zerolog.Logger) (*Event, error) {
+	event.SourceUID = ""
+	if err := r.checkVenue(ctx, event, log); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	event = r.insert(ctx, event)
+	r.mu.Unlock()
+	event = r.withVenue(ctx, event, log)
+	return &event, nil
+}
+
+// insert stores a new event and records its creation, r.mu must be held.
+func (r *MemoryRepository) insert(ctx context.Context, event Event) Event {
+	r.lastID++
+	event.ID = r.lastID
+	event.StartTime = event.StartTime.Round(time.Microsecond)
+	event.EndTime = event.EndTime.Round(time.Microsecond)
+	event.CreatedBy = ownerFrom(ctx)
+	event.CreatedAt = now()
+	event.UpdatedAt = event.CreatedAt
+	event.Version = 1
+	if event.Status == "" {
+		event.Status = StatusPublished
+	}
+	event.Tags = normalizeTags(event.Tags)
+	event.Recurrence = normalizeRecurrence(event.Recurrence)
+	event.ExceptionDates = normalizeExceptionDates(event.ExceptionDates)
+	event.Overrides = []Override{}
+	event.Occurrence = nil
+	event.Venue = nil
+	r.events[event.ID] = event
+	r.record(ctx, OperationCreate, nil, &event)
+	return event
+}
+
+// current returns the event id, r.mu must be held. ErrGone is returned when
+// it's in the trash.
+func (r *MemoryRepository) current(id int64) (Event, error) {
+	if _, ok := r.trash[id]; ok {
+		return Event{}, ErrGone
+	}
+	event, ok := r.events[id]
+	if !ok {
+		return Event{}, ErrNotFound
+	}
+	return event, nil
+}
+
+func (r *MemoryRepository) GetByID(ctx context.Context, id int64, log zerolog.Logger) (*Event, error) {
+	r.mu.RLock()
+	event, ok := r.events[id]
+	_, deleted := r.trash[id]
+	r.mu.RUnlock()
+	if deleted {
+		return nil, ErrGone
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	event = r.withVenue(ctx, event, log)
+	return &event, nil
+}
+
+func (r *MemoryRepository) Owner(ctx context.Context, id int64, log zerolog.Logger) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if event, ok := r.events[id]; ok {
+		return event.CreatedBy, nil
+	}
+	if event, ok := r.trash[id]; ok {
+		return event.CreatedBy, nil
+	}
+	return "", ErrNotFound
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, id int64, newEvent Event, log zerolog.Logger) (*Event, error) {
+	if err := r.checkVenue(ctx, newEvent, log); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	current, err := r.current(id)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	if newEvent.Version != 0 && newEvent.Version != current.Version {
+		r.mu.Unlock()
+		return nil, ErrVersionMismatch
+	}
+	updated := r.update(ctx, OperationUpdate, current, newEvent)
+	r.mu.Unlock()
+	updated = r.withVenue(ctx, updated, log)
+	return &updated, nil
+}
+
+func (r *MemoryRepository) Patch(ctx context.Context, id int64, patch Patch, log zerolog.Logger) (*Event, error) {
+	if patch.VenueID != nil && *patch.VenueID != 0 {
+		if err := r.checkVenue(ctx, Event{VenueID: patch.VenueID}, log); err != nil {
+			return nil, err
+		}
+	}
+	r.mu.Lock()
+	current, err := r.current(id)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	if patch.Version != 0 && patch.Version != current.Version {
+		r.mu.Unlock()
+		return nil, ErrVersionMismatch
+	}
+	patched := patch.Apply(current)
+	if err := patched.Validate(); err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	updated := r.update(ctx, OperationUpdate, current, patched)
+	r.mu.Unlock()
+	updated = r.withVenue(ctx, updated, log)
+	return &updated, nil
+}
+
+// update replaces current with the editable fields of newEvent and records the
+// change as op, r.mu must be held. The overrides are kept, unless the event
+// isn't recurring anymore.
+func (r *MemoryRepository) update(ctx context.Context, op Operation, current, newEvent Event) Event {
+	old := current
+	current.Title = newEvent.Title
+	current.Description = newEvent.Description
+	current.Location = newEvent.Location
+	current.InstagramPage = newEvent.InstagramPage
+	current.StartTime = newEvent.StartTime.Round(time.Microsecond)
+	current.EndTime = newEvent.EndTime.Round(time.Microsecond)
+	current.Tags = normalizeTags(newEvent.Tags)
+	current.Recurrence = normalizeRecurrence(newEvent.Recurrence)
+	current.ExceptionDates = normalizeExceptionDates(newEvent.ExceptionDates)
+	if current.Recurrence == "" {
+		current.Overrides = []Override{}
+	}
+	current.VenueID = newEvent.VenueID
+	return r.touch(ctx, op, old, current)
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id int64, version int64, log zerolog.Logger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.trash[id]; ok {
+		return ErrGone
+	}
+	current, ok := r.events[id]
+	if !ok {
+		return ErrNotFound
+	}
+	if version != 0 && version != current.Version {
+		return ErrVersionMismatch
+	}
+	deletedAt := now()
+	deleted := current
+	deleted.DeletedAt = &deletedAt
+	deleted = r.touch(ctx, OperationDelete, current, deleted)
+	delete(r.events, id)
+	r.trash[id] = deleted
+	return nil
+}
+
+// All returns the events ordered by id.
+func (r *MemoryRepository) All(ctx context.Context, log zerolog.Logger) ([]Event, error) {
+	r.mu.RLock()
+	events := make([]Event, 0, len(r.events))
+	for _, event := range r.events {
+		events = append(events, event)
+	}
+	r.mu.RUnlock()
+	sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	for i := range events {
+		events[i] = r.withVenue(ctx, events[i], log)
+	}
+	return events, nil
+}
+
+func (r *MemoryRepository) List(ctx context.Context, filter Filter, log zerolog.Logger) (*Page, error) {
+	if err := filter.check(); err != nil {
+		return nil, err
+	}
+	r.mu.RLock()
+	all := make([]Event, 0, len(r.events))
+	for _, event := range r.events {
+		all = append(all, event)
+	}
+	r.mu.RUnlock()
+
+	events := []Event{}
+	for _, event := range all {
+		event = r.withVenue(ctx, event, log)
+		event.DistanceKm = filter.distanceKm(event)
+		if filter.Query != "" {
+			event.rank, _ = searchRank(event, filter.Query)
+		}
+		occurrences := []Event{event}
+		if event.Recurrence != "" {
+			occurrences = filter.occurrences(event)
+		}
+		for _, occurrence := range occurrences {
+			if !filter.matches(occurrence) {
+				continue
+			}
+			if filter.Query != "" {
+				occurrence.Snippet = highlight(searchSnippet(occurrence, filter.Query))
+			}
+			events = append(events, occurrence)
+		}
+	}
+	filter.sortEvents(events)
+	if filter.Limit > 0 && len(events) > filter.Limit+1 {
+		events = events[:filter.Limit+1]
+	}
+	return filter.page(events), nil
+}
@@ -0,0 +1,16 @@
+package event_test
+
+import (
+	"testing"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/event/eventtest"
+	"github.com/perebaj/ondehj/venue"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	eventtest.RunRepositoryTests(t, func(t *testing.T) eventtest.Repositories {
+		venues := venue.VenueMemoryRepository()
+		return eventtest.Repositories{Events: event.EventMemoryRepository(venues), Venues: venues}
+	})
+}
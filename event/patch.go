@@ -0,0 +1,150 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Patch is a partial update of an event following the JSON Merge Patch
+// semantics (RFC 7396): nil fields are left untouched, and fields set to null
+// in the JSON document are cleared.
+type Patch struct {
+	Title         *string
+	Description   *string
+	Location      *string
+	StartTime     *time.Time
+	EndTime       *time.Time
+	InstagramPage *string
+	// Tags replaces all the tags of the event.
+	Tags *[]string
+	// Recurrence set to "" makes the event a single one again.
+	Recurrence *string
+	// ExceptionDates replaces all the exception dates of the event.
+	ExceptionDates *[]time.Time
+	// VenueID set to zero removes the venue of the event.
+	VenueID *int64
+	// Version, when not zero, makes the patch conditional like Event.Version in Update.
+	Version int64
+}
+
+// UnmarshalJSON decodes a merge patch document. Read-only fields are ignored,
+// unknown fields and null values for required fields are rejected.
+func (p *Patch) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if fields == nil {
+		return fmt.Errorf("a merge patch must be a JSON object")
+	}
+	for name, raw := range fields {
+		null := bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+		var err error
+		switch name {
+		case "title":
+			if null {
+				return fmt.Errorf("title can't be removed")
+			}
+			err = json.Unmarshal(raw, &p.Title)
+		case "description":
+			p.Description, err = optionalString(raw, null)
+		case "location":
+			p.Location, err = optionalString(raw, null)
+		case "instagram_page":
+			p.InstagramPage, err = optionalString(raw, null)
+		case "start_time":
+			if null {
+				return fmt.Errorf("start_time can't be removed")
+			}
+			err = json.Unmarshal(raw, &p.StartTime)
+		case "end_time":
+			if null {
+				return fmt.Errorf("end_time can't be removed")
+			}
+			err = json.Unmarshal(raw, &p.EndTime)
+		case "tags":
+			tags := []string{}
+			if !null {
+				err = json.Unmarshal(raw, &tags)
+			}
+			p.Tags = &tags
+		case "recurrence":
+			p.Recurrence, err = optionalString(raw, null)
+		case "exception_dates":
+			dates := []time.Time{}
+			if !null {
+				err = json.Unmarshal(raw, &dates)
+			}
+			p.ExceptionDates = &dates
+		case "venue_id":
+			if null {
+				var none int64
+				p.VenueID = &none
+				break
+			}
+			err = json.Unmarshal(raw, &p.VenueID)
+			if err == nil && *p.VenueID < 1 {
+				return fmt.Errorf("venue_id must be a venue id or null")
+			}
+		case "id", "created_by", "created_at", "updated_at", "version", "venue", "source_uid", "overrides", "occurrence", "status", "status_reason", "deleted_at":
+			// read-only, clients often send back the whole event
+		default:
+			return fmt.Errorf("unknown field %q", name)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// optionalString decodes an optional text field, null clears it.
+func optionalString(raw json.RawMessage, null bool) (*string, error) {
+	s := ""
+	if null {
+		return &s, nil
+	}
+	err := json.Unmarshal(raw, &s)
+	return &s, err
+}
+
+// Apply returns a copy of e with the patch applied.
+func (p Patch) Apply(e Event) Event {
+	if p.Title != nil {
+		e.Title = *p.Title
+	}
+	if p.Description != nil {
+		e.Description = *p.Description
+	}
+	if p.Location != nil {
+		e.Location = *p.Location
+	}
+	if p.StartTime != nil {
+		e.StartTime = *p.StartTime
+	}
+	if p.EndTime != nil {
+		e.EndTime = *p.EndTime
+	}
+	if p.InstagramPage != nil {
+		e.InstagramPage = *p.InstagramPage
+	}
+	if p.Tags != nil {
+		e.Tags = append([]string{}, *p.Tags...)
+	}
+	if p.Recurrence != nil {
+		e.Recurrence = *p.Recurrence
+	}
+	if p.ExceptionDates != nil {
+		e.ExceptionDates = append([]time.Time{}, *p.ExceptionDates...)
+	}
+	if p.VenueID != nil {
+		e.VenueID, e.Venue = nil, nil
+		if *p.VenueID != 0 {
+			id := *p.VenueID
+			e.VenueID = &id
+		}
+	}
+	return e
+}
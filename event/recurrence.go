@@ -0,0 +1,395 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/perebaj/ondehj/ical"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// ErrNotRecurring is returned when overriding an occurrence of an event without recurrence.
+	ErrNotRecurring = errors.New("event isn't recurring")
+	// ErrOverrideNotFound is returned when removing an override that doesn't exist.
+	ErrOverrideNotFound = fmt.Errorf("override not found: %w", pgx.ErrNoRows)
+)
+
+const (
+	maxRecurrenceLength = 500
+	maxExceptionDates   = 200
+	// recurrenceHorizon is how far ahead the endless series are expanded when
+	// Filter.To isn't set.
+	recurrenceHorizon = 366 * 24 * time.Hour
+	// maxOccurrences bounds the occurrences of a series expanded by a listing.
+	maxOccurrences = 1000
+)
+
+// lastTime is later than the last occurrence of any series ending with UNTIL or COUNT.
+var lastTime = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
+// Override replaces an occurrence of a recurring event, identified by its
+// original start, without changing the series.
+type Override struct {
+	Occurrence time.Time `json:"occurrence"`
+	// Cancelled occurrences are left out of the listings.
+	Cancelled bool `json:"cancelled"`
+	// StartTime and EndTime move the occurrence, they're required unless it's cancelled.
+	StartTime *time.Time `json:"start_time,omitempty"`
+	EndTime   *time.Time `json:"end_time,omitempty"`
+}
+
+// Validate checks an override before it's set.
+// It returns a *ValidationError listing every invalid field, or nil.
+func (o Override) Validate() error {
+	verr := ValidationError{Subject: "override"}
+	if o.Occurrence.IsZero() {
+		verr.Add("occurrence", "is required")
+	}
+	if o.Cancelled {
+		return verr.Err()
+	}
+	if o.StartTime == nil {
+		verr.Add("start_time", "is required unless cancelled")
+	} else if o.StartTime.Before(minTime) {
+		verr.Add("start_time", "must be after %s", minTime.Format("2006-01-02"))
+	}
+	if o.EndTime == nil {
+		verr.Add("end_time", "is required unless cancelled")
+	} else if o.StartTime != nil && o.EndTime.Before(*o.StartTime) {
+		verr.Add("end_time", "must not be before start_time")
+	}
+	return verr.Err()
+}
+
+// normalize rounds the times like Postgres does and drops the times of a cancellation.
+func (o Override) normalize() Override {
+	o.Occurrence = o.Occurrence.Round(time.Microsecond)
+	if o.Cancelled {
+		o.StartTime, o.EndTime = nil, nil
+		return o
+	}
+	start, end := o.StartTime.Round(time.Microsecond), o.EndTime.Round(time.Microsecond)
+	o.StartTime, o.EndTime = &start, &end
+	return o
+}
+
+// normalizeRecurrence returns the RRULE value of a recurrence, which may be
+// given as a RRULE content line.
+func normalizeRecurrence(recurrence string) string {
+	recurrence = strings.TrimSpace(recurrence)
+	if len(recurrence) > len("RRULE:") && strings.EqualFold(recurrence[:len("RRULE:")], "RRULE:") {
+		recurrence = recurrence[len("RRULE:"):]
+	}
+	return recurrence
+}
+
+// normalizeExceptionDates returns the sorted and unique exception dates, rounded
+// like Postgres does, never nil.
+func normalizeExceptionDates(dates []time.Time) []time.Time {
+	normalized := []time.Time{}
+	for _, d := range dates {
+		normalized = append(normalized, d.Round(time.Microsecond))
+	}
+	sort.Slice(normalized, func(i, j int) bool { return normalized[i].Before(normalized[j]) })
+	unique := normalized[:0]
+	for i, d := range normalized {
+		if i == 0 || !d.Equal(normalized[i-1]) {
+			unique = append(unique, d)
+		}
+	}
+	return unique
+}
+
+// validateRecurrence adds the problems of the recurrence of e to verr.
+func validateRecurrence(e Event, verr *ValidationError) {
+	recurrence := normalizeRecurrence(e.Recurrence)
+	if recurrence == "" {
+		if len(e.ExceptionDates) > 0 {
+			verr.Add("exception_dates", "need a recurrence")
+		}
+		return
+	}
+	if len(recurrence) > maxRecurrenceLength {
+		verr.Add("recurrence", "must be at most %d characters long", maxRecurrenceLength)
+	} else if _, err := ical.ParseRule(recurrence, time.UTC); errors.Is(err, ical.ErrUnsupportedRule) {
+		verr.Add("recurrence", "isn't supported, only daily, weekly, monthly and yearly rules are (%v)", err)
+	} else if err != nil {
+		verr.Add("recurrence", "must be a RRULE such as FREQ=WEEKLY;BYDAY=FR (%v)", err)
+	}
+	if len(e.ExceptionDates) > maxExceptionDates {
+		verr.Add("exception_dates", "must have at most %d dates", maxExceptionDates)
+	}
+}
+
+// HasOccurrence reports whether an occurrence of the recurring event e starts
+// at t, expanding its recurrence in loc. Excluded occurrences don't count.
+func (e Event) HasOccurrence(t time.Time, loc *time.Location) bool {
+	rule, err := ical.ParseRule(normalizeRecurrence(e.Recurrence), loc)
+	if e.Recurrence == "" || err != nil {
+		return false
+	}
+	for _, d := range e.ExceptionDates {
+		if d.Equal(t) {
+			return false
+		}
+	}
+	return len(rule.Between(e.StartTime.In(loc), t, t.Add(time.Microsecond))) > 0
+}
+
+// location is the timezone the series are expanded in.
+func (f Filter) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// horizon is the instant the occurrences listed must start before.
+func (f Filter) horizon() time.Time {
+	if !f.To.IsZero() {
+		if f.To.Equal(f.From) {
+			// the events running at an instant may start at it
+			return f.To.Add(time.Microsecond)
+		}
+		return f.To
+	}
+	from := time.Now()
+	if f.From.After(from) {
+		from = f.From
+	}
+	return from.Add(recurrenceHorizon)
+}
+
+// occurrences returns the occurrences of the recurring event series that may
+// be in the window of f, as copies of the series with the times of the
+// occurrence and its original start in Occurrence. The excluded and cancelled
+// occurrences are left out, the moved ones are at their new times.
+func (f Filter) occurrences(series Event) []Event {
+	loc := f.location()
+	rule, err := ical.ParseRule(normalizeRecurrence(series.Recurrence), loc)
+	if err != nil {
+		// the recurrences are validated on write
+		return nil
+	}
+	start := series.StartTime.In(loc)
+	duration := series.EndTime.Sub(series.StartTime)
+	excluded := map[int64]bool{}
+	for _, d := range series.ExceptionDates {
+		excluded[d.UnixMicro()] = true
+	}
+	overrides := map[int64]Override{}
+	for _, o := range series.Overrides {
+		overrides[o.Occurrence.UnixMicro()] = o
+	}
+
+	var occurrences []Event
+	seen := map[int64]bool{}
+	add := func(original time.Time) {
+		key := original.UnixMicro()
+		seen[key] = true
+		if excluded[key] || len(occurrences) == maxOccurrences {
+			return
+		}
+		occurrence := series
+		occurrence.Occurrence = &original
+		occurrence.StartTime, occurrence.EndTime = original, original.Add(duration)
+		occurrence.ExceptionDates, occurrence.Overrides = nil, nil
+		if o, ok := overrides[key]; ok {
+			if o.Cancelled {
+				return
+			}
+			occurrence.StartTime, occurrence.EndTime = *o.StartTime, *o.EndTime
+		}
+		occurrences = append(occurrences, occurrence)
+	}
+	// without From the window starts now, like the horizon, so that the
+	// occurrences capped at maxOccurrences aren't the oldest of the series
+	from := time.Now().Add(-duration)
+	if !f.From.IsZero() {
+		from = f.From.Add(-duration)
+	}
+	for _, t := range rule.Between(start, from, f.horizon()) {
+		add(t)
+	}
+	// the occurrences moved into the window from outside of it
+	for _, o := range series.Overrides {
+		if !o.Cancelled && !seen[o.Occurrence.UnixMicro()] && len(rule.Between(start, o.Occurrence, o.Occurrence.Add(time.Microsecond))) > 0 {
+			add(o.Occurrence.In(loc))
+		}
+	}
+	return occurrences
+}
+
+// endsAfter reports whether e ends after t or, when it's a series, one of its
+// occurrences does. The series without UNTIL or COUNT never end.
+func (e Event) endsAfter(t time.Time) bool {
+	if e.EndTime.After(t) {
+		return true
+	}
+	if e.Recurrence == "" {
+		return false
+	}
+	rule, err := ical.ParseRule(normalizeRecurrence(e.Recurrence), time.UTC)
+	if err != nil {
+		// the recurrences are validated on write
+		return false
+	}
+	if rule.Until.IsZero() && rule.Count == 0 {
+		return true
+	}
+	skipped := map[int64]bool{}
+	for _, d := range e.ExceptionDates {
+		skipped[d.UnixMicro()] = true
+	}
+	for _, o := range e.Overrides {
+		skipped[o.Occurrence.UnixMicro()] = true
+		if !o.Cancelled && o.EndTime.After(t) {
+			return true
+		}
+	}
+	duration := e.EndTime.Sub(e.StartTime)
+	for _, start := range rule.Between(e.StartTime.UTC(), t.Add(-duration), lastTime) {
+		if !skipped[start.UnixMicro()] && start.Add(duration).After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// overridesColumn is the overrides of an event aliased as e, as a JSON array
+// ordered by occurrence.
+const overridesColumn = `coalesce((SELECT json_agg(json_build_object('occurrence', o.occurrence, 'cancelled', o.cancelled, 'start_time', o.start_time, 'end_time', o.end_time) ORDER BY o.occurrence) FROM event_overrides o WHERE o.event_id = e.id), '[]')`
+
+func (r *SQLRepository) SetOverride(ctx context.Context, id int64, override Override, log zerolog.Logger) (*Event, error) {
+	override = override.normalize()
+	var event Event
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockLiveEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		if current.Recurrence == "" {
+			return ErrNotRecurring
+		}
+		_, err := tx.Exec(ctx, `
+			INSERT INTO event_overrides (event_id, occurrence, cancelled, start_time, end_time) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (event_id, occurrence) DO UPDATE SET cancelled = excluded.cancelled, start_time = excluded.start_time, end_time = excluded.end_time`,
+			id, override.Occurrence, override.Cancelled, override.StartTime, override.EndTime)
+		if err != nil {
+			return err
+		}
+		return touchEvent(ctx, tx, current, &event)
+	})
+	if err != nil {
+		log.Err(err).Msg("SetOverride failed")
+		return nil, translateError(err)
+	}
+	return &event, nil
+}
+
+func (r *SQLRepository) DeleteOverride(ctx context.Context, id int64, occurrence time.Time, log zerolog.Logger) (*Event, error) {
+	var event Event
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockLiveEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		res, err := tx.Exec(ctx, `DELETE FROM event_overrides WHERE event_id = $1 AND occurrence = $2`, id, occurrence)
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return ErrOverrideNotFound
+		}
+		return touchEvent(ctx, tx, current, &event)
+	})
+	if errors.Is(err, ErrOverrideNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		log.Err(err).Msg("DeleteOverride failed")
+		return nil, translateError(err)
+	}
+	return &event, nil
+}
+
+// touchEvent bumps the version of current, whose overrides changed, reads it
+// back into event and records the change.
+func touchEvent(ctx context.Context, db querier, current Event, event *Event) error {
+	_, err := db.Exec(ctx, `UPDATE events SET updated_at = now(), version = version + 1 WHERE id = $1`, current.ID)
+	if err != nil {
+		return err
+	}
+	if err := getEvent(ctx, db, current.ID, event); err != nil {
+		return err
+	}
+	return record(ctx, db, OperationOverride, &current, event)
+}
+
+func (r *MemoryRepository) SetOverride(ctx context.Context, id int64, override Override, log zerolog.Logger) (*Event, error) {
+	override = override.normalize()
+	r.mu.Lock()
+	current, err := r.current(id)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	if current.Recurrence == "" {
+		r.mu.Unlock()
+		return nil, ErrNotRecurring
+	}
+	overrides := []Override{override}
+	for _, o := range current.Overrides {
+		if !o.Occurrence.Equal(override.Occurrence) {
+			overrides = append(overrides, o)
+		}
+	}
+	sort.Slice(overrides, func(i, j int) bool { return overrides[i].Occurrence.Before(overrides[j].Occurrence) })
+	changed := current
+	changed.Overrides = overrides
+	changed = r.touch(ctx, OperationOverride, current, changed)
+	r.mu.Unlock()
+	changed = r.withVenue(ctx, changed, log)
+	return &changed, nil
+}
+
+func (r *MemoryRepository) DeleteOverride(ctx context.Context, id int64, occurrence time.Time, log zerolog.Logger) (*Event, error) {
+	r.mu.Lock()
+	current, err := r.current(id)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	overrides := []Override{}
+	for _, o := range current.Overrides {
+		if !o.Occurrence.Equal(occurrence) {
+			overrides = append(overrides, o)
+		}
+	}
+	if len(overrides) == len(current.Overrides) {
+		r.mu.Unlock()
+		return nil, ErrOverrideNotFound
+	}
+	changed := current
+	changed.Overrides = overrides
+	changed = r.touch(ctx, OperationOverride, current, changed)
+	r.mu.Unlock()
+	changed = r.withVenue(ctx, changed, log)
+	return &changed, nil
+}
+
+// touch stores event as a new version and records the change from old as op,
+// r.mu must be held.
+func (r *MemoryRepository) touch(ctx context.Context, op Operation, old, event Event) Event {
+	event.UpdatedAt = now()
+	event.Version++
+	r.events[event.ID] = event
+	r.record(ctx, op, &old, &event)
+	return event
+}
@@ -0,0 +1,150 @@
+package event
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// markStart and markEnd surround the matches in the raw snippets, they are
+	// replaced by <mark> tags once the text is escaped.
+	markStart = "\x02"
+	markEnd   = "\x03"
+	// headlineOptions configures ts_headline for the snippets.
+	headlineOptions = "StartSel=" + markStart + ", StopSel=" + markEnd + ", MinWords=10, MaxWords=30, MaxFragments=2, FragmentDelimiter=\" … \""
+	// snippetWords is the size of the snippets computed in memory.
+	snippetWords = 30
+)
+
+// highlight turns a raw snippet into HTML, where the matches are within <mark>
+// tags and the rest of the text is escaped.
+func highlight(raw string) string {
+	escaped := html.EscapeString(raw)
+	return strings.NewReplacer(markStart, "<mark>", markEnd, "</mark>").Replace(escaped)
+}
+
+// searchText is the text the snippets are taken from, in Postgres and in memory.
+func searchText(e Event) string {
+	parts := []string{}
+	for _, s := range []string{e.Title, e.Location, e.InstagramPage, e.Description} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// fold lowercases s and removes its accents, like the unaccent dictionary does.
+func fold(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return strings.ToLower(folded)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// words splits s into folded words.
+func words(s string) []string {
+	return strings.FieldsFunc(fold(s), func(r rune) bool { return !isWordRune(r) })
+}
+
+// matchesWord reports whether a word of the text matches a term of the query.
+// Prefixes stand in for the stemming Postgres does: "festas" matches "festa".
+func matchesWord(word string, terms []string) bool {
+	for _, term := range terms {
+		if strings.HasPrefix(word, term) || (strings.HasPrefix(term, word) && len(word) >= 4) {
+			return true
+		}
+	}
+	return false
+}
+
+// searchRank is the in-memory counterpart of ts_rank: every term must be in the
+// event, and the matches count more in the title than in the location or the
+// Instagram page, and more there than in the description. ok is false when a
+// term isn't in the event.
+func searchRank(e Event, query string) (rank float64, ok bool) {
+	fields := []struct {
+		text   string
+		weight float64
+	}{
+		{e.Title, 1}, {e.Location, 0.4}, {e.InstagramPage, 0.4}, {e.Description, 0.2},
+	}
+	for _, term := range words(query) {
+		found := false
+		for _, field := range fields {
+			for _, word := range words(field.text) {
+				if matchesWord(word, []string{term}) {
+					rank += field.weight
+					found = true
+				}
+			}
+		}
+		if !found {
+			return 0, false
+		}
+	}
+	return rank, true
+}
+
+// searchSnippet is the in-memory counterpart of ts_headline: the words around
+// the first match, with the matches marked.
+func searchSnippet(e Event, query string) string {
+	terms := words(query)
+	text := []rune(searchText(e))
+	type span struct{ start, end int }
+	var spans []span
+	for i := 0; i < len(text); {
+		if !isWordRune(text[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(text) && isWordRune(text[j]) {
+			j++
+		}
+		spans = append(spans, span{i, j})
+		i = j
+	}
+	first := -1
+	for k, s := range spans {
+		if matchesWord(fold(string(text[s.start:s.end])), terms) {
+			first = k
+			break
+		}
+	}
+	if first < 0 {
+		return ""
+	}
+	from := first - snippetWords/3
+	if from < 0 {
+		from = 0
+	}
+	to := from + snippetWords
+	if to > len(spans) {
+		to = len(spans)
+	}
+	var b strings.Builder
+	pos := spans[from].start
+	for _, s := range spans[from:to] {
+		b.WriteString(string(text[pos:s.start]))
+		word := string(text[s.start:s.end])
+		if matchesWord(fold(word), terms) {
+			b.WriteString(markStart + word + markEnd)
+		} else {
+			b.WriteString(word)
+		}
+		pos = s.end
+	}
+	return b.String()
+}
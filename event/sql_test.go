@@ -0,0 +1,62 @@
+package event_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/event/eventtest"
+	"github.com/perebaj/ondehj/migration"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/stretchr/testify/require"
+)
+
+// TestSQLRepository needs a running Postgres, see make test/integration. The
+// tables are created in a throwaway schema, so any database can be used. It
+// fails instead of skipping on CI, which provides the database.
+func TestSQLRepository(t *testing.T) {
+	url := os.Getenv("ONDEHOJE_TEST_DATABASE_URL")
+	if url == "" {
+		if os.Getenv("CI") != "" {
+			t.Fatal("ONDEHOJE_TEST_DATABASE_URL must be set on CI")
+		}
+		t.Skip("ONDEHOJE_TEST_DATABASE_URL isn't set")
+	}
+	ctx := context.Background()
+
+	schema := fmt.Sprintf("eventtest_%d", time.Now().UnixNano())
+	conn, err := pgx.Connect(ctx, url)
+	require.NoError(t, err)
+	defer conn.Close(ctx)
+	_, err = conn.Exec(ctx, `CREATE SCHEMA `+schema)
+	require.NoError(t, err)
+	defer func() {
+		_, err := conn.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`)
+		require.NoError(t, err)
+	}()
+
+	cfg, err := pgxpool.ParseConfig(url)
+	require.NoError(t, err)
+	// public holds the extensions that were already created, like earthdistance
+	cfg.ConnConfig.RuntimeParams["search_path"] = schema + ", public"
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	require.NoError(t, err)
+	defer pool.Close()
+
+	migrator, err := migration.New(pool)
+	require.NoError(t, err)
+	_, err = migrator.Up(ctx)
+	require.NoError(t, err)
+
+	eventtest.RunRepositoryTests(t, func(t *testing.T) eventtest.Repositories {
+		// event_history has no foreign key to events, the cascade doesn't reach it
+		_, err := pool.Exec(ctx, `TRUNCATE events, event_overrides, event_history, venues, tags RESTART IDENTITY CASCADE`)
+		require.NoError(t, err)
+		return eventtest.Repositories{Events: event.EventSQLRepository(pool), Venues: venue.VenueSQLRepository(pool)}
+	})
+}
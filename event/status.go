@@ -0,0 +1,169 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+// Status is the stage of the lifecycle of an event.
+type Status string
+
+const (
+	// StatusDraft events are being prepared, the public listings hide them.
+	StatusDraft     Status = "draft"
+	StatusPublished Status = "published"
+	// StatusCancelled events won't take place, they're still listed so the
+	// links already shared keep working.
+	StatusCancelled Status = "cancelled"
+	// StatusPostponed events won't take place at their times, new ones are yet to be set.
+	StatusPostponed Status = "postponed"
+)
+
+// Statuses lists every status, in the order of the lifecycle.
+var Statuses = []Status{StatusDraft, StatusPublished, StatusCancelled, StatusPostponed}
+
+// PublicStatuses are the statuses listed unless asked otherwise: all but drafts.
+var PublicStatuses = []Status{StatusPublished, StatusCancelled, StatusPostponed}
+
+// transitions is the state machine of the statuses: the statuses each one can go to.
+var transitions = map[Status][]Status{
+	StatusDraft:     {StatusPublished},
+	StatusPublished: {StatusCancelled, StatusPostponed},
+	StatusCancelled: {StatusPublished},
+	StatusPostponed: {StatusPublished, StatusCancelled},
+}
+
+// maxStatusReasonLength bounds the reason of a transition.
+const maxStatusReasonLength = 500
+
+// ErrInvalidTransition is returned when the state machine doesn't allow a change of status.
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// ParseStatus validates a status.
+func ParseStatus(s string) (Status, error) {
+	for _, status := range Statuses {
+		if Status(s) == status {
+			return status, nil
+		}
+	}
+	return "", fmt.Errorf("invalid status %q, expected draft, published, cancelled or postponed", s)
+}
+
+// CanTransition reports whether an event can go from the status s to the status to.
+func (s Status) CanTransition(to Status) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// transitionError is the error of a change of status the state machine doesn't allow.
+func transitionError(from, to Status) error {
+	return fmt.Errorf("%w: a %s event can't be %s", ErrInvalidTransition, from, to)
+}
+
+// validateStatus adds the problems of the status of e to verr.
+func validateStatus(e Event, verr *ValidationError) {
+	if e.Status != "" {
+		if _, err := ParseStatus(string(e.Status)); err != nil {
+			verr.Add("status", "must be draft, published, cancelled or postponed")
+		}
+	}
+	if utf8.RuneCountInString(e.StatusReason) > maxStatusReasonLength {
+		verr.Add("status_reason", "must be at most %d characters long", maxStatusReasonLength)
+	}
+}
+
+// ValidateNew checks an event before it's created, like Validate. Events are
+// created as drafts or published, then change with Repository.Transition.
+func (e Event) ValidateNew() error {
+	err := e.Validate()
+	if e.Status == "" || e.Status == StatusDraft || e.Status == StatusPublished {
+		return err
+	}
+	verr := &ValidationError{Subject: "event"}
+	errors.As(err, &verr)
+	verr.Add("status", "must be draft or published for a new event, it's cancelled or postponed afterwards")
+	return verr.Err()
+}
+
+// ValidateReason checks the reason of a transition.
+func ValidateReason(to Status, reason string) error {
+	verr := ValidationError{Subject: "transition"}
+	if strings.TrimSpace(reason) == "" && (to == StatusCancelled || to == StatusPostponed) {
+		verr.Add("reason", "is required to tell why the event is %s", to)
+	} else if utf8.RuneCountInString(reason) > maxStatusReasonLength {
+		verr.Add("reason", "must be at most %d characters long", maxStatusReasonLength)
+	}
+	return verr.Err()
+}
+
+// statusStrings converts statuses to strings, for the SQL arguments.
+func statusStrings(statuses []Status) []string {
+	s := make([]string, len(statuses))
+	for i, status := range statuses {
+		s[i] = string(status)
+	}
+	return s
+}
+
+func (r *SQLRepository) Transition(ctx context.Context, id int64, to Status, reason string, version int64, log zerolog.Logger) (*Event, error) {
+	var event Event
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockLiveEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		if version != 0 && version != current.Version {
+			return ErrVersionMismatch
+		}
+		if !current.Status.CanTransition(to) {
+			return transitionError(current.Status, to)
+		}
+		_, err := tx.Exec(ctx, `UPDATE events SET status = $2, status_reason = $3, updated_at = now(), version = version + 1 WHERE id = $1`,
+			id, string(to), strings.TrimSpace(reason))
+		if err != nil {
+			return err
+		}
+		if err := getEvent(ctx, tx, id, &event); err != nil {
+			return err
+		}
+		return record(ctx, tx, OperationStatus, &current, &event)
+	})
+	if err != nil {
+		log.Err(err).Msg("Transition failed")
+		return nil, translateError(err)
+	}
+	return &event, nil
+}
+
+func (r *MemoryRepository) Transition(ctx context.Context, id int64, to Status, reason string, version int64, log zerolog.Logger) (*Event, error) {
+	r.mu.Lock()
+	current, err := r.current(id)
+	if err != nil {
+		r.mu.Unlock()
+		return nil, err
+	}
+	if version != 0 && version != current.Version {
+		r.mu.Unlock()
+		return nil, ErrVersionMismatch
+	}
+	if !current.Status.CanTransition(to) {
+		r.mu.Unlock()
+		return nil, transitionError(current.Status, to)
+	}
+	changed := current
+	changed.Status, changed.StatusReason = to, strings.TrimSpace(reason)
+	changed = r.touch(ctx, OperationStatus, current, changed)
+	r.mu.Unlock()
+	changed = r.withVenue(ctx, changed, log)
+	return &changed, nil
+}
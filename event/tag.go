@@ -0,0 +1,173 @@
+package event
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	maxTags      = 10
+	maxTagLength = 30
+)
+
+// tagName matches the canonical form of a tag: lowercase words joined by dashes.
+var tagName = regexp.MustCompile(`^[\p{Ll}\p{Nd}]+(-[\p{Ll}\p{Nd}]+)*$`)
+
+// TagCount is a tag with the number of upcoming events having it.
+type TagCount struct {
+	Name           string `json:"name"`
+	UpcomingEvents int64  `json:"upcoming_events"`
+}
+
+// NormalizeTag returns the canonical form of a tag name: "Free Entry" becomes "free-entry".
+func NormalizeTag(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), "-")
+}
+
+// normalizeTags returns the canonical, sorted and unique form of tags, never nil.
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// ValidTag reports whether the normalized form of name is a valid tag.
+func ValidTag(name string) bool {
+	tag := NormalizeTag(name)
+	return utf8.RuneCountInString(tag) <= maxTagLength && tagName.MatchString(tag)
+}
+
+// validateTags adds the problems of tags to verr.
+func validateTags(tags []string, verr *ValidationError) {
+	tags = normalizeTags(tags)
+	if len(tags) > maxTags {
+		verr.Add("tags", "must have at most %d tags", maxTags)
+	}
+	for _, tag := range tags {
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			verr.Add("tags", "%q must be at most %d characters long", tag, maxTagLength)
+		} else if !tagName.MatchString(tag) {
+			verr.Add("tags", "%q must only have letters, digits and dashes", tag)
+		}
+	}
+}
+
+// tagsColumn is the tags of an event aliased as e, sorted.
+const tagsColumn = `ARRAY(SELECT t.name FROM event_tags et JOIN tags t ON t.id = et.tag_id WHERE et.event_id = e.id ORDER BY t.name)`
+
+// setTags replaces the tags of the event id, creating the missing ones.
+func setTags(ctx context.Context, db querier, id int64, tags []string) error {
+	tags = normalizeTags(tags)
+	_, err := db.Exec(ctx, `DELETE FROM event_tags WHERE event_id = $1`, id)
+	if err != nil || len(tags) == 0 {
+		return err
+	}
+	_, err = db.Exec(ctx, `INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (name) DO NOTHING`, tags)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `INSERT INTO event_tags (event_id, tag_id) SELECT $1, id FROM tags WHERE name = ANY($2)`, id, tags)
+	return err
+}
+
+// TagCounts returns the tags of the events ordered by decreasing count, then by
+// name. Tags only deleted events have, or none, are left out. Only the
+// published events count, the recurring ones while an occurrence ends after since.
+func (r *SQLRepository) TagCounts(ctx context.Context, since time.Time, log zerolog.Logger) ([]TagCount, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT t.name, count(*) FILTER (WHERE e.status = 'published' AND e.end_time > $1) AS upcoming
+		FROM tags t
+		JOIN event_tags et ON et.tag_id = t.id
+		JOIN events e ON e.id = et.event_id AND e.deleted_at IS NULL
+		GROUP BY t.name`, since)
+	if err != nil {
+		log.Err(err).Msg("TagCounts failed")
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+	upcoming := map[string]int64{}
+	for rows.Next() {
+		var count TagCount
+		if err := rows.Scan(&count.Name, &count.UpcomingEvents); err != nil {
+			log.Err(err).Msg("TagCounts failed")
+			return nil, translateError(err)
+		}
+		upcoming[count.Name] = count.UpcomingEvents
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("TagCounts failed")
+		return nil, translateError(err)
+	}
+
+	// the series whose first occurrence ended are checked for a later one
+	rows, err = r.db.Query(ctx, `SELECT `+columns+` FROM events`+joinVenues+`
+		WHERE e.deleted_at IS NULL AND e.status = 'published' AND e.recurrence IS NOT NULL AND e.end_time <= $1`, since)
+	if err != nil {
+		log.Err(err).Msg("TagCounts failed")
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var series Event
+		if err := scanEvent(rows, &series); err != nil {
+			log.Err(err).Msg("TagCounts failed")
+			return nil, translateError(err)
+		}
+		if series.endsAfter(since) {
+			for _, tag := range series.Tags {
+				upcoming[tag]++
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("TagCounts failed")
+		return nil, translateError(err)
+	}
+	return sortedTagCounts(upcoming), nil
+}
+
+// TagCounts returns the tags ordered by decreasing count, then by name.
+func (r *MemoryRepository) TagCounts(ctx context.Context, since time.Time, log zerolog.Logger) ([]TagCount, error) {
+	r.mu.RLock()
+	upcoming := map[string]int64{}
+	for _, event := range r.events {
+		for _, tag := range event.Tags {
+			upcoming[tag] += 0
+			if event.Status == StatusPublished && event.endsAfter(since) {
+				upcoming[tag]++
+			}
+		}
+	}
+	r.mu.RUnlock()
+	return sortedTagCounts(upcoming), nil
+}
+
+// sortedTagCounts returns the counts of the tags in upcoming ordered by
+// decreasing count, then by name.
+func sortedTagCounts(upcoming map[string]int64) []TagCount {
+	counts := []TagCount{}
+	for name, count := range upcoming {
+		counts = append(counts, TagCount{Name: name, UpcomingEvents: count})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].UpcomingEvents != counts[j].UpcomingEvents {
+			return counts[i].UpcomingEvents > counts[j].UpcomingEvents
+		}
+		return counts[i].Name < counts[j].Name
+	})
+	return counts
+}
@@ -0,0 +1,149 @@
+package event
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog"
+)
+
+func (r *SQLRepository) Trash(ctx context.Context, log zerolog.Logger) ([]Event, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.deleted_at IS NOT NULL ORDER BY e.deleted_at DESC, e.id DESC`)
+	if err != nil {
+		log.Err(err).Msg("Trash failed")
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+	events := []Event{}
+	for rows.Next() {
+		var event Event
+		if err := scanEvent(rows, &event); err != nil {
+			log.Err(err).Msg("Trash failed")
+			return nil, translateError(err)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("Trash failed")
+		return nil, translateError(err)
+	}
+	return events, nil
+}
+
+func (r *SQLRepository) Restore(ctx context.Context, id int64, log zerolog.Logger) (*Event, error) {
+	var event Event
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		var current Event
+		if err := lockEvent(ctx, tx, id, &current); err != nil {
+			return err
+		}
+		if current.DeletedAt == nil {
+			return ErrNotFound
+		}
+		_, err := tx.Exec(ctx, `UPDATE events SET deleted_at = NULL, updated_at = now(), version = version + 1 WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		if err := getEvent(ctx, tx, id, &event); err != nil {
+			return err
+		}
+		return record(ctx, tx, OperationRestore, &current, &event)
+	})
+	if err != nil {
+		log.Err(err).Msg("Restore failed")
+		return nil, translateError(err)
+	}
+	return &event, nil
+}
+
+// Purge removes the events along with their tags and overrides, which cascade.
+// The purge of each is recorded in the history, in the same transaction.
+func (r *SQLRepository) Purge(ctx context.Context, before time.Time, log zerolog.Logger) (int64, error) {
+	var purged int64
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `SELECT `+columns+` FROM events`+joinVenues+` WHERE e.deleted_at < $1 ORDER BY e.id FOR UPDATE OF e`, before)
+		if err != nil {
+			return err
+		}
+		var events []Event
+		for rows.Next() {
+			var event Event
+			if err := scanEvent(rows, &event); err != nil {
+				rows.Close()
+				return err
+			}
+			events = append(events, event)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		ids := make([]int64, len(events))
+		for i := range events {
+			if err := record(ctx, tx, OperationPurge, &events[i], nil); err != nil {
+				return err
+			}
+			ids[i] = events[i].ID
+		}
+		res, err := tx.Exec(ctx, `DELETE FROM events WHERE id = ANY($1)`, ids)
+		purged = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		log.Err(err).Msg("Purge failed")
+		return 0, translateError(err)
+	}
+	return purged, nil
+}
+
+func (r *MemoryRepository) Trash(ctx context.Context, log zerolog.Logger) ([]Event, error) {
+	r.mu.RLock()
+	events := make([]Event, 0, len(r.trash))
+	for _, event := range r.trash {
+		events = append(events, event)
+	}
+	r.mu.RUnlock()
+	sort.Slice(events, func(i, j int) bool {
+		if !events[i].DeletedAt.Equal(*events[j].DeletedAt) {
+			return events[i].DeletedAt.After(*events[j].DeletedAt)
+		}
+		return events[i].ID > events[j].ID
+	})
+	for i := range events {
+		events[i] = r.withVenue(ctx, events[i], log)
+	}
+	return events, nil
+}
+
+func (r *MemoryRepository) Restore(ctx context.Context, id int64, log zerolog.Logger) (*Event, error) {
+	r.mu.Lock()
+	event, ok := r.trash[id]
+	if !ok {
+		r.mu.Unlock()
+		return nil, ErrNotFound
+	}
+	delete(r.trash, id)
+	restored := event
+	restored.DeletedAt = nil
+	event = r.touch(ctx, OperationRestore, event, restored)
+	r.mu.Unlock()
+	event = r.withVenue(ctx, event, log)
+	return &event, nil
+}
+
+func (r *MemoryRepository) Purge(ctx context.Context, before time.Time, log zerolog.Logger) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var purged int64
+	for id, event := range r.trash {
+		if event.DeletedAt.Before(before) {
+			delete(r.trash, id)
+			event := event
+			r.record(ctx, OperationPurge, &event, nil)
+			purged++
+		}
+	}
+	return purged, nil
+}
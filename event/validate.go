@@ -0,0 +1,63 @@
+package event
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/perebaj/ondehj/validation"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 5000
+	maxLocationLength    = 300
+)
+
+// minTime rejects the zero-ish timestamps sent by broken clients, like the Unix epoch.
+var minTime = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// FieldError describes why a field of a payload is invalid.
+type FieldError = validation.FieldError
+
+// ValidationError lists every invalid field of a payload.
+type ValidationError = validation.Error
+
+// Validate checks an event before it's created or updated.
+// It returns a *ValidationError listing every invalid field, or nil.
+func (e Event) Validate() error {
+	verr := ValidationError{Subject: "event"}
+	if strings.TrimSpace(e.Title) == "" {
+		verr.Add("title", "is required")
+	} else if utf8.RuneCountInString(e.Title) > maxTitleLength {
+		verr.Add("title", "must be at most %d characters long", maxTitleLength)
+	}
+	if utf8.RuneCountInString(e.Description) > maxDescriptionLength {
+		verr.Add("description", "must be at most %d characters long", maxDescriptionLength)
+	}
+	if utf8.RuneCountInString(e.Location) > maxLocationLength {
+		verr.Add("location", "must be at most %d characters long", maxLocationLength)
+	}
+	validateTags(e.Tags, &verr)
+	if e.VenueID != nil && *e.VenueID < 1 {
+		verr.Add("venue_id", "must be a venue id")
+	}
+	if e.StartTime.IsZero() {
+		verr.Add("start_time", "is required")
+	} else if e.StartTime.Before(minTime) {
+		verr.Add("start_time", "must be after %s", minTime.Format("2006-01-02"))
+	}
+	if e.EndTime.IsZero() {
+		verr.Add("end_time", "is required")
+	} else if e.EndTime.Before(minTime) {
+		verr.Add("end_time", "must be after %s", minTime.Format("2006-01-02"))
+	} else if e.EndTime.Before(e.StartTime) {
+		verr.Add("end_time", "must not be before start_time")
+	}
+	validateRecurrence(e, &verr)
+	validateStatus(e, &verr)
+	if e.InstagramPage != "" && !validation.InstagramHandle.MatchString(e.InstagramPage) {
+		verr.Add("instagram_page", "must be an Instagram handle such as onde.hoje, without @ or URL")
+	}
+	return verr.Err()
+}
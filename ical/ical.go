@@ -0,0 +1,204 @@
+// Package ical reads and writes iCalendar (RFC 5545) calendars of events.
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ProductID identifies Onde Hoje as the producer of the calendars.
+const ProductID = "-//Onde Hoje//Onde Hoje//PT"
+
+// dateTimeFormat is the UTC form of the DATE-TIME values. Every instant is
+// written in UTC but the times of the recurring events, see Event.Rule, whose
+// TZIDs are defined by a VTIMEZONE.
+const dateTimeFormat = "20060102T150405Z"
+
+// localDateTimeFormat is the form of the DATE-TIME values with a TZID.
+const localDateTimeFormat = "20060102T150405"
+
+// Calendar is a VCALENDAR.
+type Calendar struct {
+	// Name is shown by the calendar applications subscribing to it.
+	Name string
+	// Timezone is the IANA name of the timezone the events are shown in by
+	// default, a hint for the applications as the times are in UTC.
+	Timezone string
+	Events   []Event
+	// Invalid lists the VEVENTs Parse skipped, as their values are malformed.
+	Invalid []error
+}
+
+// Event is a VEVENT.
+type Event struct {
+	// UID must stay the same across the versions of the event.
+	UID string
+	// Stamp is the DTSTAMP, the last time the event was modified.
+	Stamp        time.Time
+	Created      time.Time
+	LastModified time.Time
+	// Sequence is the revision of the event, incremented on every change.
+	Sequence    int64
+	Start       time.Time
+	End         time.Time
+	Summary     string
+	Description string
+	Location    string
+	// Geo is the position of the location, when known.
+	Geo        *Geo
+	URL        string
+	Categories []string
+	// Status is TENTATIVE, CONFIRMED or CANCELLED, when set.
+	Status string
+	// Rule is the RRULE of a recurring event, see ParseRule. The rule repeats
+	// the wall clock time of Start, so the times of a recurring event are
+	// written in the location of Start, named by an IANA TZID, unless it's UTC.
+	Rule string
+	// ExceptionDates are the EXDATE, the starts of the occurrences of Rule
+	// that don't take place.
+	ExceptionDates []time.Time
+	// RecurrenceID is the start of the occurrence this VEVENT overrides, the
+	// other one with the same UID holding the Rule.
+	RecurrenceID time.Time
+}
+
+// Geo is the latitude and the longitude of a location.
+type Geo struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Write writes cal in the iCalendar format.
+func Write(w io.Writer, cal Calendar) error {
+	cw := &contentWriter{w: bufio.NewWriter(w)}
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", ProductID)
+	cw.line("CALSCALE", "GREGORIAN")
+	cw.line("METHOD", "PUBLISH")
+	if cal.Name != "" {
+		cw.line("X-WR-CALNAME", escape(cal.Name))
+	}
+	if cal.Timezone != "" {
+		cw.line("X-WR-TIMEZONE", escape(cal.Timezone))
+	}
+	for _, z := range timezones(cal.Events) {
+		cw.timezone(z)
+	}
+	for _, e := range cal.Events {
+		cw.event(e)
+	}
+	cw.line("END", "VCALENDAR")
+	if cw.err != nil {
+		return cw.err
+	}
+	return cw.w.Flush()
+}
+
+// contentWriter writes content lines, keeping the first error.
+type contentWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (cw *contentWriter) event(e Event) {
+	cw.line("BEGIN", "VEVENT")
+	cw.line("UID", escape(e.UID))
+	cw.time("DTSTAMP", e.Stamp)
+	cw.time("CREATED", e.Created)
+	cw.time("LAST-MODIFIED", e.LastModified)
+	cw.line("SEQUENCE", fmt.Sprint(e.Sequence))
+	cw.time("RECURRENCE-ID", e.RecurrenceID)
+	if e.Rule != "" {
+		loc := e.Start.Location()
+		cw.localTime("DTSTART", e.Start, loc)
+		cw.localTime("DTEND", e.End, loc)
+		cw.line("RRULE", e.Rule)
+		for _, t := range e.ExceptionDates {
+			cw.localTime("EXDATE", t, loc)
+		}
+	} else {
+		cw.time("DTSTART", e.Start)
+		cw.time("DTEND", e.End)
+		for _, t := range e.ExceptionDates {
+			cw.time("EXDATE", t)
+		}
+	}
+	if e.Status != "" {
+		cw.line("STATUS", e.Status)
+	}
+	cw.line("SUMMARY", escape(e.Summary))
+	if e.Description != "" {
+		cw.line("DESCRIPTION", escape(e.Description))
+	}
+	if e.Location != "" {
+		cw.line("LOCATION", escape(e.Location))
+	}
+	if e.Geo != nil {
+		cw.line("GEO", fmt.Sprintf("%f;%f", e.Geo.Latitude, e.Geo.Longitude))
+	}
+	if e.URL != "" {
+		cw.line("URL", e.URL)
+	}
+	if len(e.Categories) > 0 {
+		categories := make([]string, len(e.Categories))
+		for i, c := range e.Categories {
+			categories[i] = escape(c)
+		}
+		cw.line("CATEGORIES", strings.Join(categories, ","))
+	}
+	cw.line("END", "VEVENT")
+}
+
+func (cw *contentWriter) time(name string, t time.Time) {
+	if !t.IsZero() {
+		cw.line(name, t.UTC().Format(dateTimeFormat))
+	}
+}
+
+// localTime writes t in loc with a TZID, or in UTC when loc has no IANA name.
+func (cw *contentWriter) localTime(name string, t time.Time, loc *time.Location) {
+	id := tzid(loc)
+	if id == "" {
+		cw.time(name, t)
+		return
+	}
+	if !t.IsZero() {
+		cw.line(name+";TZID="+id, t.In(loc).Format(localDateTimeFormat))
+	}
+}
+
+// line writes a content line, folded so no line is longer than 75 octets.
+func (cw *contentWriter) line(name, value string) {
+	if cw.err != nil {
+		return
+	}
+	const maxLine = 75
+	line := name + ":" + value
+	limit := maxLine
+	for len(line) > limit {
+		// never split a UTF-8 sequence
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		if _, cw.err = cw.w.WriteString(line[:cut] + "\r\n "); cw.err != nil {
+			return
+		}
+		line = line[cut:]
+		// the leading space of the continuation lines counts
+		limit = maxLine - 1
+	}
+	_, cw.err = cw.w.WriteString(line + "\r\n")
+}
+
+var textEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`)
+
+// escape returns s as a TEXT value.
+func escape(s string) string {
+	return textEscaper.Replace(s)
+}
@@ -0,0 +1,176 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	start := time.Date(2023, time.May, 13, 23, 0, 0, 0, saoPaulo)
+	cal := Calendar{
+		Name:     "Onde Hoje",
+		Timezone: "America/Sao_Paulo",
+		Events: []Event{{
+			UID:          "event-1@ondehoje",
+			Stamp:        time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC),
+			Created:      time.Date(2023, time.May, 1, 10, 0, 0, 0, time.UTC),
+			LastModified: time.Date(2023, time.May, 1, 12, 0, 0, 0, time.UTC),
+			Sequence:     2,
+			Start:        start,
+			End:          start.Add(6 * time.Hour),
+			Summary:      "Techno; punk, jazz",
+			Description:  "Line one\nLine two \\o/",
+			Location:     "Trackers",
+			Geo:          &Geo{Latitude: -23.5446, Longitude: -46.6406},
+			URL:          "https://www.instagram.com/trackers/",
+			Categories:   []string{"techno", "free-entry"},
+		}},
+	}
+	var b strings.Builder
+	require.NoError(t, Write(&b, cal))
+	assert.Equal(t, strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//Onde Hoje//Onde Hoje//PT",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:Onde Hoje",
+		"X-WR-TIMEZONE:America/Sao_Paulo",
+		"BEGIN:VEVENT",
+		"UID:event-1@ondehoje",
+		"DTSTAMP:20230501T120000Z",
+		"CREATED:20230501T100000Z",
+		"LAST-MODIFIED:20230501T120000Z",
+		"SEQUENCE:2",
+		"DTSTART:20230514T020000Z",
+		"DTEND:20230514T080000Z",
+		`SUMMARY:Techno\; punk\, jazz`,
+		`DESCRIPTION:Line one\nLine two \\o/`,
+		"LOCATION:Trackers",
+		"GEO:-23.544600;-46.640600",
+		"URL:https://www.instagram.com/trackers/",
+		"CATEGORIES:techno,free-entry",
+		"END:VEVENT",
+		"END:VCALENDAR",
+		"",
+	}, "\r\n"), b.String())
+}
+
+func TestWriteFoldsLongLines(t *testing.T) {
+	summary := strings.Repeat("São Paulo ", 20)
+	var b strings.Builder
+	require.NoError(t, Write(&b, Calendar{Events: []Event{{UID: "1", Summary: summary}}}))
+
+	var unfolded string
+	for _, line := range strings.Split(strings.TrimSuffix(b.String(), "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+		assert.True(t, strings.ToValidUTF8(line, "") == line, "line %q splits a character", line)
+		if strings.HasPrefix(line, " ") {
+			unfolded += line[1:]
+		} else {
+			unfolded += "\n" + line
+		}
+	}
+	assert.Contains(t, unfolded, "\nSUMMARY:"+summary+"\n")
+}
+
+func TestWriteRecurring(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	start := time.Date(2023, time.May, 12, 23, 0, 0, 0, saoPaulo)
+	series := Event{
+		UID:            "event-1@ondehoje",
+		Start:          start,
+		End:            start.Add(5 * time.Hour),
+		Summary:        "Jam",
+		Rule:           "FREQ=WEEKLY;BYDAY=FR",
+		ExceptionDates: []time.Time{start.AddDate(0, 0, 7)},
+	}
+	moved := Event{
+		UID:          "event-1@ondehoje",
+		RecurrenceID: start.AddDate(0, 0, 14),
+		Start:        start.AddDate(0, 0, 15),
+		End:          start.AddDate(0, 0, 15).Add(5 * time.Hour),
+		Summary:      "Jam",
+	}
+	var b strings.Builder
+	require.NoError(t, Write(&b, Calendar{Events: []Event{series, moved}}))
+	written := b.String()
+	assert.Contains(t, written, "DTSTART;TZID=America/Sao_Paulo:20230512T230000\r\n", "the rule repeats the local time")
+	assert.Contains(t, written, "EXDATE;TZID=America/Sao_Paulo:20230519T230000\r\n")
+	assert.Contains(t, written, "RECURRENCE-ID:20230527T020000Z\r\nDTSTART:20230528T020000Z\r\n")
+
+	cal, err := Parse(strings.NewReader(written), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, cal.Events, 2)
+	assert.True(t, start.Equal(cal.Events[0].Start))
+	assert.Equal(t, "America/Sao_Paulo", cal.Events[0].Start.Location().String())
+	assert.Equal(t, series.Rule, cal.Events[0].Rule)
+	require.Len(t, cal.Events[0].ExceptionDates, 1)
+	assert.True(t, series.ExceptionDates[0].Equal(cal.Events[0].ExceptionDates[0]))
+	assert.True(t, moved.RecurrenceID.Equal(cal.Events[1].RecurrenceID))
+}
+
+func TestWriteTimezones(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	newYork, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+	jam := time.Date(2023, time.May, 12, 23, 0, 0, 0, saoPaulo)
+	show := time.Date(2023, time.March, 1, 20, 0, 0, 0, newYork)
+	var b strings.Builder
+	require.NoError(t, Write(&b, Calendar{Events: []Event{
+		{UID: "1", Start: jam, End: jam.Add(5 * time.Hour), Rule: "FREQ=WEEKLY"},
+		{UID: "2", Start: jam.AddDate(0, 1, 0), End: jam.AddDate(0, 1, 0).Add(time.Hour), Rule: "FREQ=DAILY"},
+		{UID: "3", Start: show, End: show.Add(2 * time.Hour), Rule: "FREQ=MONTHLY"},
+		{UID: "4", Start: show, End: show.Add(time.Hour)},
+	}}))
+	written := b.String()
+
+	assert.Equal(t, 2, strings.Count(written, "BEGIN:VTIMEZONE\r\n"), "one for each TZID")
+	assert.Less(t, strings.Index(written, "END:VTIMEZONE"), strings.Index(written, "BEGIN:VEVENT"))
+	assert.Contains(t, written, strings.Join([]string{
+		"BEGIN:VTIMEZONE",
+		"TZID:America/Sao_Paulo",
+		"BEGIN:STANDARD",
+		"DTSTART:20190217T000000",
+		"TZOFFSETFROM:-0200",
+		"TZOFFSETTO:-0300",
+		"TZNAME:-03",
+		"END:STANDARD",
+		"END:VTIMEZONE",
+	}, "\r\n"), "Brazil has no daylight saving time since 2019")
+	assert.Contains(t, written, strings.Join([]string{
+		"TZID:America/New_York",
+		"BEGIN:STANDARD",
+		"DTSTART:20221106T020000",
+		"TZOFFSETFROM:-0400",
+		"TZOFFSETTO:-0500",
+		"TZNAME:EST",
+		"END:STANDARD",
+		"BEGIN:DAYLIGHT",
+		"DTSTART:20230312T020000",
+		"TZOFFSETFROM:-0500",
+		"TZOFFSETTO:-0400",
+		"TZNAME:EDT",
+		"END:DAYLIGHT",
+	}, "\r\n"))
+	assert.Contains(t, written, "DTSTART:20321107T020000\r\n", "the transitions go on after the last start")
+
+	cal, err := Parse(strings.NewReader(written), time.UTC)
+	require.NoError(t, err)
+	assert.Len(t, cal.Events, 4)
+}
+
+func TestFormatOffset(t *testing.T) {
+	assert.Equal(t, "+0000", formatOffset(0))
+	assert.Equal(t, "-0300", formatOffset(-3*3600))
+	assert.Equal(t, "+0530", formatOffset(5*3600+30*60))
+	assert.Equal(t, "-004654", formatOffset(-(46*60 + 54)))
+}
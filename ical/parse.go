@@ -0,0 +1,354 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// property is a content line: NAME;PARAM=value:value.
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Parse reads an iCalendar stream. Times without timezone, the floating ones,
+// are in the X-WR-TIMEZONE of the calendar or else in loc. The VEVENTs with
+// malformed values are left out and listed in Calendar.Invalid; other
+// components, like VTODO or VALARM, are ignored.
+func Parse(r io.Reader, loc *time.Location) (*Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	cal := &Calendar{}
+	var (
+		// components is the stack of the open components
+		components []string
+		event      []property
+		started    bool
+	)
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		prop, err := parseProperty(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		switch prop.name {
+		case "BEGIN":
+			component := strings.ToUpper(prop.value)
+			if len(components) == 0 && component != "VCALENDAR" {
+				return nil, fmt.Errorf("line %d: expected BEGIN:VCALENDAR", i+1)
+			}
+			components = append(components, component)
+			started = true
+			if len(components) == 2 && component == "VEVENT" {
+				event = nil
+			}
+			continue
+		case "END":
+			component := strings.ToUpper(prop.value)
+			if len(components) == 0 || components[len(components)-1] != component {
+				return nil, fmt.Errorf("line %d: unexpected END:%s", i+1, prop.value)
+			}
+			components = components[:len(components)-1]
+			if len(components) == 1 && component == "VEVENT" {
+				e, err := parseEvent(event, cal.location(loc))
+				if err != nil {
+					cal.Invalid = append(cal.Invalid, err)
+				} else {
+					cal.Events = append(cal.Events, e)
+				}
+			}
+			continue
+		}
+		switch {
+		case len(components) == 1:
+			switch prop.name {
+			case "X-WR-CALNAME":
+				cal.Name = unescape(prop.value)
+			case "X-WR-TIMEZONE":
+				cal.Timezone = unescape(prop.value)
+			}
+		case len(components) == 2 && components[1] == "VEVENT":
+			event = append(event, prop)
+		}
+	}
+	if !started {
+		return nil, errors.New("not an iCalendar stream, no BEGIN:VCALENDAR")
+	}
+	if len(components) != 0 {
+		return nil, fmt.Errorf("missing END:%s", components[len(components)-1])
+	}
+	return cal, nil
+}
+
+// location is the timezone of the floating times of cal.
+func (cal *Calendar) location(fallback *time.Location) *time.Location {
+	if cal.Timezone != "" {
+		if loc, err := time.LoadLocation(cal.Timezone); err == nil {
+			return loc
+		}
+	}
+	return fallback
+}
+
+// unfold returns the content lines of r, joining the folded ones.
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+func parseProperty(line string) (property, error) {
+	prop := property{params: map[string]string{}}
+	// the name and the parameters end at the first colon out of quotes
+	quoted := false
+	end := -1
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			end = i
+			break
+		}
+	}
+	if end < 0 {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+	prop.value = line[end+1:]
+	parts := splitUnquoted(line[:end], ';')
+	prop.name = strings.ToUpper(parts[0])
+	if prop.name == "" {
+		return prop, fmt.Errorf("malformed content line %q", line)
+	}
+	for _, param := range parts[1:] {
+		name, value, ok := strings.Cut(param, "=")
+		if !ok {
+			return prop, fmt.Errorf("malformed parameter %q", param)
+		}
+		prop.params[strings.ToUpper(name)] = strings.Trim(value, `"`)
+	}
+	return prop, nil
+}
+
+func splitUnquoted(s string, sep rune) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, c := range s {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == sep && !quoted {
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+var textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+
+// unescape returns the value of a TEXT.
+func unescape(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// splitText splits a list of TEXT on the unescaped commas.
+func splitText(s string) []string {
+	var values []string
+	var b strings.Builder
+	escaped := false
+	for _, c := range s {
+		switch {
+		case escaped:
+			b.WriteRune('\\')
+			b.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			values = append(values, unescape(b.String()))
+			b.Reset()
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return append(values, unescape(b.String()))
+}
+
+func parseEvent(props []property, loc *time.Location) (Event, error) {
+	var e Event
+	var duration time.Duration
+	var allDay, hasDuration bool
+	for _, prop := range props {
+		var err error
+		switch prop.name {
+		case "UID":
+			e.UID = prop.value
+		case "SUMMARY":
+			e.Summary = unescape(prop.value)
+		case "DESCRIPTION":
+			e.Description = unescape(prop.value)
+		case "LOCATION":
+			e.Location = unescape(prop.value)
+		case "URL":
+			e.URL = prop.value
+		case "STATUS":
+			e.Status = strings.ToUpper(prop.value)
+		case "CATEGORIES":
+			for _, c := range splitText(prop.value) {
+				if c = strings.TrimSpace(c); c != "" {
+					e.Categories = append(e.Categories, c)
+				}
+			}
+		case "SEQUENCE":
+			e.Sequence, err = strconv.ParseInt(prop.value, 10, 64)
+		case "GEO":
+			lat, lng, ok := strings.Cut(prop.value, ";")
+			var geo Geo
+			if geo.Latitude, err = strconv.ParseFloat(lat, 64); ok && err == nil {
+				geo.Longitude, err = strconv.ParseFloat(lng, 64)
+			}
+			if ok && err == nil {
+				e.Geo = &geo
+			}
+		case "DTSTAMP":
+			e.Stamp, _, err = parseTime(prop, loc)
+		case "CREATED":
+			e.Created, _, err = parseTime(prop, loc)
+		case "LAST-MODIFIED":
+			e.LastModified, _, err = parseTime(prop, loc)
+		case "DTSTART":
+			e.Start, allDay, err = parseTime(prop, loc)
+		case "DTEND":
+			e.End, _, err = parseTime(prop, loc)
+		case "DURATION":
+			duration, err = parseDuration(prop.value)
+			hasDuration = true
+		case "RECURRENCE-ID":
+			e.RecurrenceID, _, err = parseTime(prop, loc)
+		case "RRULE":
+			e.Rule = prop.value
+		case "EXDATE":
+			for _, value := range strings.Split(prop.value, ",") {
+				var t time.Time
+				t, _, err = parseTime(property{params: prop.params, value: value}, loc)
+				if err != nil {
+					break
+				}
+				e.ExceptionDates = append(e.ExceptionDates, t)
+			}
+		}
+		if err != nil {
+			return e, fmt.Errorf("VEVENT %q: invalid %s: %w", e.UID, prop.name, err)
+		}
+	}
+	if e.Start.IsZero() {
+		return e, fmt.Errorf("VEVENT %q: missing DTSTART", e.UID)
+	}
+	if e.End.IsZero() {
+		switch {
+		case hasDuration:
+			e.End = e.Start.Add(duration)
+		case allDay:
+			e.End = e.Start.AddDate(0, 0, 1)
+		default:
+			e.End = e.Start
+		}
+	}
+	return e, nil
+}
+
+// parseTime parses a DATE-TIME or a DATE property, the latter is the start
+// of that day. TZID names an IANA timezone.
+func parseTime(prop property, loc *time.Location) (time.Time, bool, error) {
+	if tzid := prop.params["TZID"]; tzid != "" {
+		var err error
+		loc, err = time.LoadLocation(strings.TrimPrefix(tzid, "/"))
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown timezone %q", tzid)
+		}
+	}
+	if prop.params["VALUE"] == "DATE" && len(prop.value) != len("20060102") {
+		return time.Time{}, false, fmt.Errorf("%q isn't a date", prop.value)
+	}
+	return parseDateTime(prop.value, loc)
+}
+
+// parseDateTime parses a date, a UTC date-time or a date-time in loc.
+func parseDateTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if len(value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeFormat, value)
+		return t, false, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, loc)
+	return t, false, err
+}
+
+// parseDuration parses a DURATION value, such as PT4H30M or P1D.
+func parseDuration(value string) (time.Duration, error) {
+	s := value
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, fmt.Errorf("%q isn't a duration", value)
+	}
+	s = s[1:]
+	var d time.Duration
+	inTime := false
+	number := ""
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			number += string(c)
+			continue
+		case c == 'T' && number == "" && !inTime:
+			inTime = true
+			continue
+		}
+		n, err := strconv.Atoi(number)
+		if err != nil {
+			return 0, fmt.Errorf("%q isn't a duration", value)
+		}
+		unit := map[rune]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+		if inTime {
+			unit = map[rune]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+		}
+		u, ok := unit[c]
+		if !ok {
+			return 0, fmt.Errorf("%q isn't a duration", value)
+		}
+		d += time.Duration(n) * u
+		number = ""
+	}
+	if number != "" {
+		return 0, fmt.Errorf("%q isn't a duration", value)
+	}
+	return sign * d, nil
+}
@@ -0,0 +1,156 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	stream := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"X-WR-CALNAME:Coletivo\\, SP",
+		"X-WR-TIMEZONE:America/Sao_Paulo",
+		"BEGIN:VTIMEZONE",
+		"TZID:America/Sao_Paulo",
+		"END:VTIMEZONE",
+		"BEGIN:VEVENT",
+		"UID:utc@coletivo",
+		"DTSTART:20230514T020000Z",
+		"DTEND:20230514T080000Z",
+		`SUMMARY:Techno\; punk\, `,
+		" jazz",
+		"DESCRIPTION:Line one\\nLine two",
+		"CATEGORIES:techno,free entry",
+		"CATEGORIES:queer",
+		"URL:https://www.instagram.com/coletivo/",
+		"BEGIN:VALARM",
+		"SUMMARY:ignored",
+		"END:VALARM",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:tzid@coletivo",
+		`DTSTART;TZID="Europe/Berlin":20230601T230000`,
+		"DURATION:PT6H30M",
+		"RRULE:FREQ=WEEKLY;BYDAY=TH",
+		"EXDATE;TZID=Europe/Berlin:20230608T230000,20230615T230000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:floating@coletivo",
+		"DTSTART:20230610T220000",
+		"RECURRENCE-ID;VALUE=DATE:20230610",
+		"STATUS:cancelled",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:allday@coletivo",
+		"DTSTART;VALUE=DATE:20230617",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:broken@coletivo",
+		"DTSTART;TZID=Mars/Olympus:20230601T230000",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+	cal, err := Parse(strings.NewReader(stream), time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "Coletivo, SP", cal.Name)
+	assert.Equal(t, "America/Sao_Paulo", cal.Timezone)
+	require.Len(t, cal.Invalid, 1)
+	assert.Contains(t, cal.Invalid[0].Error(), "broken@coletivo")
+	require.Len(t, cal.Events, 4)
+
+	utc := cal.Events[0]
+	assert.Equal(t, "Techno; punk, jazz", utc.Summary)
+	assert.Equal(t, "Line one\nLine two", utc.Description)
+	assert.Equal(t, []string{"techno", "free entry", "queer"}, utc.Categories)
+	assert.Equal(t, "https://www.instagram.com/coletivo/", utc.URL)
+	assert.True(t, utc.Start.Equal(time.Date(2023, time.May, 13, 23, 0, 0, 0, saoPaulo)))
+	assert.True(t, utc.End.Equal(time.Date(2023, time.May, 14, 5, 0, 0, 0, saoPaulo)))
+
+	tzid := cal.Events[1]
+	assert.Equal(t, time.Date(2023, time.June, 1, 23, 0, 0, 0, berlin), tzid.Start)
+	assert.Equal(t, time.Date(2023, time.June, 2, 5, 30, 0, 0, berlin), tzid.End)
+	assert.Equal(t, "FREQ=WEEKLY;BYDAY=TH", tzid.Rule)
+	assert.Equal(t, []time.Time{
+		time.Date(2023, time.June, 8, 23, 0, 0, 0, berlin),
+		time.Date(2023, time.June, 15, 23, 0, 0, 0, berlin),
+	}, tzid.ExceptionDates)
+
+	floating := cal.Events[2]
+	assert.Equal(t, time.Date(2023, time.June, 10, 22, 0, 0, 0, saoPaulo), floating.Start, "floating times are in X-WR-TIMEZONE")
+	assert.Equal(t, floating.Start, floating.End)
+	assert.Equal(t, time.Date(2023, time.June, 10, 0, 0, 0, 0, saoPaulo), floating.RecurrenceID)
+	assert.Equal(t, "CANCELLED", floating.Status)
+
+	allDay := cal.Events[3]
+	assert.Equal(t, time.Date(2023, time.June, 17, 0, 0, 0, 0, saoPaulo), allDay.Start)
+	assert.Equal(t, time.Date(2023, time.June, 18, 0, 0, 0, 0, saoPaulo), allDay.End)
+}
+
+func TestParseErrors(t *testing.T) {
+	testCases := []struct {
+		name   string
+		stream string
+	}{
+		{"Empty", ""},
+		{"Not a calendar", "<html></html>"},
+		{"Unclosed", "BEGIN:VCALENDAR\nBEGIN:VEVENT\nEND:VCALENDAR"},
+		{"Unopened", "BEGIN:VCALENDAR\nEND:VEVENT\nEND:VCALENDAR"},
+		{"Another component", "BEGIN:VCARD\nEND:VCARD"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.stream), time.UTC)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseWritten(t *testing.T) {
+	start := time.Date(2023, time.May, 14, 2, 0, 0, 0, time.UTC)
+	written := Event{
+		UID:         "event-1@ondehoje",
+		Stamp:       start.Add(-time.Hour),
+		Start:       start,
+		End:         start.Add(6 * time.Hour),
+		Summary:     strings.Repeat("Festa em São Paulo; ", 10),
+		Description: "Techno, \\o/\nall night",
+		Categories:  []string{"techno", "free-entry"},
+	}
+	var b strings.Builder
+	require.NoError(t, Write(&b, Calendar{Events: []Event{written}}))
+	cal, err := Parse(strings.NewReader(b.String()), time.UTC)
+	require.NoError(t, err)
+	require.Len(t, cal.Events, 1)
+	assert.Equal(t, written, cal.Events[0])
+}
+
+func TestParseDuration(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"PT4H30M", 4*time.Hour + 30*time.Minute},
+		{"P1D", 24 * time.Hour},
+		{"P1W", 7 * 24 * time.Hour},
+		{"P1DT2H", 26 * time.Hour},
+		{"-PT15M", -15 * time.Minute},
+	}
+	for _, tc := range testCases {
+		d, err := parseDuration(tc.value)
+		assert.NoError(t, err, tc.value)
+		assert.Equal(t, tc.expected, d, tc.value)
+	}
+	for _, value := range []string{"", "P", "4H", "PT4", "P1H", "PT1D"} {
+		_, err := parseDuration(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,380 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnsupportedRule is returned by ParseRule for the valid recurrence rules
+// it can't expand, like the hourly ones or those with BYSETPOS.
+var ErrUnsupportedRule = errors.New("unsupported recurrence rule")
+
+// Frequency is the FREQ of a recurrence rule.
+type Frequency string
+
+const (
+	Daily   Frequency = "DAILY"
+	Weekly  Frequency = "WEEKLY"
+	Monthly Frequency = "MONTHLY"
+	Yearly  Frequency = "YEARLY"
+)
+
+// WeekdayNum is a BYDAY value: every Day of the period when N is zero, else
+// its Nth one, counted from the end of the period when N is negative.
+type WeekdayNum struct {
+	N   int
+	Day time.Weekday
+}
+
+// Rule is a recurrence rule (RRULE), the subset of RFC 5545 events use:
+// daily, weekly, monthly and yearly frequencies, restricted by month, day of
+// the month or day of the week.
+type Rule struct {
+	Freq     Frequency
+	Interval int
+	// Count and Until bound the occurrences, both are zero for endless rules.
+	Count int
+	Until time.Time
+	// WeekStart is the first day of the weeks of weekly rules, Monday by default.
+	WeekStart  time.Weekday
+	ByMonth    []time.Month
+	ByMonthDay []int
+	ByDay      []WeekdayNum
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func weekdayName(d time.Weekday) string {
+	return strings.ToUpper(d.String()[:2])
+}
+
+// ParseRule parses the value of a RRULE. A plain date UNTIL is the end of that
+// day in loc.
+func ParseRule(s string, loc *time.Location) (Rule, error) {
+	r := Rule{Interval: 1, WeekStart: time.Monday}
+	for _, part := range strings.Split(strings.TrimSpace(s), ";") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return r, fmt.Errorf("invalid recurrence rule part %q", part)
+		}
+		var err error
+		switch strings.ToUpper(name) {
+		case "FREQ":
+			r.Freq = Frequency(strings.ToUpper(value))
+			switch r.Freq {
+			case Daily, Weekly, Monthly, Yearly:
+			case "SECONDLY", "MINUTELY", "HOURLY":
+				return r, fmt.Errorf("%w: FREQ=%s", ErrUnsupportedRule, r.Freq)
+			default:
+				return r, fmt.Errorf("invalid FREQ %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+			if err == nil && r.Interval < 1 {
+				err = errors.New("must be positive")
+			}
+		case "COUNT":
+			r.Count, err = strconv.Atoi(value)
+			if err == nil && r.Count < 1 {
+				err = errors.New("must be positive")
+			}
+		case "UNTIL":
+			var allDay bool
+			r.Until, allDay, err = parseDateTime(value, loc)
+			if allDay {
+				r.Until = r.Until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		case "WKST":
+			var ok bool
+			if r.WeekStart, ok = weekdays[strings.ToUpper(value)]; !ok {
+				err = errors.New("not a weekday")
+			}
+		case "BYMONTH":
+			for _, v := range strings.Split(value, ",") {
+				var m int
+				m, err = strconv.Atoi(v)
+				if err == nil && (m < 1 || m > 12) {
+					err = fmt.Errorf("%d isn't a month", m)
+				}
+				if err != nil {
+					break
+				}
+				r.ByMonth = append(r.ByMonth, time.Month(m))
+			}
+		case "BYMONTHDAY":
+			for _, v := range strings.Split(value, ",") {
+				var d int
+				d, err = strconv.Atoi(v)
+				if err == nil && (d == 0 || d < -31 || d > 31) {
+					err = fmt.Errorf("%d isn't a day of the month", d)
+				}
+				if err != nil {
+					break
+				}
+				r.ByMonthDay = append(r.ByMonthDay, d)
+			}
+		case "BYDAY":
+			for _, v := range strings.Split(strings.ToUpper(value), ",") {
+				var wd WeekdayNum
+				wd, err = parseWeekdayNum(v)
+				if err != nil {
+					break
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYSETPOS", "BYYEARDAY", "BYWEEKNO", "BYHOUR", "BYMINUTE", "BYSECOND":
+			return r, fmt.Errorf("%w: %s", ErrUnsupportedRule, name)
+		default:
+			return r, fmt.Errorf("invalid recurrence rule part %q", name)
+		}
+		if err != nil {
+			return r, fmt.Errorf("invalid %s %q: %v", name, value, err)
+		}
+	}
+	if r.Freq == "" {
+		return r, errors.New("recurrence rule without FREQ")
+	}
+	if r.Count != 0 && !r.Until.IsZero() {
+		return r, errors.New("recurrence rule with both COUNT and UNTIL")
+	}
+	for _, wd := range r.ByDay {
+		if wd.N != 0 && (r.Freq == Daily || r.Freq == Weekly) {
+			return r, fmt.Errorf("invalid BYDAY %d%s with FREQ=%s", wd.N, weekdayName(wd.Day), r.Freq)
+		}
+		if wd.N != 0 && r.Freq == Yearly && len(r.ByMonth) == 0 {
+			return r, fmt.Errorf("%w: BYDAY %d%s of the year", ErrUnsupportedRule, wd.N, weekdayName(wd.Day))
+		}
+	}
+	return r, nil
+}
+
+func parseWeekdayNum(s string) (WeekdayNum, error) {
+	var wd WeekdayNum
+	if len(s) < 2 {
+		return wd, fmt.Errorf("%q isn't a weekday", s)
+	}
+	day, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return wd, fmt.Errorf("%q isn't a weekday", s)
+	}
+	wd.Day = day
+	if n := s[:len(s)-2]; n != "" {
+		var err error
+		wd.N, err = strconv.Atoi(n)
+		if err != nil || wd.N == 0 || wd.N < -5 || wd.N > 5 {
+			return wd, fmt.Errorf("%q isn't a weekday of a month", s)
+		}
+	}
+	return wd, nil
+}
+
+// String returns the rule as a RRULE value.
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(dateTimeFormat))
+	}
+	if r.WeekStart != time.Monday {
+		parts = append(parts, "WKST="+weekdayName(r.WeekStart))
+	}
+	if len(r.ByMonth) > 0 {
+		months := make([]string, len(r.ByMonth))
+		for i, m := range r.ByMonth {
+			months[i] = strconv.Itoa(int(m))
+		}
+		parts = append(parts, "BYMONTH="+strings.Join(months, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, wd := range r.ByDay {
+			days[i] = weekdayName(wd.Day)
+			if wd.N != 0 {
+				days[i] = strconv.Itoa(wd.N) + days[i]
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	return strings.Join(parts, ";")
+}
+
+// maxPeriods bounds the periods Between goes through, so rules that never
+// match, like the 31st of February, end.
+const maxPeriods = 100000
+
+// Between returns the starts of the occurrences of the series starting at
+// start that are in [from, to), in order. The wall clock time of start is
+// kept in its location across daylight saving time changes.
+func (r Rule) Between(start, from, to time.Time) []time.Time {
+	var occurrences []time.Time
+	count := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, t := range r.candidates(start, period) {
+			if t.Before(start) {
+				continue
+			}
+			if !r.Until.IsZero() && t.After(r.Until) || !t.Before(to) {
+				return occurrences
+			}
+			count++
+			if r.Count > 0 && count > r.Count {
+				return occurrences
+			}
+			if !t.Before(from) {
+				occurrences = append(occurrences, t)
+			}
+		}
+	}
+	return occurrences
+}
+
+// candidates returns the sorted occurrences of the nth period after the one of start.
+func (r Rule) candidates(start time.Time, n int) []time.Time {
+	loc := start.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), loc)
+	}
+	var days []time.Time
+	switch r.Freq {
+	case Daily:
+		days = []time.Time{at(start.Year(), start.Month(), start.Day()+n*r.Interval)}
+	case Weekly:
+		offset := (int(start.Weekday()) - int(r.WeekStart) + 7) % 7
+		weekStart := at(start.Year(), start.Month(), start.Day()-offset+7*n*r.Interval)
+		if len(r.ByDay) == 0 {
+			days = []time.Time{weekStart.AddDate(0, 0, offset)}
+		}
+		for _, wd := range r.ByDay {
+			days = append(days, weekStart.AddDate(0, 0, (int(wd.Day)-int(r.WeekStart)+7)%7))
+		}
+	case Monthly:
+		first := at(start.Year(), start.Month()+time.Month(n*r.Interval), 1)
+		days = r.monthDays(first, start.Day())
+	case Yearly:
+		year := start.Year() + n*r.Interval
+		if len(r.ByMonth) == 0 && len(r.ByMonthDay) == 0 && len(r.ByDay) == 0 {
+			days = r.monthDays(at(year, start.Month(), 1), start.Day())
+			break
+		}
+		months := r.ByMonth
+		if len(months) == 0 {
+			// BYMONTHDAY or BYDAY alone expand to every month of the year
+			months = []time.Month{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}
+		}
+		for _, m := range months {
+			days = append(days, r.monthDays(at(year, m, 1), start.Day())...)
+		}
+	}
+	var filtered []time.Time
+	for _, d := range days {
+		if r.keeps(d) {
+			filtered = append(filtered, d)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Before(filtered[j]) })
+	return dedupe(filtered)
+}
+
+// monthDays returns the days of the month starting at first matching
+// BYMONTHDAY and BYDAY, or day when there are none.
+func (r Rule) monthDays(first time.Time, day int) []time.Time {
+	last := first.AddDate(0, 1, -1).Day()
+	var days []time.Time
+	switch {
+	case len(r.ByMonthDay) > 0:
+		for _, d := range r.ByMonthDay {
+			if d < 0 {
+				d = last + d + 1
+			}
+			if d >= 1 && d <= last {
+				days = append(days, first.AddDate(0, 0, d-1))
+			}
+		}
+	case len(r.ByDay) > 0:
+		for _, wd := range r.ByDay {
+			firstDay := 1 + (int(wd.Day)-int(first.Weekday())+7)%7
+			var matching []int
+			for d := firstDay; d <= last; d += 7 {
+				matching = append(matching, d)
+			}
+			switch {
+			case wd.N == 0:
+				for _, d := range matching {
+					days = append(days, first.AddDate(0, 0, d-1))
+				}
+			case wd.N > 0 && wd.N <= len(matching):
+				days = append(days, first.AddDate(0, 0, matching[wd.N-1]-1))
+			case wd.N < 0 && -wd.N <= len(matching):
+				days = append(days, first.AddDate(0, 0, matching[len(matching)+wd.N]-1))
+			}
+		}
+	case day <= last:
+		days = append(days, first.AddDate(0, 0, day-1))
+	}
+	return days
+}
+
+// keeps applies the BYMONTH, the BYMONTHDAY limiting daily and weekly rules,
+// and the BYDAY limiting BYMONTHDAY or a daily rule.
+func (r Rule) keeps(t time.Time) bool {
+	if len(r.ByMonth) > 0 && !containsMonth(r.ByMonth, t.Month()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 && (r.Freq == Daily || r.Freq == Weekly) {
+		last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+		found := false
+		for _, d := range r.ByMonthDay {
+			found = found || d == t.Day() || d < 0 && last+d+1 == t.Day()
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.ByDay) > 0 && (r.Freq == Daily || len(r.ByMonthDay) > 0) {
+		for _, wd := range r.ByDay {
+			if wd.Day == t.Weekday() {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func containsMonth(months []time.Month, m time.Month) bool {
+	for _, month := range months {
+		if month == m {
+			return true
+		}
+	}
+	return false
+}
+
+func dedupe(sorted []time.Time) []time.Time {
+	var unique []time.Time
+	for i, t := range sorted {
+		if i == 0 || !t.Equal(sorted[i-1]) {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,148 @@
+package ical
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleBetween(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// a Friday
+	start := time.Date(2023, time.March, 3, 23, 0, 0, 0, saoPaulo)
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2023, month, day, 23, 0, 0, 0, saoPaulo)
+	}
+	testCases := []struct {
+		name     string
+		rule     string
+		start    time.Time
+		from, to time.Time
+		expected []time.Time
+	}{
+		{
+			name:     "Daily with count",
+			rule:     "FREQ=DAILY;COUNT=3",
+			expected: []time.Time{day(3, 3), day(3, 4), day(3, 5)},
+		},
+		{
+			name:     "Every other day until",
+			rule:     "FREQ=DAILY;INTERVAL=2;UNTIL=20230309",
+			expected: []time.Time{day(3, 3), day(3, 5), day(3, 7), day(3, 9)},
+		},
+		{
+			name:     "Daily on weekends",
+			rule:     "FREQ=DAILY;BYDAY=SA,SU;COUNT=4",
+			expected: []time.Time{day(3, 4), day(3, 5), day(3, 11), day(3, 12)},
+		},
+		{
+			name:     "Weekly",
+			rule:     "FREQ=WEEKLY;COUNT=3",
+			expected: []time.Time{day(3, 3), day(3, 10), day(3, 17)},
+		},
+		{
+			name:     "Weekly on several days",
+			rule:     "FREQ=WEEKLY;BYDAY=TH,FR;COUNT=4",
+			expected: []time.Time{day(3, 3), day(3, 9), day(3, 10), day(3, 16)},
+		},
+		{
+			name:     "Every other week starting on Sunday",
+			rule:     "FREQ=WEEKLY;INTERVAL=2;BYDAY=SU,FR;WKST=SU;COUNT=4",
+			expected: []time.Time{day(3, 3), day(3, 12), day(3, 17), day(3, 26)},
+		},
+		{
+			name:     "Monthly on the first Friday",
+			rule:     "FREQ=MONTHLY;BYDAY=1FR;COUNT=3",
+			expected: []time.Time{day(3, 3), day(4, 7), day(5, 5)},
+		},
+		{
+			name:     "Monthly on the last Saturday",
+			rule:     "FREQ=MONTHLY;BYDAY=-1SA;COUNT=2",
+			expected: []time.Time{day(3, 25), day(4, 29)},
+		},
+		{
+			name:     "Monthly on the 31st skips the shorter months",
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3",
+			expected: []time.Time{day(3, 31), day(5, 31), day(7, 31)},
+		},
+		{
+			name:     "Monthly on the last day",
+			rule:     "FREQ=MONTHLY;BYMONTHDAY=-1;COUNT=2",
+			expected: []time.Time{day(3, 31), day(4, 30)},
+		},
+		{
+			name:     "Friday the 13th",
+			rule:     "FREQ=MONTHLY;BYDAY=FR;BYMONTHDAY=13;COUNT=2",
+			expected: []time.Time{day(10, 13), time.Date(2024, time.September, 13, 23, 0, 0, 0, saoPaulo)},
+		},
+		{
+			name:     "Yearly",
+			rule:     "FREQ=YEARLY;COUNT=2",
+			expected: []time.Time{day(3, 3), time.Date(2024, time.March, 3, 23, 0, 0, 0, saoPaulo)},
+		},
+		{
+			name:     "Yearly on the second Saturday of some months",
+			rule:     "FREQ=YEARLY;BYMONTH=4,6;BYDAY=2SA;COUNT=3",
+			expected: []time.Time{day(4, 8), day(6, 10), time.Date(2024, time.April, 13, 23, 0, 0, 0, saoPaulo)},
+		},
+		{
+			name:     "Window",
+			rule:     "FREQ=WEEKLY;COUNT=10",
+			from:     day(3, 10),
+			to:       day(3, 24),
+			expected: []time.Time{day(3, 10), day(3, 17)},
+		},
+		{
+			name:     "Count includes the occurrences before the window",
+			rule:     "FREQ=WEEKLY;COUNT=2",
+			from:     day(3, 10),
+			expected: []time.Time{day(3, 10)},
+		},
+		{
+			name:     "Wall clock kept across daylight saving time",
+			rule:     "FREQ=WEEKLY;COUNT=2",
+			start:    time.Date(2023, time.March, 24, 23, 0, 0, 0, berlin),
+			expected: []time.Time{time.Date(2023, time.March, 24, 23, 0, 0, 0, berlin), time.Date(2023, time.March, 31, 23, 0, 0, 0, berlin)},
+		},
+		{
+			name:     "Never matching",
+			rule:     "FREQ=YEARLY;BYMONTH=2;BYMONTHDAY=30",
+			expected: nil,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, err := ParseRule(tc.rule, saoPaulo)
+			require.NoError(t, err)
+			s := tc.start
+			if s.IsZero() {
+				s = start
+			}
+			to := tc.to
+			if to.IsZero() {
+				to = s.AddDate(5, 0, 0)
+			}
+			assert.Equal(t, tc.expected, rule.Between(s, tc.from, to))
+		})
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	rule, err := ParseRule("freq=monthly;interval=2;byday=1FR,-1SA;wkst=SU;until=20231231T235959Z", time.UTC)
+	require.NoError(t, err)
+	assert.Equal(t, "FREQ=MONTHLY;INTERVAL=2;UNTIL=20231231T235959Z;WKST=SU;BYDAY=1FR,-1SA", rule.String())
+
+	for _, s := range []string{"", "INTERVAL=2", "FREQ=SOMETIMES", "FREQ=DAILY;COUNT=0", "FREQ=DAILY;COUNT=2;UNTIL=20231231", "FREQ=WEEKLY;BYDAY=1FR", "FREQ=MONTHLY;BYMONTHDAY=32", "FREQ=DAILY;FOO=1"} {
+		_, err := ParseRule(s, time.UTC)
+		assert.Error(t, err, s)
+	}
+	for _, s := range []string{"FREQ=HOURLY", "FREQ=MONTHLY;BYDAY=FR;BYSETPOS=-1", "FREQ=YEARLY;BYDAY=1MO"} {
+		_, err := ParseRule(s, time.UTC)
+		assert.ErrorIs(t, err, ErrUnsupportedRule, s)
+	}
+}
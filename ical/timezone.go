@@ -0,0 +1,113 @@
+package ical
+
+import (
+	"fmt"
+	"time"
+)
+
+// timezoneYears is how many years after the last start of a recurring event
+// its VTIMEZONE lists the transitions of the offset. The occurrences further
+// away keep the offset of the last transition.
+const timezoneYears = 10
+
+// tzid returns the IANA name of loc, or "" when the times in loc are written
+// in UTC.
+func tzid(loc *time.Location) string {
+	if loc == time.UTC || loc.String() == "UTC" || loc.String() == "Local" || loc.String() == "" {
+		return ""
+	}
+	return loc.String()
+}
+
+// zoneRange is the span of the times written in a location.
+type zoneRange struct {
+	loc      *time.Location
+	from, to time.Time
+}
+
+// timezones returns the locations of the times written with a TZID, those of
+// the recurring events, in the order they first appear.
+func timezones(events []Event) []zoneRange {
+	var zones []zoneRange
+	index := map[string]int{}
+	for _, e := range events {
+		if e.Rule == "" || e.Start.IsZero() {
+			continue
+		}
+		name := tzid(e.Start.Location())
+		if name == "" {
+			continue
+		}
+		i, ok := index[name]
+		if !ok {
+			index[name] = len(zones)
+			zones = append(zones, zoneRange{loc: e.Start.Location(), from: e.Start, to: e.Start})
+			continue
+		}
+		if e.Start.Before(zones[i].from) {
+			zones[i].from = e.Start
+		}
+		if e.Start.After(zones[i].to) {
+			zones[i].to = e.Start
+		}
+	}
+	return zones
+}
+
+// timezone writes the VTIMEZONE of z: an observance for the offset in effect
+// at its first time, then one for every transition up to timezoneYears after
+// its last time.
+func (cw *contentWriter) timezone(z zoneRange) {
+	cw.line("BEGIN", "VTIMEZONE")
+	cw.line("TZID", tzid(z.loc))
+	until := z.to.AddDate(timezoneYears, 0, 0)
+	t := z.from.In(z.loc)
+	for {
+		start, end := t.ZoneBounds()
+		cw.observance(t, start)
+		if end.IsZero() || !end.Before(until) {
+			break
+		}
+		t = end
+	}
+	cw.line("END", "VTIMEZONE")
+}
+
+// observance writes the STANDARD or DAYLIGHT component of the offset in
+// effect at t, which starts at start, or at the start of the zone when zero.
+func (cw *contentWriter) observance(t, start time.Time) {
+	name, offset := t.Zone()
+	component := "STANDARD"
+	if t.IsDST() {
+		component = "DAYLIGHT"
+	}
+	cw.line("BEGIN", component)
+	if start.IsZero() {
+		cw.line("DTSTART", "19700101T000000")
+		cw.line("TZOFFSETFROM", formatOffset(offset))
+	} else {
+		// the onset is the local time before the transition
+		before := start.Add(-time.Second)
+		_, from := before.Zone()
+		cw.line("DTSTART", start.In(time.FixedZone("", from)).Format(localDateTimeFormat))
+		cw.line("TZOFFSETFROM", formatOffset(from))
+	}
+	cw.line("TZOFFSETTO", formatOffset(offset))
+	if name != "" {
+		cw.line("TZNAME", escape(name))
+	}
+	cw.line("END", component)
+}
+
+// formatOffset returns offset, in seconds east of UTC, as a UTC-OFFSET value.
+func formatOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	s := fmt.Sprintf("%c%02d%02d", sign, offset/3600, offset/60%60)
+	if offset%60 != 0 {
+		s += fmt.Sprintf("%02d", offset%60)
+	}
+	return s
+}
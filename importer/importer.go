@@ -0,0 +1,202 @@
+// Package importer loads the events of iCalendar files, like the ones the
+// collectives publish, into an event.Repository.
+package importer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/ical"
+	"github.com/perebaj/ondehj/validation"
+	"github.com/rs/zerolog"
+)
+
+// DefaultHorizon is how far ahead recurring events are expanded by default.
+const DefaultHorizon = 180 * 24 * time.Hour
+
+// Report counts what an import did with the events of a calendar. Skipped
+// ones are up to date, cancelled or invalid.
+type Report struct {
+	Created int
+	Updated int
+	Skipped int
+}
+
+func (r Report) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d skipped", r.Created, r.Updated, r.Skipped)
+}
+
+// Add returns the sum of two reports.
+func (r Report) Add(other Report) Report {
+	return Report{Created: r.Created + other.Created, Updated: r.Updated + other.Updated, Skipped: r.Skipped + other.Skipped}
+}
+
+// Importer imports calendars. Importing the same calendar again updates the
+// events it imported before instead of duplicating them.
+type Importer struct {
+	Events event.Repository
+	// Location is the timezone of the floating times of calendars without X-WR-TIMEZONE.
+	Location *time.Location
+	// Horizon bounds the expansion of the recurring events: only their
+	// occurrences ending after now and starting before now+Horizon are imported.
+	Horizon time.Duration
+	// Now is the clock, time.Now when nil.
+	Now func() time.Time
+}
+
+// Import imports the events of the iCalendar stream r. It stops at the first
+// error of the repository, the report then counts what was done until then.
+func (im Importer) Import(ctx context.Context, r io.Reader, log zerolog.Logger) (Report, error) {
+	var report Report
+	loc := im.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	cal, err := ical.Parse(r, loc)
+	if err != nil {
+		return report, err
+	}
+	for _, err := range cal.Invalid {
+		log.Warn().Err(err).Msg("Skipping invalid VEVENT")
+		report.Skipped++
+	}
+	for _, e := range im.expand(cal, log, &report) {
+		if err := e.Validate(); err != nil {
+			log.Warn().Err(err).Str("uid", e.SourceUID).Msg("Skipping invalid event")
+			report.Skipped++
+			continue
+		}
+		_, result, err := im.Events.Import(ctx, e, log)
+		if err != nil {
+			return report, fmt.Errorf("importing %q: %w", e.SourceUID, err)
+		}
+		switch result {
+		case event.ImportCreated:
+			report.Created++
+		case event.ImportUpdated:
+			report.Updated++
+		default:
+			report.Skipped++
+		}
+	}
+	return report, nil
+}
+
+// expand returns the events of cal, one per occurrence of the recurring ones,
+// counting the cancelled ones as skipped.
+func (im Importer) expand(cal *ical.Calendar, log zerolog.Logger, report *Report) []event.Event {
+	now := time.Now()
+	if im.Now != nil {
+		now = im.Now()
+	}
+	horizon := im.Horizon
+	if horizon == 0 {
+		horizon = DefaultHorizon
+	}
+
+	// overrides holds the VEVENTs replacing an occurrence, by UID and original start
+	overrides := map[string]map[int64]ical.Event{}
+	for _, ce := range cal.Events {
+		if !ce.RecurrenceID.IsZero() {
+			if overrides[ce.UID] == nil {
+				overrides[ce.UID] = map[int64]ical.Event{}
+			}
+			overrides[ce.UID][ce.RecurrenceID.Unix()] = ce
+		}
+	}
+	var events []event.Event
+	add := func(ce ical.Event, uid string) {
+		if ce.Status == "CANCELLED" {
+			report.Skipped++
+			return
+		}
+		events = append(events, toEvent(ce, uid))
+	}
+	for _, ce := range cal.Events {
+		switch {
+		case !ce.RecurrenceID.IsZero():
+			// imported with the occurrence it overrides
+		case ce.UID == "":
+			log.Warn().Str("summary", ce.Summary).Msg("Skipping VEVENT without UID")
+			report.Skipped++
+		case ce.Rule == "":
+			add(ce, ce.UID)
+		default:
+			rule, err := ical.ParseRule(ce.Rule, ce.Start.Location())
+			if err != nil {
+				log.Warn().Err(err).Str("uid", ce.UID).Msg("Skipping recurring VEVENT")
+				report.Skipped++
+				continue
+			}
+			duration := ce.End.Sub(ce.Start)
+			for _, start := range rule.Between(ce.Start, now.Add(-duration), now.Add(horizon)) {
+				if excluded(ce.ExceptionDates, start) {
+					continue
+				}
+				occurrence := ce
+				occurrence.Start, occurrence.End = start, start.Add(duration)
+				if override, ok := overrides[ce.UID][start.Unix()]; ok {
+					occurrence = override
+				}
+				add(occurrence, occurrenceUID(ce.UID, start))
+			}
+		}
+	}
+	return events
+}
+
+func excluded(dates []time.Time, start time.Time) bool {
+	for _, d := range dates {
+		if d.Equal(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// occurrenceUID is the source uid of an occurrence of a recurring event, it's
+// the same for every import as long as the occurrence isn't moved.
+func occurrenceUID(uid string, start time.Time) string {
+	return uid + "/" + start.UTC().Format("20060102T150405Z")
+}
+
+// toEvent maps a VEVENT to an event. The tags that can't be one are left out.
+func toEvent(ce ical.Event, uid string) event.Event {
+	e := event.Event{
+		SourceUID:     uid,
+		Title:         strings.TrimSpace(ce.Summary),
+		Description:   strings.TrimSpace(ce.Description),
+		Location:      strings.TrimSpace(ce.Location),
+		StartTime:     ce.Start,
+		EndTime:       ce.End,
+		InstagramPage: instagramHandle(ce.URL),
+		Tags:          []string{},
+	}
+	for _, category := range ce.Categories {
+		if event.ValidTag(category) {
+			e.Tags = append(e.Tags, category)
+		}
+	}
+	return e
+}
+
+// instagramPaths are the paths of Instagram URLs that aren't profiles.
+var instagramPaths = map[string]bool{"p": true, "reel": true, "reels": true, "stories": true, "explore": true, "tv": true}
+
+// instagramHandle returns the handle of an Instagram profile URL, or "".
+func instagramHandle(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Host != "instagram.com" && u.Host != "www.instagram.com") {
+		return ""
+	}
+	handle, _, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if instagramPaths[handle] || !validation.InstagramHandle.MatchString(handle) {
+		return ""
+	}
+	return handle
+}
@@ -0,0 +1,90 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/event"
+	"github.com/perebaj/ondehj/venue"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImport(t *testing.T) {
+	saoPaulo, err := time.LoadLocation("America/Sao_Paulo")
+	require.NoError(t, err)
+	ctx := context.Background()
+	repo := event.EventMemoryRepository(venue.VenueMemoryRepository())
+	im := Importer{
+		Events:   repo,
+		Location: time.UTC,
+		Horizon:  30 * 24 * time.Hour,
+		Now:      func() time.Time { return time.Date(2023, time.May, 10, 12, 0, 0, 0, saoPaulo) },
+	}
+	importFile := func() Report {
+		f, err := os.Open("testdata/coletivo.ics")
+		require.NoError(t, err)
+		defer f.Close()
+		report, err := im.Import(ctx, f, zerolog.Nop())
+		require.NoError(t, err)
+		return report
+	}
+
+	// the jam takes place on the 10th, 24th (moved to 22:00) and 7th of June;
+	// the 17th is excluded, the 31st cancelled and the 3rd is over
+	report := importFile()
+	assert.Equal(t, Report{Created: 4, Skipped: 4}, report, "cancelled, untitled and Martian events are skipped")
+
+	events, err := repo.All(ctx, zerolog.Nop())
+	require.NoError(t, err)
+	require.Len(t, events, 4)
+	jojo := events[0]
+	assert.Equal(t, "jojo@coletivo", jojo.SourceUID)
+	assert.Equal(t, "Jojo", jojo.Title)
+	assert.Equal(t, "Trackers", jojo.Location)
+	assert.Equal(t, "jojo", jojo.InstagramPage)
+	assert.Equal(t, []string{"free-entry", "techno"}, jojo.Tags)
+	assert.True(t, jojo.StartTime.Equal(time.Date(2023, time.May, 13, 23, 0, 0, 0, saoPaulo)))
+	var jams []string
+	for _, e := range events[1:] {
+		jams = append(jams, e.SourceUID+" "+e.StartTime.In(saoPaulo).Format("2006-01-02 15:04")+" "+e.Title)
+	}
+	assert.Equal(t, []string{
+		"jam@coletivo/20230511T000000Z 2023-05-10 21:00 Jam de jazz",
+		"jam@coletivo/20230525T000000Z 2023-05-24 22:00 Jam de jazz (mais tarde)",
+		"jam@coletivo/20230608T000000Z 2023-06-07 21:00 Jam de jazz",
+	}, jams)
+
+	report = importFile()
+	assert.Equal(t, Report{Skipped: 8}, report, "importing again changes nothing")
+
+	title := "Jojo (edited)"
+	_, err = repo.Patch(ctx, jojo.ID, event.Patch{Title: &title}, zerolog.Nop())
+	require.NoError(t, err)
+	report = importFile()
+	assert.Equal(t, Report{Updated: 1, Skipped: 7}, report, "the calendar wins over local edits")
+}
+
+func TestImportInvalidCalendar(t *testing.T) {
+	im := Importer{Events: event.EventMemoryRepository(venue.VenueMemoryRepository())}
+	_, err := im.Import(context.Background(), strings.NewReader("<html></html>"), zerolog.Nop())
+	assert.Error(t, err)
+}
+
+func TestInstagramHandle(t *testing.T) {
+	testCases := map[string]string{
+		"https://www.instagram.com/jojo/":        "jojo",
+		"https://instagram.com/onde.hoje?hl=pt":  "onde.hoje",
+		"https://www.instagram.com/p/Cabc123/":   "",
+		"https://www.facebook.com/jojo":          "",
+		"https://www.instagram.com/":             "",
+		"not a url at all, just text with %zz ;": "",
+	}
+	for rawURL, expected := range testCases {
+		assert.Equal(t, expected, instagramHandle(rawURL), rawURL)
+	}
+}
@@ -0,0 +1,74 @@
+package migration
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	testCases := []struct {
+		name             string
+		files            fstest.MapFS
+		expectedVersions []int64
+		expectedErr      bool
+	}{
+		{
+			name: "Sorted by version",
+			files: fstest.MapFS{
+				"sql/0010_add_index.up.sql":       {Data: []byte("CREATE INDEX ...")},
+				"sql/0010_add_index.down.sql":     {Data: []byte("DROP INDEX ...")},
+				"sql/0002_create_events.up.sql":   {Data: []byte("CREATE TABLE ...")},
+				"sql/0002_create_events.down.sql": {Data: []byte("DROP TABLE ...")},
+			},
+			expectedVersions: []int64{2, 10},
+		},
+		{
+			name: "Missing down file",
+			files: fstest.MapFS{
+				"sql/0001_create_events.up.sql": {Data: []byte("CREATE TABLE ...")},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Invalid file name",
+			files: fstest.MapFS{
+				"sql/create_events.sql": {Data: []byte("CREATE TABLE ...")},
+			},
+			expectedErr: true,
+		},
+		{
+			name: "Same version with two names",
+			files: fstest.MapFS{
+				"sql/0001_create_events.up.sql":   {Data: []byte("CREATE TABLE ...")},
+				"sql/0001_create_venues.down.sql": {Data: []byte("DROP TABLE ...")},
+			},
+			expectedErr: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			migrations, err := Load(tc.files, "sql")
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			var versions []int64
+			for _, m := range migrations {
+				versions = append(versions, m.Version)
+				assert.NotEmpty(t, m.Checksum)
+			}
+			assert.Equal(t, tc.expectedVersions, versions)
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := Load(embedded, "sql")
+	assert.NoError(t, err)
+	for i, m := range migrations {
+		assert.Equal(t, int64(i+1), m.Version, "migration versions must be contiguous")
+	}
+}
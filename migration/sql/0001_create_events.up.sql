@@ -0,0 +1,12 @@
+-- Databases created before the migrations subsystem already have this table.
+CREATE TABLE IF NOT EXISTS events (
+	id SERIAL PRIMARY KEY,
+	title TEXT NOT NULL,
+	description TEXT,
+	location TEXT,
+	start_time TIMESTAMP WITH TIME ZONE NOT NULL,
+	end_time TIMESTAMP WITH TIME ZONE NOT NULL,
+	instagram_page TEXT
+);
+
+CREATE INDEX IF NOT EXISTS events_start_time_id_idx ON events (start_time, id);
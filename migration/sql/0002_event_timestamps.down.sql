@@ -0,0 +1,5 @@
+DROP INDEX events_updated_at_idx;
+
+ALTER TABLE events
+	DROP COLUMN created_at,
+	DROP COLUMN updated_at;
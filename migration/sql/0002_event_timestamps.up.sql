@@ -0,0 +1,5 @@
+ALTER TABLE events
+	ADD COLUMN created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	ADD COLUMN updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now();
+
+CREATE INDEX events_updated_at_idx ON events (updated_at);
@@ -0,0 +1,4 @@
+-- The events keep their location text, only the venues added since are lost.
+ALTER TABLE events DROP COLUMN venue_id;
+
+DROP TABLE venues;
@@ -0,0 +1,33 @@
+CREATE TABLE venues (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	address TEXT NOT NULL DEFAULT '',
+	neighbourhood TEXT NOT NULL DEFAULT '',
+	city TEXT NOT NULL DEFAULT '',
+	capacity INTEGER NOT NULL DEFAULT 0 CHECK (capacity >= 0),
+	latitude DOUBLE PRECISION CHECK (latitude BETWEEN -90 AND 90),
+	longitude DOUBLE PRECISION CHECK (longitude BETWEEN -180 AND 180),
+	instagram_page TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	CHECK ((latitude IS NULL) = (longitude IS NULL))
+);
+
+CREATE UNIQUE INDEX venues_name_city_idx ON venues (lower(name), lower(city));
+
+ALTER TABLE events ADD COLUMN venue_id BIGINT
+	CONSTRAINT events_venue_id_fkey REFERENCES venues (id);
+
+CREATE INDEX events_venue_id_idx ON events (venue_id);
+
+-- One venue per distinct location, ignoring the case and the surrounding spaces.
+-- Curators merge the remaining duplicates, like "Trackers" and "trackers sp", by hand.
+INSERT INTO venues (name)
+SELECT DISTINCT ON (lower(trim(location))) trim(location)
+FROM events
+WHERE trim(coalesce(location, '')) <> ''
+ORDER BY lower(trim(location)), trim(location);
+
+UPDATE events SET venue_id = venues.id
+FROM venues
+WHERE lower(trim(events.location)) = lower(venues.name) AND venues.city = '';
@@ -0,0 +1,4 @@
+DROP INDEX venues_earth_idx;
+
+DROP EXTENSION IF EXISTS earthdistance;
+DROP EXTENSION IF EXISTS cube;
@@ -0,0 +1,5 @@
+-- earthdistance computes great-circle distances on top of cube, both ship with Postgres.
+CREATE EXTENSION IF NOT EXISTS cube;
+CREATE EXTENSION IF NOT EXISTS earthdistance;
+
+CREATE INDEX venues_earth_idx ON venues USING gist (ll_to_earth(latitude, longitude));
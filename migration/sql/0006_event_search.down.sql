@@ -0,0 +1,5 @@
+ALTER TABLE events DROP COLUMN search;
+
+DROP TEXT SEARCH CONFIGURATION pt_unaccent;
+
+DROP EXTENSION IF EXISTS unaccent;
@@ -0,0 +1,17 @@
+CREATE EXTENSION IF NOT EXISTS unaccent;
+
+-- Portuguese stemming that ignores accents, so "sao paulo" matches "São Paulo".
+CREATE TEXT SEARCH CONFIGURATION pt_unaccent (COPY = portuguese);
+ALTER TEXT SEARCH CONFIGURATION pt_unaccent
+	ALTER MAPPING FOR hword, hword_part, word WITH unaccent, portuguese_stem;
+
+-- Generated, so every insert and update keeps it current. The title weighs the
+-- most in the ranking, the description the least.
+ALTER TABLE events ADD COLUMN search tsvector GENERATED ALWAYS AS (
+	setweight(to_tsvector('pt_unaccent', coalesce(title, '')), 'A') ||
+	setweight(to_tsvector('pt_unaccent', coalesce(location, '')), 'B') ||
+	setweight(to_tsvector('pt_unaccent', coalesce(instagram_page, '')), 'B') ||
+	setweight(to_tsvector('pt_unaccent', coalesce(description, '')), 'C')
+) STORED;
+
+CREATE INDEX events_search_idx ON events USING gin (search);
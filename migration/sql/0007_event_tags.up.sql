@@ -0,0 +1,16 @@
+-- Tags are the scenes of the events, like techno or free-entry. Names are
+-- normalized by the application: lowercase words joined by dashes.
+CREATE TABLE tags (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE TABLE event_tags (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	tag_id BIGINT NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+	PRIMARY KEY (event_id, tag_id)
+);
+
+-- The primary key serves the tags of an event, this one the events of a tag.
+CREATE INDEX event_tags_tag_id_event_id_idx ON event_tags (tag_id, event_id);
@@ -0,0 +1 @@
+ALTER TABLE events DROP COLUMN source_uid;
@@ -0,0 +1,5 @@
+-- The UID of the imported events in the calendar they come from, so importing
+-- a calendar again updates them.
+ALTER TABLE events ADD COLUMN source_uid TEXT;
+
+CREATE UNIQUE INDEX events_source_uid_idx ON events (source_uid);
@@ -0,0 +1,4 @@
+DROP TABLE event_overrides;
+
+ALTER TABLE events DROP COLUMN exception_dates;
+ALTER TABLE events DROP COLUMN recurrence;
@@ -0,0 +1,17 @@
+-- Recurring events are stored once, as a series with a RRULE (RFC 5545) and
+-- the starts of the occurrences that don't take place. The listings expand
+-- the occurrences.
+ALTER TABLE events ADD COLUMN recurrence TEXT;
+ALTER TABLE events ADD COLUMN exception_dates TIMESTAMP WITH TIME ZONE[] NOT NULL DEFAULT '{}';
+
+-- An override cancels or moves an occurrence of a series, identified by its
+-- original start, without changing the series.
+CREATE TABLE event_overrides (
+	event_id INTEGER NOT NULL REFERENCES events (id) ON DELETE CASCADE,
+	occurrence TIMESTAMP WITH TIME ZONE NOT NULL,
+	cancelled BOOLEAN NOT NULL DEFAULT FALSE,
+	start_time TIMESTAMP WITH TIME ZONE,
+	end_time TIMESTAMP WITH TIME ZONE,
+	PRIMARY KEY (event_id, occurrence),
+	CHECK (cancelled OR (start_time IS NOT NULL AND end_time >= start_time))
+);
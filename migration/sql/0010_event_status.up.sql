@@ -0,0 +1,6 @@
+-- The lifecycle of the events: draft, then published, then maybe cancelled or
+-- postponed. Cancelled events are kept, so the links already shared still work.
+ALTER TABLE events ADD COLUMN status TEXT NOT NULL DEFAULT 'published'
+	CHECK (status IN ('draft', 'published', 'cancelled', 'postponed'));
+-- Why the event got its status, like why it's cancelled.
+ALTER TABLE events ADD COLUMN status_reason TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+-- The trash goes away with the column, rather than its events coming back.
+DELETE FROM events WHERE deleted_at IS NOT NULL;
+
+ALTER TABLE events DROP COLUMN deleted_at;
@@ -0,0 +1,5 @@
+-- Deleted events go to the trash first, they can be restored until they're
+-- purged after the retention period.
+ALTER TABLE events ADD COLUMN deleted_at TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX events_deleted_at_idx ON events (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE event_history;
+DROP FUNCTION event_history_append_only();
@@ -0,0 +1,26 @@
+-- Every change of the events, written in the same transaction as the change.
+-- There's no foreign key so the history outlives the events purged from the
+-- trash, and the rows are never modified.
+CREATE TABLE event_history (
+	id BIGSERIAL PRIMARY KEY,
+	event_id BIGINT NOT NULL,
+	-- the version of the event after the change
+	version BIGINT NOT NULL,
+	operation TEXT NOT NULL,
+	actor TEXT NOT NULL,
+	changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	-- the old and new values of the changed fields, by name
+	diff JSONB NOT NULL,
+	-- the fields after the change, to revert to this version
+	snapshot JSONB NOT NULL,
+	UNIQUE (event_id, version)
+);
+
+CREATE FUNCTION event_history_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'the event history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER event_history_append_only BEFORE UPDATE OR DELETE ON event_history
+	FOR EACH ROW EXECUTE FUNCTION event_history_append_only();
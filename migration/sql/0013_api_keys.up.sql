@@ -0,0 +1,13 @@
+-- The API keys of the ingestion bots. Only their SHA-256 is stored, the keys
+-- are random enough to not need a slow hash.
+CREATE TABLE api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	hint TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	revoked_at TIMESTAMP WITH TIME ZONE
+);
+
+-- A name can be reused once its key is revoked, to rotate the key of a bot.
+CREATE UNIQUE INDEX api_keys_name_idx ON api_keys (name) WHERE revoked_at IS NULL;
@@ -0,0 +1,4 @@
+-- The keys created before the roles belong to the ingestion bots, which
+-- only create events.
+ALTER TABLE api_keys ADD COLUMN role TEXT NOT NULL DEFAULT 'promoter'
+	CHECK (role IN ('promoter', 'curator', 'admin'));
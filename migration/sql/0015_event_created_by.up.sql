@@ -0,0 +1,7 @@
+-- Who created each event, the actor of its creation in the history, owns it.
+-- The events created anonymously have no owner.
+ALTER TABLE events ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+
+UPDATE events e SET created_by = h.actor
+FROM event_history h
+WHERE h.event_id = e.id AND h.operation = 'create' AND h.actor <> 'anonymous';
@@ -0,0 +1,26 @@
+-- The accounts of the people who log in with a password, their email is
+-- stored in lower case.
+CREATE TABLE users (
+	id BIGSERIAL PRIMARY KEY,
+	email TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL,
+	password_hash TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'promoter' CHECK (role IN ('promoter', 'curator', 'admin')),
+	email_verified_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+-- The tokens of the links sent by email to verify an email or reset a
+-- password. Only their SHA-256 is stored, like the API keys.
+CREATE TABLE user_tokens (
+	id BIGSERIAL PRIMARY KEY,
+	user_id BIGINT NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	purpose TEXT NOT NULL CHECK (purpose IN ('verify_email', 'reset_password')),
+	hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX user_tokens_user_id_idx ON user_tokens (user_id, purpose) WHERE used_at IS NULL;
@@ -0,0 +1,3 @@
+-- The users disabled by an admin can't log in, nor use the sessions they
+-- already have.
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,51 @@
+// Package storage holds the errors shared by the repositories of every entity.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	// ErrConflict is returned when a write clashes with existing data, like a duplicated unique value.
+	ErrConflict = errors.New("conflict")
+	// ErrConstraintViolation is returned when a write breaks a database constraint
+	// the validation didn't catch, like a reference to a missing row.
+	ErrConstraintViolation = errors.New("constraint violation")
+	// ErrUnavailable is returned when the database can't be reached, the operation may be retried.
+	ErrUnavailable = errors.New("database unavailable")
+)
+
+// TranslateError turns the errors returned by pgx into the errors of this package,
+// so callers can tell a missing row from an outage without knowing about pgx.
+// pgx.ErrNoRows becomes notFound.
+func TranslateError(err error, notFound error) error {
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return notFound
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == "23505": // unique_violation
+			return fmt.Errorf("%w: %s", ErrConflict, pgErr.Detail)
+		case pgErr.Code[:2] == "23": // integrity_constraint_violation class
+			return fmt.Errorf("%w: %s", ErrConstraintViolation, pgErr.Message)
+		case pgErr.Code[:2] == "08", pgErr.Code[:2] == "53", pgErr.Code[:3] == "57P": // connection, resources and shutdown
+			return fmt.Errorf("%w: %s", ErrUnavailable, pgErr.Message)
+		}
+		return err
+	}
+	// failed connections wrap the net.Error of the dial
+	var netErr net.Error
+	if errors.As(err, &netErr) || pgconn.Timeout(err) {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	return err
+}
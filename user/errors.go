@@ -0,0 +1,27 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/perebaj/ondehj/storage"
+)
+
+var (
+	// ErrNotFound is returned when a user doesn't exist, it wraps pgx.ErrNoRows.
+	ErrNotFound = fmt.Errorf("user not found: %w", pgx.ErrNoRows)
+	// ErrInvalidToken is returned when a token sent by email is unknown, used or expired.
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrInvalidLogin is returned when logging in with an unknown email or a wrong
+	// password, which aren't told apart.
+	ErrInvalidLogin = errors.New("invalid email or password")
+	// ErrEmailNotVerified is returned when logging in before verifying the email.
+	ErrEmailNotVerified = errors.New("email not verified")
+	// ErrDisabled is returned when logging in to an account an admin disabled.
+	ErrDisabled = errors.New("account disabled")
+)
+
+func translateError(err error) error {
+	return storage.TranslateError(err, ErrNotFound)
+}
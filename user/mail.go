@@ -0,0 +1,109 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends the emails of the users, such as the links verifying their
+// email or resetting their password.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+var errHeaderInjection = errors.New("email headers can't have line breaks")
+
+// format returns the message with its headers, ready to be sent.
+func (m Message) format(from string, date time.Time) ([]byte, error) {
+	for _, header := range []string{from, m.To, m.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, errHeaderInjection
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", m.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", m.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(m.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String()), nil
+}
+
+// SMTPMailer sends the emails through an SMTP server, authenticating with
+// PLAIN when it has a username.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	// From is the sender of the emails, such as "ondehoje <noreply@example.com>".
+	From string
+}
+
+var _ Mailer = (*SMTPMailer)(nil)
+
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.format(m.From, time.Now())
+	if err != nil {
+		return err
+	}
+	// the envelope takes the bare address of the sender, without its name
+	sender, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.From, err)
+	}
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	if err := smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, sender.Address, []string{msg.To}, data); err != nil {
+		return fmt.Errorf("sending email to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// WriterMailer writes the emails to a writer instead of sending them, to
+// follow the links locally without an SMTP server. The links log in to the
+// accounts, so the writer must not be the logs. It's safe for concurrent use.
+type WriterMailer struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+var _ Mailer = (*WriterMailer)(nil)
+
+func NewWriterMailer(w io.Writer, from string) *WriterMailer {
+	return &WriterMailer{w: w, from: from}
+}
+
+func (m *WriterMailer) Send(ctx context.Context, msg Message) error {
+	data, err := msg.format(m.from, time.Now())
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := fmt.Fprintf(m.w, "%s\n\n", strings.ReplaceAll(string(data), "\r\n", "\n")); err != nil {
+		return fmt.Errorf("writing email to %s: %w", msg.To, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package user
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriterMailer(t *testing.T) {
+	var b strings.Builder
+	mailer := NewWriterMailer(&b, "ondehoje <noreply@example.com>")
+	err := mailer.Send(context.Background(), Message{
+		To:      "jojo@example.com",
+		Subject: "Verify your ondehoje email",
+		Body:    "Hi Jojo,\n\nhttps://ondehoje.example/verify-email?token=abc\n",
+	})
+	require.NoError(t, err)
+	out := b.String()
+	assert.Contains(t, out, "From: ondehoje <noreply@example.com>\n")
+	assert.Contains(t, out, "To: jojo@example.com\n")
+	assert.Contains(t, out, "Subject: Verify your ondehoje email\n")
+	assert.Contains(t, out, "\n\nHi Jojo,\n\nhttps://ondehoje.example/verify-email?token=abc\n")
+	assert.NotContains(t, out, "\r")
+
+	err = mailer.Send(context.Background(), Message{To: "jojo@example.com\r\nBcc: all@example.com", Subject: "Hi"})
+	assert.ErrorIs(t, err, errHeaderInjection)
+	err = mailer.Send(context.Background(), Message{To: "jojo@example.com", Subject: "Hi\nBcc: all@example.com"})
+	assert.ErrorIs(t, err, errHeaderInjection)
+}
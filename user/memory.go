@@ -0,0 +1,182 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/storage"
+	"github.com/rs/zerolog"
+)
+
+// MemoryRepository is a Repository keeping the users in memory, with the same
+// semantics as SQLRepository. It's meant for tests and local demos, and is safe
+// for concurrent use.
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	lastID int64
+	users  map[int64]User
+	// tokens are the tokens sent by email, by hash.
+	tokens map[string]token
+}
+
+type token struct {
+	userID    int64
+	purpose   Purpose
+	expiresAt time.Time
+	used      bool
+}
+
+var _ Repository = (*MemoryRepository)(nil)
+
+func UserMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{users: map[int64]User{}, tokens: map[string]token{}}
+}
+
+// now mimics the precision of the timestamps stored by Postgres.
+func now() time.Time {
+	return time.Now().Round(time.Microsecond)
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, user User, log zerolog.Logger) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user.Email = normalizeEmail(user.Email)
+	for _, other := range r.users {
+		if other.Email == user.Email {
+			return nil, fmt.Errorf("%w: a user with email %q already exists", storage.ErrConflict, user.Email)
+		}
+	}
+	r.lastID++
+	user.ID = r.lastID
+	user.EmailVerifiedAt = nil
+	user.DisabledAt = nil
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+	r.users[user.ID] = user
+	return &user, nil
+}
+
+func (r *MemoryRepository) GetByID(ctx context.Context, id int64, log zerolog.Logger) (*User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &user, nil
+}
+
+func (r *MemoryRepository) GetByEmail(ctx context.Context, email string, log zerolog.Logger) (*User, error) {
+	email = normalizeEmail(email)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, user := range r.users {
+		if user.Email == email {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryRepository) SetEmailVerified(ctx context.Context, id int64, log zerolog.Logger) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user.UpdatedAt = now()
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &user.UpdatedAt
+	}
+	r.users[id] = user
+	return &user, nil
+}
+
+func (r *MemoryRepository) SetPassword(ctx context.Context, id int64, passwordHash string, log zerolog.Logger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	user.PasswordHash = passwordHash
+	user.UpdatedAt = now()
+	r.users[id] = user
+	return nil
+}
+
+func (r *MemoryRepository) SetRole(ctx context.Context, id int64, role auth.Role, log zerolog.Logger) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user.Role = role
+	user.UpdatedAt = now()
+	r.users[id] = user
+	return &user, nil
+}
+
+func (r *MemoryRepository) SetDisabled(ctx context.Context, id int64, disabled bool, log zerolog.Logger) (*User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	user, ok := r.users[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	user.UpdatedAt = now()
+	switch {
+	case !disabled:
+		user.DisabledAt = nil
+	case user.DisabledAt == nil:
+		user.DisabledAt = &user.UpdatedAt
+	}
+	r.users[id] = user
+	return &user, nil
+}
+
+func (r *MemoryRepository) All(ctx context.Context, log zerolog.Logger) ([]User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	users := make([]User, 0, len(r.users))
+	for _, user := range r.users {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (r *MemoryRepository) CreateToken(ctx context.Context, userID int64, purpose Purpose, hash string, expiresAt time.Time, log zerolog.Logger) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.users[userID]; !ok {
+		return fmt.Errorf("%w: user %d doesn't exist", storage.ErrConstraintViolation, userID)
+	}
+	if _, ok := r.tokens[hash]; ok {
+		return fmt.Errorf("%w: the token already exists", storage.ErrConflict)
+	}
+	r.tokens[hash] = token{userID: userID, purpose: purpose, expiresAt: expiresAt}
+	return nil
+}
+
+func (r *MemoryRepository) UseToken(ctx context.Context, purpose Purpose, hash string, log zerolog.Logger) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t, ok := r.tokens[hash]
+	if !ok || t.purpose != purpose || t.used || !t.expiresAt.After(time.Now()) {
+		return 0, ErrInvalidToken
+	}
+	for hash, other := range r.tokens {
+		if other.userID == t.userID && other.purpose == purpose {
+			other.used = true
+			r.tokens[hash] = other
+		}
+	}
+	return t.userID, nil
+}
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/perebaj/ondehj/validation"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength = 10
+	// maxPasswordBytes is as much as bcrypt reads.
+	maxPasswordBytes = 72
+	maxNameLength    = 100
+	maxEmailLength   = 254
+)
+
+// bcryptCost is a variable so the tests can hash faster.
+var bcryptCost = bcrypt.DefaultCost
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validateSignup checks the fields of a signup, it returns a *validation.Error
+// listing every invalid field, or nil.
+func validateSignup(email, name, password string) error {
+	verr := validation.Error{Subject: "user"}
+	checkEmail(&verr, email)
+	if strings.TrimSpace(name) == "" {
+		verr.Add("name", "is required")
+	} else if utf8.RuneCountInString(name) > maxNameLength {
+		verr.Add("name", "must be at most %d characters long", maxNameLength)
+	}
+	checkPassword(&verr, password)
+	return verr.Err()
+}
+
+func checkEmail(verr *validation.Error, email string) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		verr.Add("email", "is required")
+		return
+	}
+	// only a bare address, a name or a list would end up in the headers of the mails
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > maxEmailLength {
+		verr.Add("email", "must be an email address such as jojo@example.com")
+	}
+}
+
+func checkPassword(verr *validation.Error, password string) {
+	switch {
+	case utf8.RuneCountInString(password) < minPasswordLength:
+		verr.Add("password", "must be at least %d characters long", minPasswordLength)
+	case len(password) > maxPasswordBytes:
+		verr.Add("password", "must be at most %d bytes long", maxPasswordBytes)
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	return string(hash), err
+}
+
+// passwordMatches tells whether password is the one of the hash.
+func passwordMatches(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// newToken returns a random token to send by email, along with the hash the
+// repositories keep.
+func newToken() (token, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(secret)
+	return token, hashToken(token), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
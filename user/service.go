@@ -0,0 +1,272 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/storage"
+	"github.com/perebaj/ondehj/validation"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// verifyEmailTTL is how long the link verifying an email is valid.
+	verifyEmailTTL = 48 * time.Hour
+	// resetPasswordTTL is how long the link resetting a password is valid.
+	resetPasswordTTL = time.Hour
+)
+
+// Session is what a user gets when logging in: a bearer token the
+// auth.TokenVerifier with the secret of the signer accepts.
+type Session struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"token_type"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Service signs the users up and in, and sends them the links verifying their
+// email and resetting their password. It resolves the users of their sessions
+// as the auth.Accounts of the auth.Authenticator.
+type Service struct {
+	users  Repository
+	mailer Mailer
+	signer *auth.TokenSigner
+	// baseURL is where the links sent by email point to, the frontend
+	// handling /verify-email and /reset-password.
+	baseURL string
+	// dummyHash is compared with the passwords of unknown emails, so logging
+	// in takes as long whether the email exists or not.
+	dummyHash string
+}
+
+var _ auth.Accounts = (*Service)(nil)
+
+func NewService(users Repository, mailer Mailer, signer *auth.TokenSigner, baseURL string) (*Service, error) {
+	dummyHash, err := hashPassword("not the password of anyone")
+	if err != nil {
+		return nil, err
+	}
+	return &Service{
+		users:     users,
+		mailer:    mailer,
+		signer:    signer,
+		baseURL:   strings.TrimSuffix(baseURL, "/"),
+		dummyHash: dummyHash,
+	}, nil
+}
+
+// SignUp creates a promoter, who can log in once they follow the link sent to
+// their email. When the email is taken, its owner is told by email instead,
+// not to tell who signed up. It returns a *validation.Error when a field is
+// invalid.
+func (s *Service) SignUp(ctx context.Context, email, name, password string, log zerolog.Logger) error {
+	if err := validateSignup(email, name, password); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	user, err := s.users.Create(ctx, User{
+		Email:        email,
+		Name:         strings.TrimSpace(name),
+		Role:         auth.RolePromoter,
+		PasswordHash: hash,
+	}, log)
+	if errors.Is(err, storage.ErrConflict) {
+		return s.sendAlreadyRegistered(ctx, email, log)
+	}
+	if err != nil {
+		return err
+	}
+	return s.sendVerification(ctx, user, log)
+}
+
+// VerifyEmail marks the email of the user of the token as verified.
+func (s *Service) VerifyEmail(ctx context.Context, token string, log zerolog.Logger) (*User, error) {
+	id, err := s.users.UseToken(ctx, PurposeVerifyEmail, hashToken(token), log)
+	if err != nil {
+		return nil, err
+	}
+	return s.users.SetEmailVerified(ctx, id, log)
+}
+
+// ResendVerification sends a new link verifying the email, when it's one of
+// an unverified user. Otherwise it does nothing, not to tell who signed up.
+func (s *Service) ResendVerification(ctx context.Context, email string, log zerolog.Logger) error {
+	user, err := s.users.GetByEmail(ctx, email, log)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	return s.sendVerification(ctx, user, log)
+}
+
+// Login returns a session of the user with the email and the password. It
+// returns ErrInvalidLogin when they don't match, ErrEmailNotVerified when the
+// user didn't verify their email yet, and ErrDisabled when an admin disabled
+// them.
+func (s *Service) Login(ctx context.Context, email, password string, log zerolog.Logger) (*Session, error) {
+	user, err := s.users.GetByEmail(ctx, email, log)
+	if errors.Is(err, ErrNotFound) {
+		passwordMatches(s.dummyHash, password)
+		return nil, ErrInvalidLogin
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !passwordMatches(user.PasswordHash, password) {
+		return nil, ErrInvalidLogin
+	}
+	if user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+	if user.DisabledAt != nil {
+		return nil, ErrDisabled
+	}
+	token, claims, err := s.signer.Sign(auth.UserSubject(user.ID), user.Role)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{Token: token, TokenType: "Bearer", ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC()}, nil
+}
+
+// Role returns the current role of the user with the id, so a change of role
+// applies to the sessions already open, as does disabling the user.
+func (s *Service) Role(ctx context.Context, id int64, log zerolog.Logger) (auth.Role, error) {
+	user, err := s.users.GetByID(ctx, id, log)
+	if errors.Is(err, ErrNotFound) {
+		return "", fmt.Errorf("%w: unknown user %d", auth.ErrInvalidCredentials, id)
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.DisabledAt != nil {
+		return "", fmt.Errorf("%w: user %d is disabled", auth.ErrInvalidCredentials, id)
+	}
+	return user.Role, nil
+}
+
+// All returns every user, for the admins.
+func (s *Service) All(ctx context.Context, log zerolog.Logger) ([]User, error) {
+	return s.users.All(ctx, log)
+}
+
+// SetRole changes the role of the user with the id, their sessions take it
+// right away. It returns a *validation.Error when the role is unknown.
+func (s *Service) SetRole(ctx context.Context, id int64, role string, log zerolog.Logger) (*User, error) {
+	verr := validation.Error{Subject: "user"}
+	parsed, err := auth.ParseRole(role)
+	switch {
+	case role == "":
+		verr.Add("role", "is required")
+	case err != nil:
+		verr.Add("role", "must be promoter, curator or admin")
+	}
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+	return s.users.SetRole(ctx, id, parsed, log)
+}
+
+// SetDisabled disables the user with the id, who can't log in nor use their
+// sessions anymore, or enables them again.
+func (s *Service) SetDisabled(ctx context.Context, id int64, disabled bool, log zerolog.Logger) (*User, error) {
+	return s.users.SetDisabled(ctx, id, disabled, log)
+}
+
+// ForgotPassword sends a link resetting the password, when the email is one
+// of a user. Otherwise it does nothing, not to tell who signed up.
+func (s *Service) ForgotPassword(ctx context.Context, email string, log zerolog.Logger) error {
+	user, err := s.users.GetByEmail(ctx, email, log)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	link, err := s.newLink(ctx, user, PurposeResetPassword, "/reset-password", resetPasswordTTL, log)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, Message{
+		To:      user.Email,
+		Subject: "Reset your ondehoje password",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link within an hour to choose a new password:\n\n%s\n\n"+
+			"If you didn't ask for it, you can ignore this email, your password didn't change.\n", user.Name, link),
+	})
+}
+
+// ResetPassword sets the password of the user of the token. It returns a
+// *validation.Error when the password is invalid.
+func (s *Service) ResetPassword(ctx context.Context, token, password string, log zerolog.Logger) error {
+	verr := validation.Error{Subject: "user"}
+	checkPassword(&verr, password)
+	if err := verr.Err(); err != nil {
+		return err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	id, err := s.users.UseToken(ctx, PurposeResetPassword, hashToken(token), log)
+	if err != nil {
+		return err
+	}
+	return s.users.SetPassword(ctx, id, hash, log)
+}
+
+// sendAlreadyRegistered tells the owner of an email someone signed up with it
+// again, or sends them a new link when they didn't verify it yet.
+func (s *Service) sendAlreadyRegistered(ctx context.Context, email string, log zerolog.Logger) error {
+	user, err := s.users.GetByEmail(ctx, email, log)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt == nil {
+		return s.sendVerification(ctx, user, log)
+	}
+	return s.mailer.Send(ctx, Message{
+		To:      user.Email,
+		Subject: "You already have an ondehoje account",
+		Body: fmt.Sprintf("Hi %s,\n\nSomebody tried to sign up with your email, which already has an account. "+
+			"If it was you, log in instead, or ask for a new password if you forgot it:\n\n%s\n\n"+
+			"If it wasn't you, you can ignore this email, your account didn't change.\n", user.Name, s.baseURL+"/forgot-password"),
+	})
+}
+
+func (s *Service) sendVerification(ctx context.Context, user *User, log zerolog.Logger) error {
+	link, err := s.newLink(ctx, user, PurposeVerifyEmail, "/verify-email", verifyEmailTTL, log)
+	if err != nil {
+		return err
+	}
+	return s.mailer.Send(ctx, Message{
+		To:      user.Email,
+		Subject: "Verify your ondehoje email",
+		Body: fmt.Sprintf("Hi %s,\n\nFollow this link within two days to verify your email and start publishing your events:\n\n%s\n",
+			user.Name, link),
+	})
+}
+
+// newLink stores a new token of the user for the purpose, and returns the link
+// to the path with it.
+func (s *Service) newLink(ctx context.Context, user *User, purpose Purpose, path string, ttl time.Duration, log zerolog.Logger) (string, error) {
+	token, hash, err := newToken()
+	if err != nil {
+		return "", err
+	}
+	if err := s.users.CreateToken(ctx, user.ID, purpose, hash, time.Now().Add(ttl), log); err != nil {
+		return "", err
+	}
+	return s.baseURL + path + "?" + url.Values{"token": {token}}.Encode(), nil
+}
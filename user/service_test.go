@@ -0,0 +1,245 @@
+package user
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/validation"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	bcryptCost = bcrypt.MinCost
+}
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// fakeMailer keeps the emails instead of sending them.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// lastToken returns the token of the link of the last email.
+func (m *fakeMailer) lastToken(t *testing.T) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	require.NotEmpty(t, m.sent)
+	body := m.sent[len(m.sent)-1].Body
+	start := strings.Index(body, "http")
+	require.NotEqual(t, -1, start, body)
+	link, err := url.Parse(strings.Fields(body[start:])[0])
+	require.NoError(t, err)
+	return link.Query().Get("token")
+}
+
+func newTestService(t *testing.T) (*Service, *fakeMailer) {
+	mailer := &fakeMailer{}
+	service, err := NewService(UserMemoryRepository(), mailer, auth.NewTokenSigner([]byte(testSecret), time.Hour), "https://ondehoje.example/")
+	require.NoError(t, err)
+	return service, mailer
+}
+
+func TestSignUpAndLogin(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	service, mailer := newTestService(t)
+
+	require.NoError(t, service.SignUp(ctx, " Jojo@Example.com", "Jojo", "correct horse", log))
+	u, err := service.users.GetByEmail(ctx, "jojo@example.com", log)
+	require.NoError(t, err)
+	assert.Equal(t, "jojo@example.com", u.Email)
+	assert.Equal(t, auth.RolePromoter, u.Role)
+	assert.Nil(t, u.EmailVerifiedAt)
+	require.Len(t, mailer.sent, 1)
+	assert.Equal(t, "jojo@example.com", mailer.sent[0].To)
+	assert.Contains(t, mailer.sent[0].Body, "https://ondehoje.example/verify-email?token=")
+
+	require.NoError(t, service.SignUp(ctx, "jojo@example.com", "Other", "correct horse", log), "not to tell who signed up")
+	require.Len(t, mailer.sent, 2, "the unverified owner gets a new link")
+	assert.Contains(t, mailer.sent[1].Body, "https://ondehoje.example/verify-email?token=")
+
+	_, err = service.Login(ctx, "jojo@example.com", "correct horse", log)
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	token := mailer.lastToken(t)
+	_, err = service.VerifyEmail(ctx, token+"x", log)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+	verified, err := service.VerifyEmail(ctx, token, log)
+	require.NoError(t, err)
+	assert.NotNil(t, verified.EmailVerifiedAt)
+	_, err = service.VerifyEmail(ctx, token, log)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens are used once")
+
+	_, err = service.Login(ctx, "jojo@example.com", "wrong horse", log)
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+	_, err = service.Login(ctx, "nobody@example.com", "correct horse", log)
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+
+	session, err := service.Login(ctx, "JOJO@example.com", "correct horse", log)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", session.TokenType)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), session.ExpiresAt, time.Minute)
+	claims, err := auth.NewTokenVerifier([]byte(testSecret), nil).Verify(session.Token)
+	require.NoError(t, err)
+	assert.Equal(t, auth.UserSubject(u.ID), claims.Subject, "the email stays on the server")
+	assert.Equal(t, "promoter", claims.Role)
+
+	role, err := service.Role(ctx, u.ID, log)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RolePromoter, role)
+	_, err = service.Role(ctx, u.ID+1, log)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials)
+}
+
+func TestSignUpTakenEmail(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	service, mailer := newTestService(t)
+	require.NoError(t, service.SignUp(ctx, "jojo@example.com", "Jojo", "correct horse", log))
+	_, err := service.VerifyEmail(ctx, mailer.lastToken(t), log)
+	require.NoError(t, err)
+
+	require.NoError(t, service.SignUp(ctx, "JOJO@example.com", "Other", "battery staple", log))
+	require.Len(t, mailer.sent, 2)
+	notice := mailer.sent[1]
+	assert.Equal(t, "jojo@example.com", notice.To)
+	assert.Equal(t, "You already have an ondehoje account", notice.Subject)
+	assert.Contains(t, notice.Body, "Hi Jojo,")
+	assert.NotContains(t, notice.Body, "token=", "it doesn't log in to the account")
+
+	_, err = service.Login(ctx, "jojo@example.com", "correct horse", log)
+	assert.NoError(t, err, "the account didn't change")
+}
+
+func TestSignUpValidation(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	service, mailer := newTestService(t)
+
+	err := service.SignUp(ctx, "Jojo <jojo@example.com>", "", "short", log)
+	var verr *validation.Error
+	require.ErrorAs(t, err, &verr)
+	assert.Len(t, verr.Fields, 3)
+	err = service.SignUp(ctx, "jojo@example.com", "Jojo", strings.Repeat("a", 73), log)
+	assert.ErrorAs(t, err, &verr)
+	assert.Empty(t, mailer.sent)
+}
+
+func TestResendVerification(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	service, mailer := newTestService(t)
+
+	require.NoError(t, service.ResendVerification(ctx, "nobody@example.com", log))
+	assert.Empty(t, mailer.sent)
+
+	require.NoError(t, service.SignUp(ctx, "jojo@example.com", "Jojo", "correct horse", log))
+	first := mailer.lastToken(t)
+	require.NoError(t, service.ResendVerification(ctx, "jojo@example.com", log))
+	require.Len(t, mailer.sent, 2)
+	_, err := service.VerifyEmail(ctx, mailer.lastToken(t), log)
+	require.NoError(t, err)
+	_, err = service.VerifyEmail(ctx, first, log)
+	assert.ErrorIs(t, err, ErrInvalidToken, "the other links are used too")
+
+	require.NoError(t, service.ResendVerification(ctx, "jojo@example.com", log))
+	assert.Len(t, mailer.sent, 2, "verified emails get nothing")
+}
+
+func TestResetPassword(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	service, mailer := newTestService(t)
+
+	require.NoError(t, service.ForgotPassword(ctx, "nobody@example.com", log))
+	assert.Empty(t, mailer.sent, "unknown emails get nothing")
+
+	require.NoError(t, service.SignUp(ctx, "jojo@example.com", "Jojo", "correct horse", log))
+	_, err := service.VerifyEmail(ctx, mailer.lastToken(t), log)
+	require.NoError(t, err)
+
+	require.NoError(t, service.ForgotPassword(ctx, "jojo@example.com", log))
+	assert.Contains(t, mailer.sent[len(mailer.sent)-1].Body, "https://ondehoje.example/reset-password?token=")
+	token := mailer.lastToken(t)
+	_, err = service.VerifyEmail(ctx, token, log)
+	assert.ErrorIs(t, err, ErrInvalidToken, "tokens are for a single purpose")
+
+	var verr *validation.Error
+	assert.ErrorAs(t, service.ResetPassword(ctx, token, "short", log), &verr)
+	require.NoError(t, service.ResetPassword(ctx, token, "battery staple", log))
+	assert.ErrorIs(t, service.ResetPassword(ctx, token, "another staple", log), ErrInvalidToken)
+
+	_, err = service.Login(ctx, "jojo@example.com", "correct horse", log)
+	assert.ErrorIs(t, err, ErrInvalidLogin)
+	_, err = service.Login(ctx, "jojo@example.com", "battery staple", log)
+	assert.NoError(t, err)
+}
+
+func TestMemoryUseTokenExpired(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	users := UserMemoryRepository()
+	u, err := users.Create(ctx, User{Email: "jojo@example.com", Name: "Jojo", Role: auth.RolePromoter}, log)
+	require.NoError(t, err)
+	require.NoError(t, users.CreateToken(ctx, u.ID, PurposeVerifyEmail, hashToken("old"), time.Now().Add(-time.Second), log))
+	_, err = users.UseToken(ctx, PurposeVerifyEmail, hashToken("old"), log)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestAdministerUsers(t *testing.T) {
+	ctx, log := context.Background(), zerolog.Nop()
+	service, mailer := newTestService(t)
+	require.NoError(t, service.SignUp(ctx, "jojo@example.com", "Jojo", "correct horse", log))
+	_, err := service.VerifyEmail(ctx, mailer.lastToken(t), log)
+	require.NoError(t, err)
+	require.NoError(t, service.SignUp(ctx, "ana@example.com", "Ana", "correct horse", log))
+
+	users, err := service.All(ctx, log)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "jojo@example.com", users[0].Email)
+	assert.Equal(t, "ana@example.com", users[1].Email)
+	id := users[0].ID
+
+	var verr *validation.Error
+	_, err = service.SetRole(ctx, id, "root", log)
+	assert.ErrorAs(t, err, &verr)
+	_, err = service.SetRole(ctx, id, "", log)
+	assert.ErrorAs(t, err, &verr)
+	_, err = service.SetRole(ctx, 99, "curator", log)
+	assert.ErrorIs(t, err, ErrNotFound)
+	u, err := service.SetRole(ctx, id, "curator", log)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleCurator, u.Role)
+	role, err := service.Role(ctx, id, log)
+	require.NoError(t, err)
+	assert.Equal(t, auth.RoleCurator, role, "the sessions take the new role")
+
+	u, err = service.SetDisabled(ctx, id, true, log)
+	require.NoError(t, err)
+	require.NotNil(t, u.DisabledAt)
+	disabledAt := *u.DisabledAt
+	u, err = service.SetDisabled(ctx, id, true, log)
+	require.NoError(t, err)
+	assert.Equal(t, disabledAt, *u.DisabledAt, "disabled since the first time")
+	_, err = service.Login(ctx, "jojo@example.com", "correct horse", log)
+	assert.ErrorIs(t, err, ErrDisabled)
+	_, err = service.Role(ctx, id, log)
+	assert.ErrorIs(t, err, auth.ErrInvalidCredentials, "the sessions stop working")
+
+	u, err = service.SetDisabled(ctx, id, false, log)
+	require.NoError(t, err)
+	assert.Nil(t, u.DisabledAt)
+	_, err = service.Login(ctx, "jojo@example.com", "correct horse", log)
+	assert.NoError(t, err)
+}
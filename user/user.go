@@ -0,0 +1,211 @@
+// Package user keeps the accounts of the people who log in to publish their
+// events: their signup, the verification of their email, and the reset of
+// their password.
+package user
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/perebaj/ondehj/auth"
+	"github.com/perebaj/ondehj/storage"
+	"github.com/rs/zerolog"
+)
+
+type User struct {
+	ID int64 `json:"id"`
+	// Email identifies the user, it's stored in lower case.
+	Email string    `json:"email"`
+	Name  string    `json:"name"`
+	Role  auth.Role `json:"role"`
+	// PasswordHash is the bcrypt hash of the password, never sent to clients.
+	PasswordHash string `json:"-"`
+	// EmailVerifiedAt is nil until the user follows the link sent on signup,
+	// they can't log in before.
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty"`
+	// DisabledAt is set while an admin disables the user, who can't log in
+	// nor use their sessions.
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Purpose is what a token sent by email is for.
+type Purpose string
+
+const (
+	PurposeVerifyEmail   Purpose = "verify_email"
+	PurposeResetPassword Purpose = "reset_password"
+)
+
+type Repository interface {
+	// Create returns storage.ErrConflict when a user has the same email.
+	Create(ctx context.Context, user User, log zerolog.Logger) (*User, error)
+	GetByID(ctx context.Context, id int64, log zerolog.Logger) (*User, error)
+	GetByEmail(ctx context.Context, email string, log zerolog.Logger) (*User, error)
+	SetEmailVerified(ctx context.Context, id int64, log zerolog.Logger) (*User, error)
+	SetPassword(ctx context.Context, id int64, passwordHash string, log zerolog.Logger) error
+	// SetRole changes the role of the user.
+	SetRole(ctx context.Context, id int64, role auth.Role, log zerolog.Logger) (*User, error)
+	// SetDisabled disables or enables the user, keeping when they were
+	// disabled first.
+	SetDisabled(ctx context.Context, id int64, disabled bool, log zerolog.Logger) (*User, error)
+	// All returns the users ordered by id.
+	All(ctx context.Context, log zerolog.Logger) ([]User, error)
+	// CreateToken stores the hash of a token of the user valid until expiresAt.
+	CreateToken(ctx context.Context, userID int64, purpose Purpose, hash string, expiresAt time.Time, log zerolog.Logger) error
+	// UseToken returns the user of the token with the hash, which can't be
+	// used again, nor can the other tokens of the user for the purpose. It
+	// returns ErrInvalidToken when the token is unknown, used or expired.
+	UseToken(ctx context.Context, purpose Purpose, hash string, log zerolog.Logger) (int64, error)
+}
+
+const columns = `id, email, name, role, password_hash, email_verified_at, disabled_at, created_at, updated_at`
+
+func scanUser(row pgx.Row, user *User) error {
+	return row.Scan(&user.ID, &user.Email, &user.Name, &user.Role, &user.PasswordHash, &user.EmailVerifiedAt, &user.DisabledAt, &user.CreatedAt, &user.UpdatedAt)
+}
+
+type SQLRepository struct {
+	db *pgxpool.Pool
+}
+
+var _ Repository = (*SQLRepository)(nil)
+
+func UserSQLRepository(db *pgxpool.Pool) *SQLRepository {
+	return &SQLRepository{db: db}
+}
+
+func (r *SQLRepository) Create(ctx context.Context, user User, log zerolog.Logger) (*User, error) {
+	err := scanUser(r.db.QueryRow(ctx, `
+		INSERT INTO users (email, name, role, password_hash) VALUES ($1, $2, $3, $4) RETURNING `+columns,
+		normalizeEmail(user.Email), user.Name, string(user.Role), user.PasswordHash), &user)
+	if err != nil {
+		log.Err(err).Msg("Create failed")
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *SQLRepository) GetByID(ctx context.Context, id int64, log zerolog.Logger) (*User, error) {
+	var user User
+	err := scanUser(r.db.QueryRow(ctx, `SELECT `+columns+` FROM users WHERE id = $1`, id), &user)
+	if err != nil {
+		log.Err(err).Msg("GetByID failed")
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *SQLRepository) GetByEmail(ctx context.Context, email string, log zerolog.Logger) (*User, error) {
+	var user User
+	err := scanUser(r.db.QueryRow(ctx, `SELECT `+columns+` FROM users WHERE email = $1`, normalizeEmail(email)), &user)
+	if err != nil {
+		log.Err(err).Msg("GetByEmail failed")
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *SQLRepository) SetEmailVerified(ctx context.Context, id int64, log zerolog.Logger) (*User, error) {
+	var user User
+	err := scanUser(r.db.QueryRow(ctx, `
+		UPDATE users SET email_verified_at = coalesce(email_verified_at, now()), updated_at = now()
+		WHERE id = $1 RETURNING `+columns, id), &user)
+	if err != nil {
+		log.Err(err).Msg("SetEmailVerified failed")
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *SQLRepository) SetPassword(ctx context.Context, id int64, passwordHash string, log zerolog.Logger) error {
+	res, err := r.db.Exec(ctx, `UPDATE users SET password_hash = $2, updated_at = now() WHERE id = $1`, id, passwordHash)
+	if err != nil {
+		log.Err(err).Msg("SetPassword failed")
+		return translateError(err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLRepository) SetRole(ctx context.Context, id int64, role auth.Role, log zerolog.Logger) (*User, error) {
+	var user User
+	err := scanUser(r.db.QueryRow(ctx, `
+		UPDATE users SET role = $2, updated_at = now() WHERE id = $1 RETURNING `+columns, id, string(role)), &user)
+	if err != nil {
+		log.Err(err).Msg("SetRole failed")
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *SQLRepository) SetDisabled(ctx context.Context, id int64, disabled bool, log zerolog.Logger) (*User, error) {
+	var user User
+	err := scanUser(r.db.QueryRow(ctx, `
+		UPDATE users SET disabled_at = CASE WHEN $2 THEN coalesce(disabled_at, now()) END, updated_at = now()
+		WHERE id = $1 RETURNING `+columns, id, disabled), &user)
+	if err != nil {
+		log.Err(err).Msg("SetDisabled failed")
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+func (r *SQLRepository) All(ctx context.Context, log zerolog.Logger) ([]User, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+columns+` FROM users ORDER BY id`)
+	if err != nil {
+		log.Err(err).Msg("All failed")
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := scanUser(rows, &user); err != nil {
+			log.Err(err).Msg("All failed")
+			return nil, translateError(err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("All failed")
+		return nil, translateError(err)
+	}
+	return users, nil
+}
+
+func (r *SQLRepository) CreateToken(ctx context.Context, userID int64, purpose Purpose, hash string, expiresAt time.Time, log zerolog.Logger) error {
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO user_tokens (user_id, purpose, hash, expires_at) VALUES ($1, $2, $3, $4)`,
+		userID, string(purpose), hash, expiresAt)
+	if err != nil {
+		log.Err(err).Msg("CreateToken failed")
+		return translateError(err)
+	}
+	return nil
+}
+
+func (r *SQLRepository) UseToken(ctx context.Context, purpose Purpose, hash string, log zerolog.Logger) (int64, error) {
+	var userID int64
+	err := pgx.BeginFunc(ctx, r.db, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			SELECT user_id FROM user_tokens
+			WHERE purpose = $1 AND hash = $2 AND used_at IS NULL AND expires_at > now()
+			FOR UPDATE`, string(purpose), hash).Scan(&userID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE user_tokens SET used_at = now() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, string(purpose))
+		return err
+	})
+	if err != nil {
+		log.Err(err).Msg("UseToken failed")
+		return 0, storage.TranslateError(err, ErrInvalidToken)
+	}
+	return userID, nil
+}
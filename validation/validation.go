@@ -0,0 +1,53 @@
+// Package validation describes the invalid fields of a payload, whatever the entity.
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// InstagramHandle matches an Instagram user name, without the @ or the profile URL.
+var InstagramHandle = regexp.MustCompile(`^[A-Za-z0-9._]{1,30}$`)
+
+// FieldError describes why a field of a payload is invalid.
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// Error lists every invalid field of a payload.
+type Error struct {
+	// Subject names what the payload is, such as "event".
+	Subject string
+	Fields  []FieldError
+}
+
+func (e *Error) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		reasons[i] = f.Field + ": " + f.Reason
+	}
+	return "invalid " + e.What() + ": " + strings.Join(reasons, "; ")
+}
+
+// What returns the subject of the payload, "payload" when unknown.
+func (e *Error) What() string {
+	if e.Subject == "" {
+		return "payload"
+	}
+	return e.Subject
+}
+
+// Add records that field is invalid, reason is formatted with args like fmt.Sprintf.
+func (e *Error) Add(field, reason string, args ...any) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Reason: fmt.Sprintf(reason, args...)})
+}
+
+// Err returns e when a field was added, nil otherwise.
+func (e *Error) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,25 @@
+package venue
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/perebaj/ondehj/storage"
+)
+
+var (
+	// ErrNotFound is returned when a venue doesn't exist, it wraps pgx.ErrNoRows.
+	ErrNotFound = fmt.Errorf("venue not found: %w", pgx.ErrNoRows)
+	// ErrInUse is returned when deleting a venue that events still reference, it wraps storage.ErrConflict.
+	ErrInUse = fmt.Errorf("%w: events still take place at the venue", storage.ErrConflict)
+)
+
+func translateError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" { // foreign_key_violation, only deleting can break one
+		return ErrInUse
+	}
+	return storage.TranslateError(err, ErrNotFound)
+}
@@ -0,0 +1,128 @@
+package venue
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perebaj/ondehj/storage"
+	"github.com/rs/zerolog"
+)
+
+// MemoryRepository is a Repository keeping the venues in memory, with the same
+// semantics as SQLRepository. It's meant for tests and local demos, and is safe
+// for concurrent use.
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	lastID int64
+	venues map[int64]Venue
+	inUse  func(id int64) bool
+}
+
+var _ Repository = (*MemoryRepository)(nil)
+
+func VenueMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{venues: map[int64]Venue{}}
+}
+
+// SetInUse registers how to tell whether events reference a venue, like the
+// foreign key of the events table, so Delete can return ErrInUse.
+func (r *MemoryRepository) SetInUse(inUse func(id int64) bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.inUse = inUse
+}
+
+// now mimics the precision of the timestamps stored by Postgres.
+func now() time.Time {
+	return time.Now().Round(time.Microsecond)
+}
+
+// checkUnique mimics the unique index on the name and city, r.mu must be held.
+func (r *MemoryRepository) checkUnique(venue Venue) error {
+	for _, other := range r.venues {
+		if other.ID != venue.ID && strings.EqualFold(other.Name, venue.Name) && strings.EqualFold(other.City, venue.City) {
+			return fmt.Errorf("%w: venue %q already exists in %q", storage.ErrConflict, venue.Name, venue.City)
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) Create(ctx context.Context, venue Venue, log zerolog.Logger) (*Venue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	venue.ID = r.lastID + 1
+	if err := r.checkUnique(venue); err != nil {
+		return nil, err
+	}
+	r.lastID++
+	venue.CreatedAt = now()
+	venue.UpdatedAt = venue.CreatedAt
+	r.venues[venue.ID] = venue
+	return &venue, nil
+}
+
+func (r *MemoryRepository) GetByID(ctx context.Context, id int64, log zerolog.Logger) (*Venue, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	venue, ok := r.venues[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &venue, nil
+}
+
+func (r *MemoryRepository) Update(ctx context.Context, id int64, newVenue Venue, log zerolog.Logger) (*Venue, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	current, ok := r.venues[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	newVenue.ID = id
+	if err := r.checkUnique(newVenue); err != nil {
+		return nil, err
+	}
+	newVenue.CreatedAt = current.CreatedAt
+	newVenue.UpdatedAt = now()
+	r.venues[id] = newVenue
+	return &newVenue, nil
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, id int64, log zerolog.Logger) error {
+	r.mu.RLock()
+	inUse := r.inUse
+	r.mu.RUnlock()
+	// asked without holding r.mu, the events repository may be reading the venues
+	if inUse != nil && inUse(id) {
+		return ErrInUse
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.venues[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.venues, id)
+	return nil
+}
+
+// All returns the venues ordered by name.
+func (r *MemoryRepository) All(ctx context.Context, log zerolog.Logger) ([]Venue, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	venues := make([]Venue, 0, len(r.venues))
+	for _, venue := range r.venues {
+		venues = append(venues, venue)
+	}
+	sort.Slice(venues, func(i, j int) bool {
+		a, b := strings.ToLower(venues[i].Name), strings.ToLower(venues[j].Name)
+		if a != b {
+			return a < b
+		}
+		return venues[i].ID < venues[j].ID
+	})
+	return venues, nil
+}
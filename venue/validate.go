@@ -0,0 +1,50 @@
+package venue
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/perebaj/ondehj/validation"
+)
+
+const (
+	maxNameLength          = 200
+	maxAddressLength       = 300
+	maxNeighbourhoodLength = 100
+	maxCityLength          = 100
+)
+
+// Validate checks a venue before it's created or updated.
+// It returns a *validation.Error listing every invalid field, or nil.
+func (v Venue) Validate() error {
+	verr := validation.Error{Subject: "venue"}
+	if strings.TrimSpace(v.Name) == "" {
+		verr.Add("name", "is required")
+	} else if utf8.RuneCountInString(v.Name) > maxNameLength {
+		verr.Add("name", "must be at most %d characters long", maxNameLength)
+	}
+	if utf8.RuneCountInString(v.Address) > maxAddressLength {
+		verr.Add("address", "must be at most %d characters long", maxAddressLength)
+	}
+	if utf8.RuneCountInString(v.Neighbourhood) > maxNeighbourhoodLength {
+		verr.Add("neighbourhood", "must be at most %d characters long", maxNeighbourhoodLength)
+	}
+	if utf8.RuneCountInString(v.City) > maxCityLength {
+		verr.Add("city", "must be at most %d characters long", maxCityLength)
+	}
+	if v.Capacity < 0 {
+		verr.Add("capacity", "must not be negative")
+	}
+	if c := v.Coordinates; c != nil {
+		if c.Latitude < -90 || c.Latitude > 90 {
+			verr.Add("coordinates.lat", "must be between -90 and 90")
+		}
+		if c.Longitude < -180 || c.Longitude > 180 {
+			verr.Add("coordinates.lng", "must be between -180 and 180")
+		}
+	}
+	if v.InstagramPage != "" && !validation.InstagramHandle.MatchString(v.InstagramPage) {
+		verr.Add("instagram_page", "must be an Instagram handle such as onde.hoje, without @ or URL")
+	}
+	return verr.Err()
+}
@@ -0,0 +1,185 @@
+// Package venue stores the places where the events happen.
+package venue
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+// Coordinates is a position in WGS 84 decimal degrees.
+type Coordinates struct {
+	Latitude  float64 `json:"lat"`
+	Longitude float64 `json:"lng"`
+}
+
+type Venue struct {
+	ID            int64  `json:"id"`
+	Name          string `json:"name"`
+	Address       string `json:"address"`
+	Neighbourhood string `json:"neighbourhood"`
+	City          string `json:"city"`
+	// Capacity is the number of people the venue holds, zero when unknown.
+	Capacity int `json:"capacity"`
+	// Coordinates is nil until the venue is placed on a map.
+	Coordinates   *Coordinates `json:"coordinates"`
+	InstagramPage string       `json:"instagram_page"`
+	CreatedAt     time.Time    `json:"created_at"`
+	UpdatedAt     time.Time    `json:"updated_at"`
+}
+
+type Repository interface {
+	// Create returns ErrConflict when a venue with the same name already exists in the city.
+	Create(ctx context.Context, venue Venue, log zerolog.Logger) (*Venue, error)
+	GetByID(ctx context.Context, id int64, log zerolog.Logger) (*Venue, error)
+	Update(ctx context.Context, id int64, newVenue Venue, log zerolog.Logger) (*Venue, error)
+	// Delete returns ErrInUse when events still reference the venue.
+	Delete(ctx context.Context, id int64, log zerolog.Logger) error
+	// All returns the venues ordered by name.
+	All(ctx context.Context, log zerolog.Logger) ([]Venue, error)
+}
+
+// columns lists the venues columns in the order scanVenue reads them.
+const columns = `id, name, address, neighbourhood, city, capacity, latitude, longitude, instagram_page, created_at, updated_at`
+
+func scanVenue(row pgx.Row, venue *Venue) error {
+	var latitude, longitude *float64
+	err := row.Scan(&venue.ID, &venue.Name, &venue.Address, &venue.Neighbourhood, &venue.City, &venue.Capacity, &latitude, &longitude, &venue.InstagramPage, &venue.CreatedAt, &venue.UpdatedAt)
+	venue.Coordinates = coordinates(latitude, longitude)
+	return err
+}
+
+func coordinates(latitude, longitude *float64) *Coordinates {
+	if latitude == nil || longitude == nil {
+		return nil
+	}
+	return &Coordinates{Latitude: *latitude, Longitude: *longitude}
+}
+
+// latLng returns the latitude and longitude columns of the venue, null when it isn't on a map.
+func (v Venue) latLng() (latitude, longitude *float64) {
+	if v.Coordinates == nil {
+		return nil, nil
+	}
+	return &v.Coordinates.Latitude, &v.Coordinates.Longitude
+}
+
+// JoinedColumns are the columns of the venues table aliased as v read by
+// Joined, for queries outer joining the venues.
+const JoinedColumns = `v.id, v.name, v.address, v.neighbourhood, v.city, v.capacity, v.latitude, v.longitude, v.instagram_page, v.created_at, v.updated_at`
+
+// Joined receives the JoinedColumns of a row, they're all null when the row has no venue.
+type Joined struct {
+	id                                            *int64
+	name, address, neighbourhood, city, instagram *string
+	capacity                                      *int
+	latitude, longitude                           *float64
+	createdAt, updatedAt                          *time.Time
+}
+
+// Dest returns the scan destinations of the JoinedColumns.
+func (j *Joined) Dest() []any {
+	return []any{&j.id, &j.name, &j.address, &j.neighbourhood, &j.city, &j.capacity, &j.latitude, &j.longitude, &j.instagram, &j.createdAt, &j.updatedAt}
+}
+
+// Venue returns the scanned venue, or nil when there was none.
+func (j *Joined) Venue() *Venue {
+	if j.id == nil {
+		return nil
+	}
+	return &Venue{
+		ID:            *j.id,
+		Name:          *j.name,
+		Address:       *j.address,
+		Neighbourhood: *j.neighbourhood,
+		City:          *j.city,
+		Capacity:      *j.capacity,
+		Coordinates:   coordinates(j.latitude, j.longitude),
+		InstagramPage: *j.instagram,
+		CreatedAt:     *j.createdAt,
+		UpdatedAt:     *j.updatedAt,
+	}
+}
+
+type SQLRepository struct {
+	db *pgxpool.Pool
+}
+
+func VenueSQLRepository(db *pgxpool.Pool) *SQLRepository {
+	return &SQLRepository{db: db}
+}
+
+func (r *SQLRepository) Create(ctx context.Context, venue Venue, log zerolog.Logger) (*Venue, error) {
+	latitude, longitude := venue.latLng()
+	err := scanVenue(r.db.QueryRow(ctx, `
+		INSERT INTO venues (name, address, neighbourhood, city, capacity, latitude, longitude, instagram_page)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING `+columns,
+		venue.Name, venue.Address, venue.Neighbourhood, venue.City, venue.Capacity, latitude, longitude, venue.InstagramPage), &venue)
+	if err != nil {
+		log.Err(err).Msg("Create venue failed")
+		return nil, translateError(err)
+	}
+	return &venue, nil
+}
+
+// GetByID returns ErrNotFound when the venue doesn't exist.
+func (r *SQLRepository) GetByID(ctx context.Context, id int64, log zerolog.Logger) (*Venue, error) {
+	var venue Venue
+	err := scanVenue(r.db.QueryRow(ctx, `SELECT `+columns+` FROM venues WHERE id = $1`, id), &venue)
+	if err != nil {
+		log.Err(err).Msg("GetByID venue failed")
+		return nil, translateError(err)
+	}
+	return &venue, nil
+}
+
+func (r *SQLRepository) Update(ctx context.Context, id int64, newVenue Venue, log zerolog.Logger) (*Venue, error) {
+	latitude, longitude := newVenue.latLng()
+	err := scanVenue(r.db.QueryRow(ctx, `
+		UPDATE venues SET name = $1, address = $2, neighbourhood = $3, city = $4, capacity = $5, latitude = $6, longitude = $7, instagram_page = $8, updated_at = now()
+		WHERE id = $9 RETURNING `+columns,
+		newVenue.Name, newVenue.Address, newVenue.Neighbourhood, newVenue.City, newVenue.Capacity, latitude, longitude, newVenue.InstagramPage, id), &newVenue)
+	if err != nil {
+		log.Err(err).Msg("Update venue failed")
+		return nil, translateError(err)
+	}
+	return &newVenue, nil
+}
+
+func (r *SQLRepository) Delete(ctx context.Context, id int64, log zerolog.Logger) error {
+	res, err := r.db.Exec(ctx, `DELETE FROM venues WHERE id = $1`, id)
+	if err != nil {
+		log.Err(err).Msg("Delete venue failed")
+		return translateError(err)
+	}
+	if res.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLRepository) All(ctx context.Context, log zerolog.Logger) ([]Venue, error) {
+	rows, err := r.db.Query(ctx, `SELECT `+columns+` FROM venues ORDER BY lower(name), id`)
+	if err != nil {
+		log.Err(err).Msg("All venues failed")
+		return nil, translateError(err)
+	}
+	defer rows.Close()
+	venues := []Venue{}
+	for rows.Next() {
+		var venue Venue
+		if err := scanVenue(rows, &venue); err != nil {
+			log.Err(err).Msg("All venues failed")
+			return nil, translateError(err)
+		}
+		venues = append(venues, venue)
+	}
+	if err := rows.Err(); err != nil {
+		log.Err(err).Msg("All venues failed")
+		return nil, translateError(err)
+	}
+	return venues, nil
+}